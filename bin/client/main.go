@@ -5,20 +5,63 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/mnxn/chat/client"
 )
 
 var (
+	config    = flag.String("config", defaultConfigPath(), "client config file")
+	server    = flag.String("server", "", "name of a server from the config file")
 	name      = flag.String("name", "", "display name")
 	host      = flag.String("host", "localhost", "chat server hostname")
 	port      = flag.Int("port", 5555, "chat server port number")
 	keepalive = flag.Int("keepalive", 15, "how often to send keepalive request to the server in seconds")
 )
 
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "chat", "client.json")
+}
+
 func main() {
 	flag.Parse()
 
+	password := os.Getenv("CHAT_PASSWORD")
+
+	cfg, err := client.LoadConfig(*config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if s, ok := cfg.Server(*server); ok {
+		if !set["host"] {
+			*host = s.Host
+		}
+		if !set["port"] {
+			*port = s.Port
+		}
+		if password == "" {
+			password = s.Password
+		}
+	} else if *server != "" {
+		fmt.Fprintf(os.Stderr, "unknown server %q.\n", *server)
+		return
+	}
+	if !set["name"] {
+		*name = cfg.Name
+	}
+	if !set["keepalive"] {
+		*keepalive = cfg.Keepalive
+	}
+
 	if *keepalive <= 0 || 30 < *keepalive {
 		fmt.Fprintln(os.Stderr, "keepalive must be between 1 and 30.")
 		return
@@ -36,7 +79,7 @@ func main() {
 		*name = scanner.Text()
 	}
 
-	c := client.NewClient(*name, *host, *port, *keepalive)
+	c := client.NewClient(*name, password, *host, *port, *keepalive, cfg)
 	if err := c.Run(); err != nil {
 		fmt.Fprintln(os.Stderr, "remote server disconnected.")
 	} else {
@@ -2,22 +2,73 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/mnxn/chat/server"
 )
 
-var port = flag.Int("port", 5555, "chat server port number")
+var (
+	config       = flag.String("config", "", "server config file")
+	port         = flag.Int("port", 5555, "chat server port number")
+	blockedError = flag.Bool("blocked-error", false, "reply with an error instead of silently dropping blocked direct messages")
+	stateFile    = flag.String("state", "", "file that registered accounts are saved to")
+	motd         = flag.String("motd", "", "message of the day sent to clients after connecting")
+)
 
 func main() {
 	flag.Parse()
 
 	logger := log.Default()
-	logger.Printf("serving on port %d\n", *port)
 
-	s := server.NewServer(*port, logger)
-	err := s.Run()
+	cfg := server.DefaultConfig()
+	if *config != "" {
+		var err error
+		cfg, err = server.LoadConfig(*config)
+		if err != nil {
+			logger.Fatalln(err)
+		}
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Listen = []string{fmt.Sprintf(":%d", *port)}
+		case "blocked-error":
+			cfg.BlockedError = *blockedError
+		case "state":
+			cfg.StateFile = *stateFile
+		case "motd":
+			cfg.MOTD = *motd
+		}
+	})
+
+	s, err := server.NewServer(cfg, logger)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		closeServer(logger, s)
+		os.Exit(0)
+	}()
+
+	err = s.Run()
+	closeServer(logger, s)
 	if err != nil {
 		logger.Fatalf("server error: %s\n", err.Error())
 	}
 }
+
+func closeServer(logger *log.Logger, s *server.Server) {
+	err := s.Close()
+	if err != nil {
+		logger.Printf("error saving state: %s\n", err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -13,15 +15,40 @@ import (
 )
 
 type Client struct {
-	name string
+	atomicName atomic.Pointer[string]
+	password   string
 
 	host string
 	port int
 
 	atomicCurrent atomic.Pointer[string]
 
+	// Whether the user set a presence other than online with a command.
+	// Only the user's own presence changes prevent the client from marking the user away when idle.
+	presenceSet atomic.Bool
+
+	capabilities atomic.Uint32 // The capabilities that the server enabled.
+
+	messages      map[protocol.MessageID]quote // Recently displayed chat messages that replies can quote.
+	messageOrder  []protocol.MessageID         // The IDs of the remembered chat messages from oldest to newest.
+	messagesMutex sync.Mutex
+
+	readMarkers  map[string]protocol.MessageID // The read marker of each room from the server.
+	lastMessages map[string]protocol.MessageID // The last message that the client displayed in each room.
+	unread       map[string]uint32             // The number of unread messages in each room.
+	receipts     []protocol.MessageID          // Direct messages that are read once the user enters the next line.
+	unreadMutex  sync.Mutex
+
+	lastPaged protocol.ClientRequest // The last request for a search or listing that the user sent.
+	nextPage  protocol.ClientRequest // The request for the next page of results of lastPaged, if there is one.
+	pageMutex sync.Mutex
+
+	config      *Config
+	configMutex sync.RWMutex
+
 	input    chan string
 	output   chan string
+	status   chan string // Transient lines, such as typing indicators, that the next output replaces.
 	incoming chan protocol.ServerResponse
 	outgoing chan protocol.ClientRequest
 
@@ -29,43 +56,109 @@ type Client struct {
 	conn   net.Conn
 }
 
-func NewClient(name, host string, port int, keepalive int) *Client {
+// NewClient creates a client that logs in as a registered user if password is not empty.
+func NewClient(name, password, host string, port int, keepalive int, config *Config) *Client {
 	client := &Client{
-		name: name,
-		host: host,
-		port: port,
+		atomicName: atomic.Pointer[string]{},
+		password:   password,
+		host:       host,
+		port:       port,
 
 		atomicCurrent: atomic.Pointer[string]{},
 
+		presenceSet: atomic.Bool{},
+
+		capabilities: atomic.Uint32{},
+
+		messages:      make(map[protocol.MessageID]quote),
+		messageOrder:  []protocol.MessageID{},
+		messagesMutex: sync.Mutex{},
+
+		readMarkers:  make(map[string]protocol.MessageID),
+		lastMessages: make(map[string]protocol.MessageID),
+		unread:       make(map[string]uint32),
+		receipts:     []protocol.MessageID{},
+		unreadMutex:  sync.Mutex{},
+
+		lastPaged: nil,
+		nextPage:  nil,
+		pageMutex: sync.Mutex{},
+
+		config:      config,
+		configMutex: sync.RWMutex{},
+
 		input:    make(chan string),
 		output:   make(chan string),
+		status:   make(chan string),
 		incoming: make(chan protocol.ServerResponse),
 		outgoing: make(chan protocol.ClientRequest),
 
 		ticker: time.NewTicker(time.Duration(keepalive) * time.Second),
 		conn:   nil,
 	}
+	client.atomicName.Store(&name)
 	current := "general"
 	client.atomicCurrent.Store(&current)
 	return client
 }
 
+const (
+	clearLine      = "\r\x1b[K"       // Moves the cursor to the start of the line and clears the line.
+	statusDuration = 10 * time.Second // How long the status line is shown if nothing else is printed.
+)
+
+func (c *Client) name() string {
+	return *c.atomicName.Load()
+}
+
+func (c *Client) has(capability protocol.Capability) bool {
+	return protocol.Capability(c.capabilities.Load()).Has(capability)
+}
+
 func (c *Client) Run() error {
 	var err error
-	c.conn, err = net.Dial("tcp", fmt.Sprintf("%s:%d", c.host, c.port))
+	c.conn, err = net.Dial("tcp", net.JoinHostPort(c.host, strconv.Itoa(c.port)))
 	if err != nil {
 		return fmt.Errorf("error dialing: %w", err)
 	}
 	defer c.conn.Close()
 
-	err = protocol.EncodeClientRequest(c.conn, &protocol.ConnectRequest{
-		Version: 1,
-		Name:    c.name,
-	})
+	if c.password != "" {
+		err = protocol.EncodeClientRequest(c.conn, &protocol.LoginRequest{
+			Version:  protocol.Version2,
+			Name:     c.name(),
+			Password: c.password,
+		})
+	} else {
+		err = protocol.EncodeClientRequest(c.conn, &protocol.ConnectRequest{
+			Version: protocol.Version2,
+			Name:    c.name(),
+		})
+	}
 	if err != nil {
 		return fmt.Errorf("error initiating connection: %w", err)
 	}
 
+	err = protocol.EncodeClientRequest(c.conn, &protocol.NegotiateRequest{
+		Capabilities: protocol.EchoMessages | protocol.OfflineMessages | protocol.PresenceUpdates |
+			protocol.TypingNotifications | protocol.NameChanges | protocol.MessageIDs | protocol.Receipts,
+	})
+	if err != nil {
+		return fmt.Errorf("error negotiating capabilities: %w", err)
+	}
+
+	c.configMutex.RLock()
+	rooms := append([]string(nil), c.config.Rooms...)
+	c.configMutex.RUnlock()
+	for _, room := range rooms {
+		err = protocol.EncodeClientRequest(c.conn, &protocol.JoinRoomRequest{
+			Room: room,
+		})
+		if err != nil {
+			return fmt.Errorf("error joining room: %w", err)
+		}
+	}
+
 	fmt.Println("connected.")
 	fmt.Println()
 
@@ -88,20 +181,64 @@ func (c *Client) Run() error {
 		decodeErr <- err
 	}()
 
+	c.configMutex.RLock()
+	awayAfter := time.Duration(c.config.AwayAfter) * time.Minute
+	c.configMutex.RUnlock()
+	lastInput := time.Now()
+	idle := false
+
+	// The status line is printed without a newline so that it can be cleared before the next output.
+	statusShown := false
+	var statusExpired <-chan time.Time
+
 	for {
 		select {
 		case input := <-c.input:
+			lastInput = time.Now()
+			if idle {
+				idle = false
+				err = protocol.EncodeClientRequest(c.conn, &protocol.SetPresenceRequest{
+					Presence: protocol.Online,
+					Message:  "",
+				})
+				if err != nil {
+					return fmt.Errorf("error sending request: %w", err)
+				}
+			}
 			go c.parse(input)
 
 		case output := <-c.output:
+			if statusShown {
+				fmt.Print(clearLine)
+				statusShown, statusExpired = false, nil
+			}
 			fmt.Print(output)
 
+		case status := <-c.status:
+			fmt.Print(clearLine + status)
+			statusShown, statusExpired = true, time.After(statusDuration)
+
+		case <-statusExpired:
+			fmt.Print(clearLine)
+			statusShown, statusExpired = false, nil
+
 		case <-c.ticker.C:
 			err = protocol.EncodeClientRequest(c.conn, &protocol.KeepaliveRequest{})
 			if err != nil {
 				return fmt.Errorf("error sending request: %w", err)
 			}
 
+			if awayAfter > 0 && !idle && !c.presenceSet.Load() && time.Since(lastInput) >= awayAfter {
+				idle = true
+				err = protocol.EncodeClientRequest(c.conn, &protocol.SetPresenceRequest{
+					Presence: protocol.Away,
+					Message:  "idle",
+				})
+				if err != nil {
+					return fmt.Errorf("error sending request: %w", err)
+				}
+			}
+
 		case request := <-c.outgoing:
 			err = protocol.EncodeClientRequest(c.conn, request)
 			if err != nil {
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Config holds the client settings that persist between runs.
+type Config struct {
+	Servers   []ServerConfig    `json:"servers"`    // Known chat servers. The first one is used by default.
+	Name      string            `json:"name"`       // Default display name.
+	Keepalive int               `json:"keepalive"`  // How often to send a keepalive request in seconds.
+	AwayAfter int               `json:"away_after"` // Minutes without input before the user is marked away. Zero disables it.
+	Rooms     []string          `json:"rooms"`      // Rooms to join after connecting.
+	Aliases   map[string]string `json:"aliases"`    // Command aliases, e.g. "j": "join" makes "/j room" run "/join room".
+	Highlight []string          `json:"highlight"`  // Words that highlight a message when they appear in its text.
+	Ignored   []string          `json:"ignored"`    // Names of users whose messages are not displayed.
+
+	ReadReceipts bool `json:"read_receipts"` // Whether senders of direct messages are told when the user read them.
+
+	path string
+}
+
+// ServerConfig describes how to reach a chat server.
+type ServerConfig struct {
+	Name     string `json:"name"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Password string `json:"password"` // Password of the registered display name on this server, if any.
+}
+
+// Server returns the server with the given name, or the first server if the name is empty.
+func (c *Config) Server(name string) (ServerConfig, bool) {
+	for _, server := range c.Servers {
+		if name == "" || server.Name == name {
+			return server, true
+		}
+	}
+	return ServerConfig{}, false
+}
+
+// LoadConfig reads the config file at path.
+// A missing file results in an empty config that will be created on the first save.
+// An empty path results in a config that is never saved.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{
+		Servers:   []ServerConfig{},
+		Name:      "",
+		Keepalive: 15,
+		AwayAfter: 10,
+		Rooms:     []string{},
+		Aliases:   map[string]string{},
+		Highlight: []string{},
+		Ignored:   []string{},
+
+		ReadReceipts: true,
+
+		path: path,
+	}
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Save writes the config back to the file it was loaded from.
+func (c *Config) Save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	sort.Strings(c.Ignored)
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(c.path), 0o755)
+	if err != nil {
+		return fmt.Errorf("error creating config directory: %w", err)
+	}
+
+	// The config is written to a temporary file first so that a crash cannot truncate it.
+	// CreateTemp creates the file with 0o600 permissions because it holds passwords.
+	temp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating config: %w", err)
+	}
+
+	_, err = temp.Write(append(data, '\n'))
+	if err == nil {
+		err = temp.Close()
+	} else {
+		temp.Close()
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("error writing config: %w", err)
+	}
+
+	return nil
+}
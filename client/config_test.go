@@ -0,0 +1,141 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mnxn/chat/generic"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "client.json")
+	err := os.WriteFile(path, []byte(`{
+  "servers": [
+    {"name": "home", "host": "localhost", "port": 5555},
+    {"name": "work", "host": "chat.example.com", "port": 6000, "password": "hunter2"}
+  ],
+  "name": "alice",
+  "rooms": ["general", "random"],
+  "aliases": {"j": "join"}
+}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic.TestEqual(t, "LoadConfig", "name", "alice", config.Name)
+	generic.TestEqual(t, "LoadConfig", "rooms", []string{"general", "random"}, config.Rooms)
+	generic.TestEqual(t, "LoadConfig", "aliases", map[string]string{"j": "join"}, config.Aliases)
+	generic.TestEqual(t, "LoadConfig", "keepalive default", 15, config.Keepalive)
+	generic.TestEqual(t, "LoadConfig", "read receipts default", true, config.ReadReceipts)
+
+	missing, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic.TestEqual(t, "LoadConfig", "missing", 0, len(missing.Servers))
+
+	err = os.WriteFile(path, []byte(`{"servers": [`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadConfig(path)
+	generic.TestEqual(t, "LoadConfig", "invalid", true, err != nil)
+}
+
+func TestConfigServer(t *testing.T) {
+	t.Parallel()
+
+	home := ServerConfig{
+		Name:     "home",
+		Host:     "localhost",
+		Port:     5555,
+		Password: "",
+	}
+	work := ServerConfig{
+		Name:     "work",
+		Host:     "chat.example.com",
+		Port:     6000,
+		Password: "hunter2",
+	}
+	config, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ok := config.Server("")
+	generic.TestEqual(t, "Server", "no servers", false, ok)
+
+	config.Servers = []ServerConfig{home, work}
+	tests := []struct {
+		name     string
+		expected ServerConfig
+		ok       bool
+	}{
+		{name: "", expected: home, ok: true},
+		{name: "home", expected: home, ok: true},
+		{name: "work", expected: work, ok: true},
+		{name: "school", expected: ServerConfig{}, ok: false},
+	}
+	for _, test := range tests {
+		actual, ok := config.Server(test.name)
+		generic.TestEqual(t, "Server", test.name, test.expected, actual)
+		generic.TestEqual(t, "Server ok", test.name, test.ok, ok)
+	}
+}
+
+func TestConfigSave(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "chat")
+	path := filepath.Join(dir, "client.json")
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Name = "alice"
+	config.Ignored = []string{"mallory", "eve"}
+	config.Servers = []ServerConfig{{
+		Name:     "work",
+		Host:     "chat.example.com",
+		Port:     6000,
+		Password: "hunter2",
+	}}
+
+	err = config.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic.TestEqual(t, "Save", "permissions", os.FileMode(0o600), info.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic.TestEqual(t, "Save", "temporary files", 1, len(entries))
+
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic.TestEqual(t, "Save", "name", "alice", loaded.Name)
+	generic.TestEqual(t, "Save", "ignored", []string{"eve", "mallory"}, loaded.Ignored)
+	generic.TestEqual(t, "Save", "servers", config.Servers, loaded.Servers)
+
+	unsaved, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic.TestEqual(t, "Save", "no path", nil, unsaved.Save())
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"fmt"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/mnxn/chat/protocol"
@@ -10,7 +11,7 @@ import (
 
 func (c *Client) Error(response *protocol.ErrorResponse) {
 	if len(response.Info) > 0 {
-		c.output <- fmt.Sprintf("[server error] %s: %s\n", response.Error, response.Info)
+		c.output <- fmt.Sprintf("[server error] %s: %s\n", response.Error, protocol.StripControl(response.Info))
 	} else {
 		c.output <- fmt.Sprintf("[server error] %s\n", response.Error)
 	}
@@ -18,7 +19,7 @@ func (c *Client) Error(response *protocol.ErrorResponse) {
 
 func (c *Client) FatalError(response *protocol.FatalErrorResponse) {
 	if len(response.Info) > 0 {
-		c.output <- fmt.Sprintf("[fatal error] %s: %s\n", response.Error, response.Info)
+		c.output <- fmt.Sprintf("[fatal error] %s: %s\n", response.Error, protocol.StripControl(response.Info))
 	} else {
 		c.output <- fmt.Sprintf("[fatal error] %s\n", response.Error)
 	}
@@ -30,10 +31,10 @@ func (c *Client) RoomList(response *protocol.RoomListResponse) {
 	if response.User == "" {
 		fmt.Fprintln(&sb, "   Room Listing in Server:")
 	} else {
-		fmt.Fprintf(&sb, "   Room Listing for User %s:\n", response.User)
+		fmt.Fprintf(&sb, "   Room Listing for User %s:\n", protocol.StripControl(response.User))
 	}
 	for _, room := range response.Rooms {
-		fmt.Fprintf(&sb, "      %s\n", room)
+		fmt.Fprintf(&sb, "      %s%s\n", protocol.StripControl(room), c.unreadCount(room))
 	}
 	c.output <- sb.String()
 }
@@ -43,18 +44,693 @@ func (c *Client) UserList(response *protocol.UserListResponse) {
 	if response.Room == "" {
 		fmt.Fprintln(&sb, "   User Listing in Server:")
 	} else {
-		fmt.Fprintf(&sb, "   User Listing in Room %s:\n", response.Room)
+		fmt.Fprintf(&sb, "   User Listing in Room %s:\n", protocol.StripControl(response.Room))
 	}
 	for _, user := range response.Users {
-		fmt.Fprintf(&sb, "      %s\n", user)
+		fmt.Fprintf(&sb, "      %s\n", protocol.StripControl(user))
 	}
 	c.output <- sb.String()
 }
 
+func (c *Client) PresenceList(response *protocol.PresenceListResponse) {
+	var sb strings.Builder
+	if response.Room == "" {
+		fmt.Fprintln(&sb, "   User Listing in Server:")
+	} else {
+		fmt.Fprintf(&sb, "   User Listing in Room %s:\n", protocol.StripControl(response.Room))
+	}
+	for _, user := range response.Users {
+		fmt.Fprintf(&sb, "      %s%s\n",
+			protocol.StripControl(user.Name),
+			describePresence(user.Presence, user.Message),
+		)
+	}
+	c.output <- sb.String()
+}
+
+func (c *Client) RoomPage(response *protocol.RoomPageResponse) {
+	var sb strings.Builder
+	if response.User == "" {
+		fmt.Fprintln(&sb, "   Room Listing in Server:")
+	} else {
+		fmt.Fprintf(&sb, "   Room Listing for User %s:\n", protocol.StripControl(response.User))
+	}
+	for _, room := range response.Rooms {
+		topic := ""
+		if room.Topic != "" {
+			topic = " - " + protocol.StripControl(room.Topic)
+		}
+		fmt.Fprintf(&sb, "      %s (%d online)%s%s\n",
+			protocol.StripControl(room.Name),
+			room.Members,
+			c.unreadCount(room.Name),
+			topic,
+		)
+	}
+
+	more := c.setNextPage(response.Next != "", func(last protocol.ClientRequest) protocol.ClientRequest {
+		request, ok := last.(*protocol.ListRoomsPageRequest)
+		if !ok || request.User != response.User {
+			return nil
+		}
+		next := *request
+		next.Cursor = response.Next
+		return &next
+	})
+	if more {
+		fmt.Fprintln(&sb, "      use /more to see more rooms")
+	}
+	c.output <- sb.String()
+}
+
+func (c *Client) UserPage(response *protocol.UserPageResponse) {
+	var sb strings.Builder
+	if response.Room == "" {
+		fmt.Fprintln(&sb, "   User Listing in Server:")
+	} else {
+		fmt.Fprintf(&sb, "   User Listing in Room %s:\n", protocol.StripControl(response.Room))
+	}
+	for _, user := range response.Users {
+		fmt.Fprintf(&sb, "      %s%s\n",
+			protocol.StripControl(user.Name),
+			describePresence(user.Presence, user.Message),
+		)
+	}
+
+	more := c.setNextPage(response.Next != "", func(last protocol.ClientRequest) protocol.ClientRequest {
+		request, ok := last.(*protocol.ListUsersPageRequest)
+		if !ok || request.Room != response.Room {
+			return nil
+		}
+		next := *request
+		next.Cursor = response.Next
+		return &next
+	})
+	if more {
+		fmt.Fprintln(&sb, "      use /more to see more users")
+	}
+	c.output <- sb.String()
+}
+
+func (c *Client) RoomEntryList(response *protocol.RoomEntryListResponse) {
+	var sb strings.Builder
+	if response.User == "" {
+		fmt.Fprintln(&sb, "   Room Listing in Server:")
+	} else {
+		fmt.Fprintf(&sb, "   Room Listing for User %s:\n", protocol.StripControl(response.User))
+	}
+
+	table := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "      ROOM\tUSERS\tUNREAD\tFLAGS\tTOPIC")
+	for _, room := range response.Rooms {
+		unread := ""
+		if count := c.unreadMessages(room.Name); count > 0 {
+			unread = fmt.Sprint(count)
+		}
+		fmt.Fprintf(table, "      %s\t%d\t%s\t%s\t%s\n",
+			protocol.StripControl(room.Name),
+			room.Members,
+			unread,
+			describeFlags(room.Flags),
+			protocol.StripControl(room.Topic),
+		)
+	}
+	table.Flush()
+
+	more := c.setNextPage(response.Next != "", func(last protocol.ClientRequest) protocol.ClientRequest {
+		request, ok := last.(*protocol.ListRoomsPageRequest)
+		if !ok || request.User != response.User {
+			return nil
+		}
+		next := *request
+		next.Cursor = response.Next
+		return &next
+	})
+	if more {
+		fmt.Fprintln(&sb, "      use /more to see more rooms")
+	}
+	c.output <- sb.String()
+}
+
+func (c *Client) UserEntryList(response *protocol.UserEntryListResponse) {
+	var sb strings.Builder
+	if response.Room == "" {
+		fmt.Fprintln(&sb, "   User Listing in Server:")
+	} else {
+		fmt.Fprintf(&sb, "   User Listing in Room %s:\n", protocol.StripControl(response.Room))
+	}
+
+	table := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "      USER\tSTATUS\tIDLE")
+	for _, user := range response.Users {
+		fmt.Fprintf(table, "      %s\t%s\t%s\n",
+			protocol.StripControl(user.Name),
+			describeStatus(user.Presence, user.Message),
+			describeIdle(user.Idle),
+		)
+	}
+	table.Flush()
+
+	more := c.setNextPage(response.Next != "", func(last protocol.ClientRequest) protocol.ClientRequest {
+		request, ok := last.(*protocol.ListUsersPageRequest)
+		if !ok || request.Room != response.Room {
+			return nil
+		}
+		next := *request
+		next.Cursor = response.Next
+		return &next
+	})
+	if more {
+		fmt.Fprintln(&sb, "      use /more to see more users")
+	}
+	c.output <- sb.String()
+}
+
+func (c *Client) PresenceChange(response *protocol.PresenceChangeResponse) {
+	if c.ignoring(response.User) {
+		return
+	}
+	status := describePresence(response.Presence, response.Message)
+	if status == "" {
+		status = " (online)"
+	}
+	c.output <- fmt.Sprintf("[presence] %s%s\n", protocol.StripControl(response.User), status)
+}
+
+func (c *Client) AutoReply(response *protocol.AutoReplyResponse) {
+	c.output <- fmt.Sprintf("[auto-reply] %s%s\n",
+		protocol.StripControl(response.User),
+		describePresence(response.Presence, response.Message),
+	)
+}
+
+func (c *Client) UserTyping(response *protocol.UserTypingResponse) {
+	if c.ignoring(response.User) {
+		return
+	}
+
+	if response.Room == "" {
+		c.status <- fmt.Sprintf("[typing] %s is typing\u2026", protocol.StripControl(response.User))
+	} else {
+		c.status <- fmt.Sprintf("[typing] %s is typing in %s\u2026",
+			protocol.StripControl(response.User),
+			protocol.StripControl(response.Room),
+		)
+	}
+}
+
+func (c *Client) NameChanged(response *protocol.NameChangedResponse) {
+	if response.OldName == c.name() {
+		newName := response.NewName
+		c.atomicName.Store(&newName)
+		c.output <- fmt.Sprintf("[nick] you are now known as %s\n", protocol.StripControl(newName))
+		return
+	}
+
+	// Ignored users stay ignored under their new name.
+	if c.ignoring(response.OldName) {
+		err := c.unignore([]string{response.OldName})
+		if err == nil {
+			err = c.ignore([]string{response.NewName})
+		}
+		if err != nil {
+			c.output <- fmt.Sprintf("[config error] %s\n", err)
+		}
+		return
+	}
+
+	c.output <- fmt.Sprintf("[nick] %s is now known as %s\n",
+		protocol.StripControl(response.OldName),
+		protocol.StripControl(response.NewName),
+	)
+}
+
+// describePresence returns a suffix for a user name that shows the user's presence and status message.
+func describePresence(presence protocol.Presence, message string) string {
+	if presence == protocol.Online && message == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", describeStatus(presence, message))
+}
+
+// describeStatus returns the presence of a user followed by its status message, if it has one.
+func describeStatus(presence protocol.Presence, message string) string {
+	var label string
+	switch presence {
+	case protocol.Online:
+		label = "online"
+	case protocol.Away:
+		label = "away"
+	case protocol.DoNotDisturb:
+		label = "do not disturb"
+	}
+
+	if message == "" {
+		return label
+	}
+	return fmt.Sprintf("%s: %s", label, protocol.StripControl(message))
+}
+
+// describeFlags returns the flags of a room as a comma separated list of short words.
+func describeFlags(flags protocol.RoomFlags) string {
+	var words []string
+	if flags.Has(protocol.RoomJoined) {
+		words = append(words, "joined")
+	}
+	if flags.Has(protocol.RoomOperator) {
+		words = append(words, "operator")
+	}
+	if flags.Has(protocol.RoomPermanent) {
+		words = append(words, "permanent")
+	}
+	if flags.Has(protocol.RoomOutsidePosts) {
+		words = append(words, "open")
+	}
+	return strings.Join(words, ",")
+}
+
+// describeIdle returns the idle time of a user rounded to minutes, or an empty string if it is under a minute.
+func describeIdle(seconds uint32) string {
+	idle := time.Duration(seconds) * time.Second
+	switch {
+	case idle < time.Minute:
+		return ""
+	case idle < time.Hour:
+		return fmt.Sprintf("%dm", idle/time.Minute)
+	default:
+		return fmt.Sprintf("%dh%02dm", idle/time.Hour, idle%time.Hour/time.Minute)
+	}
+}
+
 func (c *Client) RoomMessage(response *protocol.RoomMessageResponse) {
-	c.output <- fmt.Sprintf("<%s@%s> %s\n", response.Sender, response.Room, response.Text)
+	if c.ignoring(response.Sender) {
+		return
+	}
+	text := protocol.StripControl(response.Text)
+	highlight := ""
+	if response.Sender != c.name() {
+		highlight = c.highlight(text)
+	}
+	c.output <- fmt.Sprintf("%s<%s@%s> %s\n",
+		highlight,
+		protocol.StripControl(response.Sender),
+		protocol.StripControl(response.Room),
+		text,
+	)
 }
 
 func (c *Client) UserMessage(response *protocol.UserMessageResponse) {
-	c.output <- fmt.Sprintf("(%s) %s\n", response.Sender, response.Text)
+	if c.ignoring(response.Sender) {
+		return
+	}
+	text := protocol.StripControl(response.Text)
+	c.output <- fmt.Sprintf("%s(%s) %s\n", c.highlight(text), protocol.StripControl(response.Sender), text)
+}
+
+func (c *Client) UserMessageEcho(response *protocol.UserMessageEchoResponse) {
+	c.output <- fmt.Sprintf("(%s -> %s) %s\n",
+		c.name(),
+		protocol.StripControl(response.Recipient),
+		protocol.StripControl(response.Text),
+	)
+}
+
+func (c *Client) ChatMessage(response *protocol.ChatMessageResponse) {
+	if c.ignoring(response.Sender) {
+		return
+	}
+	if response.Room != "" {
+		c.seen(response.Room, response.ID, response.Sender == c.name())
+	} else if response.Sender != c.name() {
+		c.readLater(response.ID)
+	}
+	c.output <- c.formatMessage(response)
+	c.remember(response.ID, response.Sender, response.Text)
+}
+
+// formatMessage formats a chat message like RoomMessage, UserMessage and UserMessageEcho
+// with its ID and the chat message that it replies to.
+func (c *Client) formatMessage(response *protocol.ChatMessageResponse) string {
+	text := protocol.StripControl(response.Text)
+	highlight := ""
+	if response.Sender != c.name() {
+		highlight = c.highlight(text)
+	}
+
+	var parent string
+	if response.ReplyTo != 0 {
+		parent = c.quote(response.ReplyTo)
+	}
+
+	switch {
+	case response.Room != "":
+		return fmt.Sprintf("%s%s#%d <%s@%s> %s\n",
+			parent,
+			highlight,
+			response.ID,
+			protocol.StripControl(response.Sender),
+			protocol.StripControl(response.Room),
+			text,
+		)
+	case response.Sender == c.name():
+		sent := ""
+		if c.has(protocol.Receipts) {
+			sent = " \u2713"
+		}
+		return fmt.Sprintf("%s#%d (%s -> %s) %s%s\n",
+			parent,
+			response.ID,
+			c.name(),
+			protocol.StripControl(response.Recipient),
+			text,
+			sent,
+		)
+	default:
+		return fmt.Sprintf("%s%s#%d (%s) %s\n",
+			parent,
+			highlight,
+			response.ID,
+			protocol.StripControl(response.Sender),
+			text,
+		)
+	}
+}
+
+func (c *Client) MessageEdited(response *protocol.MessageEditedResponse) {
+	if c.ignoring(response.Sender) {
+		return
+	}
+	c.edit(response.ID, response.Text)
+	c.output <- fmt.Sprintf("[edited] #%d <%s> %s\n",
+		response.ID,
+		protocol.StripControl(response.Sender),
+		protocol.StripControl(response.Text),
+	)
+}
+
+func (c *Client) MessageDeleted(response *protocol.MessageDeletedResponse) {
+	c.edit(response.ID, "(deleted)")
+	c.output <- fmt.Sprintf("[deleted] #%d by %s\n", response.ID, protocol.StripControl(response.User))
+}
+
+func (c *Client) ReactionList(response *protocol.ReactionListResponse) {
+	if c.ignoring(response.User) {
+		return
+	}
+
+	reactions := make([]string, len(response.Reactions))
+	for i, reaction := range response.Reactions {
+		reactions[i] = fmt.Sprintf("%s %d", protocol.StripControl(reaction.Reaction), reaction.Count)
+	}
+	if len(reactions) == 0 {
+		reactions = append(reactions, "no reactions")
+	}
+
+	c.output <- fmt.Sprintf("   #%d %s (%s)\n",
+		response.ID,
+		strings.Join(reactions, "  "),
+		protocol.StripControl(response.User),
+	)
+}
+
+func (c *Client) ReadMarker(response *protocol.ReadMarkerResponse) {
+	c.unreadMutex.Lock()
+	changed := c.unread[response.Room] != response.Unread
+	c.readMarkers[response.Room] = response.ID
+	c.unread[response.Room] = response.Unread
+	if response.ID > c.lastMessages[response.Room] {
+		c.lastMessages[response.Room] = response.ID
+	}
+	c.unreadMutex.Unlock()
+
+	if changed && response.Unread > 0 {
+		c.output <- fmt.Sprintf("[unread] %d unread messages in %s\n", response.Unread, protocol.StripControl(response.Room))
+	}
+}
+
+func (c *Client) Thread(response *protocol.ThreadResponse) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "   Thread #%d:\n", response.Root)
+
+	// Replies are indented below the chat message that they reply to.
+	depths := make(map[protocol.MessageID]int, len(response.Messages))
+	for i := range response.Messages {
+		message := &response.Messages[i]
+		depth := 0
+		if parent, ok := depths[message.ReplyTo]; ok && message.ID != response.Root {
+			depth = parent + 1
+		}
+		depths[message.ID] = depth
+
+		if c.ignoring(message.Sender) {
+			continue
+		}
+		c.remember(message.ID, message.Sender, message.Text)
+		fmt.Fprintf(&sb, "      %s#%d <%s> %s\n",
+			strings.Repeat("  ", depth),
+			message.ID,
+			protocol.StripControl(message.Sender),
+			protocol.StripControl(message.Text),
+		)
+	}
+	c.output <- sb.String()
+}
+
+func (c *Client) SearchResults(response *protocol.SearchResultsResponse) {
+	var sb strings.Builder
+	if response.Query == "" {
+		fmt.Fprintln(&sb, "   Search Results:")
+	} else {
+		fmt.Fprintf(&sb, "   Search Results for %q:\n", protocol.StripControl(response.Query))
+	}
+	if len(response.Messages) == 0 {
+		fmt.Fprintln(&sb, "      no matching messages")
+	}
+
+	for i := range response.Messages {
+		message := &response.Messages[i]
+		if c.ignoring(message.Sender) {
+			continue
+		}
+		c.remember(message.ID, message.Sender, message.Text)
+		if message.ReplyTo != 0 {
+			sb.WriteString("   " + c.quote(message.ReplyTo))
+		}
+		fmt.Fprintf(&sb, "      %s #%d <%s@%s> %s\n",
+			message.Time.Local().Format("2006-01-02 15:04"),
+			message.ID,
+			protocol.StripControl(message.Sender),
+			protocol.StripControl(message.Room),
+			protocol.StripControl(message.Text),
+		)
+	}
+
+	more := c.setNextPage(response.Next != 0, func(last protocol.ClientRequest) protocol.ClientRequest {
+		request, ok := last.(*protocol.SearchMessagesRequest)
+		if !ok || request.Query != response.Query {
+			return nil
+		}
+		next := *request
+		next.Cursor = response.Next
+		return &next
+	})
+	if more {
+		fmt.Fprintln(&sb, "      use /more to see older results")
+	}
+	c.output <- sb.String()
+}
+
+func (c *Client) Receipt(response *protocol.ReceiptResponse) {
+	if response.Read {
+		c.output <- fmt.Sprintf("[receipt] #%d read by %s\n", response.ID, protocol.StripControl(response.User))
+	} else {
+		c.output <- fmt.Sprintf("[receipt] #%d \u2713\u2713 delivered to %s\n", response.ID, protocol.StripControl(response.User))
+	}
+}
+
+func (c *Client) OfflineMessage(response *protocol.OfflineMessageResponse) {
+	if c.ignoring(response.Sender) {
+		return
+	}
+	text := protocol.StripControl(response.Text)
+	c.output <- fmt.Sprintf("%s[%s] (%s) %s\n",
+		c.highlight(text),
+		response.Time.Local().Format("2006-01-02 15:04"),
+		protocol.StripControl(response.Sender),
+		text,
+	)
+}
+
+func (c *Client) MessageQueued(response *protocol.MessageQueuedResponse) {
+	c.output <- fmt.Sprintf("[queued] %s is offline and will receive the message after logging in\n",
+		protocol.StripControl(response.Recipient),
+	)
+}
+
+func (c *Client) BlockList(response *protocol.BlockListResponse) {
+	var sb strings.Builder
+	fmt.Fprintln(&sb, "   Blocked Users:")
+	if response.Strangers {
+		fmt.Fprintln(&sb, "      (all non-contacts)")
+	}
+	for _, user := range response.Users {
+		fmt.Fprintf(&sb, "      %s\n", protocol.StripControl(user))
+	}
+	c.output <- sb.String()
+}
+
+func (c *Client) SubscriptionList(response *protocol.SubscriptionListResponse) {
+	var sb strings.Builder
+	fmt.Fprintln(&sb, "   Subscriptions:")
+	if len(response.Patterns) == 0 {
+		fmt.Fprintln(&sb, "      none")
+	}
+	for _, pattern := range response.Patterns {
+		fmt.Fprintf(&sb, "      %s\n", protocol.StripControl(pattern))
+	}
+	c.output <- sb.String()
+}
+
+func (c *Client) MOTD(response *protocol.MOTDResponse) {
+	var sb strings.Builder
+	fmt.Fprintln(&sb, "   Message of the Day:")
+	if response.Text == "" {
+		fmt.Fprintln(&sb, "      none")
+	}
+	for _, line := range strings.Split(strings.TrimRight(response.Text, "\n"), "\n") {
+		if line != "" {
+			fmt.Fprintf(&sb, "      %s\n", protocol.StripControl(line))
+		}
+	}
+	c.output <- sb.String()
+}
+
+func (c *Client) ServerInfo(response *protocol.ServerInfoResponse) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "   Server %s:\n", protocol.StripControl(response.Name))
+
+	table := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "      version\t%s\n", protocol.StripControl(response.Version))
+	fmt.Fprintf(table, "      uptime\t%s\n", describeUptime(response.Uptime))
+	fmt.Fprintf(table, "      protocol\tversions %d to %d\n", response.MinVersion, response.MaxVersion)
+	fmt.Fprintf(table, "      users\t%d of %s\n", response.Users, describeLimit(response.MaxUsers))
+	fmt.Fprintf(table, "      rooms\t%d of %s\n", response.Rooms, describeLimit(response.MaxRooms))
+	fmt.Fprintf(table, "      message length\t%s characters\n", describeLimit(response.MaxText))
+	if response.MaxQueued == 0 {
+		fmt.Fprintln(table, "      offline messages\tnot queued")
+	} else {
+		fmt.Fprintf(table, "      offline messages\t%d queued per user\n", response.MaxQueued)
+	}
+	table.Flush()
+	c.output <- sb.String()
+}
+
+// describeLimit returns a server limit, where zero means unlimited.
+func describeLimit(limit uint32) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(limit)
+}
+
+// describeUptime returns the uptime of the server rounded to minutes.
+func describeUptime(seconds uint32) string {
+	uptime := time.Duration(seconds) * time.Second
+	if uptime < time.Minute {
+		return "under a minute"
+	}
+	days := uptime / (24 * time.Hour)
+	uptime %= 24 * time.Hour
+	if days > 0 {
+		return fmt.Sprintf("%dd%02dh%02dm", days, uptime/time.Hour, uptime%time.Hour/time.Minute)
+	}
+	return fmt.Sprintf("%dh%02dm", uptime/time.Hour, uptime%time.Hour/time.Minute)
+}
+
+func (c *Client) Announcement(response *protocol.AnnouncementResponse) {
+	target := ""
+	if response.Room != "" {
+		target = "@" + protocol.StripControl(response.Room)
+	}
+	c.output <- fmt.Sprintf("[announcement%s] <%s> %s\n",
+		target,
+		protocol.StripControl(response.Sender),
+		protocol.StripControl(response.Text),
+	)
+}
+
+func (c *Client) Scheduled(response *protocol.ScheduledResponse) {
+	c.output <- fmt.Sprintf("[scheduled] %d for %s\n", response.ID, response.At.Local().Format("2006-01-02 15:04"))
+}
+
+func (c *Client) ScheduledList(response *protocol.ScheduledListResponse) {
+	var sb strings.Builder
+	fmt.Fprintln(&sb, "   Scheduled:")
+	if len(response.Items) == 0 {
+		fmt.Fprintln(&sb, "      none")
+	}
+
+	table := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	for _, item := range response.Items {
+		rooms := make([]string, len(item.Rooms))
+		for i, room := range item.Rooms {
+			rooms[i] = "@" + protocol.StripControl(room)
+		}
+		target := strings.Join(rooms, ",")
+		if item.Announcement {
+			target = "announcement " + target
+			if len(rooms) == 0 {
+				target += "to every user"
+			}
+		}
+		fmt.Fprintf(table, "      %d	%s	%s	%s\n",
+			item.ID,
+			item.At.Local().Format("2006-01-02 15:04"),
+			target,
+			protocol.StripControl(item.Text),
+		)
+	}
+	table.Flush()
+	c.output <- sb.String()
+}
+
+func (c *Client) RoomDetails(response *protocol.RoomDetailsResponse) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "   Room %s:\n", protocol.StripControl(response.Name))
+
+	table := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "      users\t%d\n", response.Members)
+	if response.Topic != "" {
+		fmt.Fprintf(table, "      topic\t%s\n", protocol.StripControl(response.Topic))
+	}
+	if flags := describeFlags(response.Flags); flags != "" {
+		fmt.Fprintf(table, "      flags\t%s\n", flags)
+	}
+	fmt.Fprintf(table, "      retention\t%s\n", describeRetention(response.Retention))
+	if response.Effective != response.Retention {
+		fmt.Fprintf(table, "      enforced retention\t%s\n", describeRetention(response.Effective))
+	}
+	table.Flush()
+	c.output <- sb.String()
+}
+
+// highlight returns a marker for text that contains one of the configured highlight words.
+func (c *Client) highlight(text string) string {
+	text = strings.ToLower(text)
+
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+
+	for _, word := range c.config.Highlight {
+		if word != "" && strings.Contains(text, strings.ToLower(word)) {
+			return "[!] "
+		}
+	}
+	return ""
+}
+
+// Capabilities only needs to remember the capabilities: outgoing messages are displayed when the server echoes them,
+// so they are simply not displayed by servers that do not support EchoMessages.
+func (c *Client) Capabilities(response *protocol.CapabilitiesResponse) {
+	c.capabilities.Store(uint32(response.Capabilities))
 }
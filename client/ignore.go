@@ -0,0 +1,62 @@
+package client
+
+func (c *Client) ignoring(user string) bool {
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+
+	for _, ignored := range c.config.Ignored {
+		if ignored == user {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) ignore(users []string) error {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+
+	for _, user := range users {
+		found := false
+		for _, ignored := range c.config.Ignored {
+			if ignored == user {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.config.Ignored = append(c.config.Ignored, user)
+		}
+	}
+
+	return c.config.Save()
+}
+
+func (c *Client) unignore(users []string) error {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+
+	remaining := c.config.Ignored[:0]
+	for _, ignored := range c.config.Ignored {
+		keep := true
+		for _, user := range users {
+			if ignored == user {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			remaining = append(remaining, ignored)
+		}
+	}
+	c.config.Ignored = remaining
+
+	return c.config.Save()
+}
+
+func (c *Client) ignoredUsers() []string {
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+
+	return append([]string(nil), c.config.Ignored...)
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+// paged sends a request for the first page of a search or listing
+// and remembers it so that /more can request the next page.
+func (c *Client) paged(request protocol.ClientRequest) {
+	c.pageMutex.Lock()
+	c.lastPaged = request
+	c.nextPage = nil
+	c.pageMutex.Unlock()
+
+	c.outgoing <- request
+}
+
+// setNextPage remembers the request for the next page of the last search or listing.
+// next builds it from the last request, and returns nil if the response does not belong to the last request.
+// It reports whether there is a next page.
+func (c *Client) setNextPage(more bool, next func(last protocol.ClientRequest) protocol.ClientRequest) bool {
+	c.pageMutex.Lock()
+	defer c.pageMutex.Unlock()
+
+	c.nextPage = nil
+	if more && c.lastPaged != nil {
+		c.nextPage = next(c.lastPaged)
+	}
+	return c.nextPage != nil
+}
+
+// more requests the next page of the last search or listing.
+func (c *Client) more() {
+	c.pageMutex.Lock()
+	request := c.nextPage
+	c.nextPage = nil
+	if request != nil {
+		c.lastPaged = request
+	}
+	c.pageMutex.Unlock()
+
+	if request == nil {
+		c.output <- "[command error] no more results\n"
+		return
+	}
+	c.outgoing <- request
+}
+
+// parseListArgs splits the arguments of /rooms, /joined and /users into the target of the listing,
+// a filter given as match:pattern, and an order given as sort:name or sort:size.
+func parseListArgs(args []string) (string, string, protocol.ListOrder, error) {
+	var target, filter string
+	order := protocol.OrderByName
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "match:"):
+			filter = strings.TrimPrefix(arg, "match:")
+		case arg == "sort:name":
+			order = protocol.OrderByName
+		case arg == "sort:size":
+			order = protocol.OrderBySize
+		case strings.HasPrefix(arg, "sort:"):
+			return "", "", 0, fmt.Errorf("unknown order %s: use sort:name or sort:size", arg)
+		case target == "":
+			target = arg
+		default:
+			return "", "", 0, fmt.Errorf("unexpected argument %s", arg)
+		}
+	}
+	return target, filter, order, nil
+}
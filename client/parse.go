@@ -1,7 +1,10 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,23 +15,80 @@ const helpMessage = `   command help:
       /help              show this message
       /current           show current room
       /switch [room]     switch current room
-      /rooms             list rooms in the server
+      /rooms             list rooms in the server with unread message counts
       /rooms  [user]     list rooms joined by a user
       /joined            list rooms joined by self
       /users             list users in the server
       /users  [room]     list users in a room
+                         room and user lists accept match:[prefix or pattern]
+                         and sort:name or sort:size
       /msg    [rooms]    send a message to specific rooms
       /dm     [users]    send a direct message to specific users
       /create [rooms]    create rooms
       /join   [rooms]    join rooms
       /leave  [rooms]    leave rooms
+      /set    [room] outside-posts [on|off]
+                         allow users outside a room to post to it
+      /set    [room] lifetime [default|ephemeral|permanent]
+                         keep a room when it is empty, or remove it after its grace period
+      /set    [room] grace [duration]
+                         keep an empty ephemeral room for a duration like 10m, or 0 for the server default
+      /topic  [room] [topic]
+                         change the topic of a room, or remove it if empty
+      /info   [room]     show the details of a room
+      /retention [room] [limits]
+                         limit the history of a room with age:[30d] messages:[count]
+                         and bytes:[count], or remove its limits if empty
+      /subscribe   [pattern]
+                         receive messages of matching rooms without joining them
+      /unsubscribe [pattern]
+                         stop receiving messages of matching rooms, or of all rooms if empty
+      /ignore   [users]  hide messages from users
+      /unignore [users]  show messages from users again
+      /ignored           list ignored users
+      /block             block direct messages from non-contacts
+      /block   [users]   block direct messages from users
+      /unblock           stop blocking non-contacts
+      /unblock [users]   stop blocking users
+      /blocks            list blocked users
+      /nick   [name]     change own name
+      /edit   [id] [text]
+                         replace the text of an own message
+      /delete [id]       delete an own message or a message in an operated room
+      /reply  [id] [text]
+                         reply to a message in its room or to its sender
+      /thread [id]       show a message and its replies
+      /schedule [room] [time] [text]
+                         send a message later, at a time like 15:04 or after a duration like 10m
+      /announce [text]   announce to every user, if the server lets you administer it
+                         rooms:[rooms] announces to rooms and at:[time] schedules the announcement
+      /scheduled         list own scheduled messages and announcements
+      /unschedule [id]   cancel a scheduled message or announcement
+      /find [words]      search messages in joined rooms, filtered by
+                         in:[room] from:[user] after:[date] before:[date]
+      /more              show more results of the last search or list
+      /react   [id] [emoji]
+                         react to a message
+      /unreact [id] [emoji]
+                         remove a reaction from a message
+      /away [message]    mark self as away
+      /dnd  [message]    mark self as do not disturb
+      /back              mark self as online again
+      /motd              show the server's message of the day
+      /serverinfo        show the server's version, uptime and limits
+      /register [password]
+                         register the current name so that it can log in from several clients
       /quit              quit the chat program
 `
 
 func (c *Client) parse(input string) {
+	c.sendReceipts()
+
 	if !strings.HasPrefix(input, "/") {
 		current := *c.atomicCurrent.Load()
 
+		// Replying in a room means that the user has read it.
+		c.markRead(current)
 		c.outgoing <- &protocol.MessageRoomRequest{
 			Room: current,
 			Text: input,
@@ -36,7 +96,7 @@ func (c *Client) parse(input string) {
 		return
 	}
 
-	split := strings.SplitN(input[1:], " ", 3)
+	split := strings.SplitN(c.expandAlias(input[1:]), " ", 3)
 	if len(split) < 1 {
 		c.output <- "[command error] invalid command: use /help to see all commands\n"
 		return
@@ -58,29 +118,39 @@ func (c *Client) parse(input string) {
 			return
 		}
 		c.atomicCurrent.Store(&split[1])
+		c.markRead(split[1])
 
-	case "rooms":
-		var user string
-		if len(split) >= 2 {
-			user = split[1]
-		}
-		c.outgoing <- &protocol.ListRoomsRequest{
-			User: user,
+	case "rooms", "joined":
+		args := strings.Fields(strings.Join(split[1:], " "))
+		if split[0] == "joined" {
+			args = append([]string{c.name()}, args...)
 		}
-
-	case "joined":
-		c.outgoing <- &protocol.ListRoomsRequest{
-			User: c.name,
+		user, filter, order, err := parseListArgs(args)
+		if err != nil {
+			c.output <- fmt.Sprintf("[command error] %s\n", err)
+			return
 		}
+		c.paged(&protocol.ListRoomsPageRequest{
+			User:   user,
+			Filter: filter,
+			Order:  order,
+			Cursor: "",
+			Limit:  0,
+		})
 
 	case "users":
-		var room string
-		if len(split) >= 2 {
-			room = split[1]
-		}
-		c.outgoing <- &protocol.ListUsersRequest{
-			Room: room,
+		room, filter, order, err := parseListArgs(strings.Fields(strings.Join(split[1:], " ")))
+		if err != nil {
+			c.output <- fmt.Sprintf("[command error] %s\n", err)
+			return
 		}
+		c.paged(&protocol.ListUsersPageRequest{
+			Room:   room,
+			Filter: filter,
+			Order:  order,
+			Cursor: "",
+			Limit:  0,
+		})
 
 	case "msg":
 		if len(split) <= 2 {
@@ -141,8 +211,374 @@ func (c *Client) parse(input string) {
 			}
 		}
 
+	case "set":
+		if len(split) <= 2 {
+			c.output <- "[command error] missing command arguments: use /help to see usage\n"
+			return
+		}
+		option, value, _ := strings.Cut(split[2], " ")
+		request, err := parseRoomOption(split[1], option, value)
+		if err != nil {
+			c.output <- fmt.Sprintf("[command error] %s\n", err)
+			return
+		}
+		c.outgoing <- request
+
+	case "topic":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		c.outgoing <- &protocol.SetTopicRequest{
+			Room:  split[1],
+			Topic: strings.Join(split[2:], " "),
+		}
+
+	case "info":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		c.outgoing <- &protocol.DescribeRoomRequest{
+			Room: split[1],
+		}
+
+	case "retention":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		retention, err := parseRetention(strings.Fields(strings.Join(split[2:], " ")))
+		if err != nil {
+			c.output <- fmt.Sprintf("[command error] %s\n", err)
+			return
+		}
+		c.outgoing <- &protocol.SetRetentionRequest{
+			Room:      split[1],
+			Retention: retention,
+		}
+
+	case "subscribe":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		c.outgoing <- &protocol.SubscribeRequest{
+			Pattern: split[1],
+		}
+
+	case "unsubscribe":
+		c.outgoing <- &protocol.UnsubscribeRequest{
+			Pattern: strings.Join(split[1:], " "),
+		}
+
+	case "ignore":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		err := c.ignore(strings.Split(split[1], ","))
+		if err != nil {
+			c.output <- fmt.Sprintf("[config error] %s\n", err)
+		}
+
+	case "unignore":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		err := c.unignore(strings.Split(split[1], ","))
+		if err != nil {
+			c.output <- fmt.Sprintf("[config error] %s\n", err)
+		}
+
+	case "ignored":
+		var sb strings.Builder
+		fmt.Fprintln(&sb, "   Ignored Users:")
+		for _, user := range c.ignoredUsers() {
+			fmt.Fprintf(&sb, "      %s\n", user)
+		}
+		c.output <- sb.String()
+
+	case "block":
+		if len(split) < 2 {
+			c.outgoing <- &protocol.BlockRequest{
+				User: "",
+			}
+			return
+		}
+		for _, user := range strings.Split(split[1], ",") {
+			c.outgoing <- &protocol.BlockRequest{
+				User: user,
+			}
+		}
+
+	case "unblock":
+		if len(split) < 2 {
+			c.outgoing <- &protocol.UnblockRequest{
+				User: "",
+			}
+			return
+		}
+		for _, user := range strings.Split(split[1], ",") {
+			c.outgoing <- &protocol.UnblockRequest{
+				User: user,
+			}
+		}
+
+	case "blocks":
+		c.outgoing <- &protocol.ListBlocksRequest{}
+
+	case "nick":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		c.outgoing <- &protocol.ChangeNameRequest{
+			Name: split[1],
+		}
+
+	case "edit":
+		if len(split) <= 2 {
+			c.output <- "[command error] missing command arguments: use /help to see usage\n"
+			return
+		}
+		id, ok := c.parseMessageID(split[1])
+		if !ok {
+			return
+		}
+		c.outgoing <- &protocol.EditMessageRequest{
+			ID:   id,
+			Text: split[2],
+		}
+
+	case "delete":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		id, ok := c.parseMessageID(split[1])
+		if !ok {
+			return
+		}
+		c.outgoing <- &protocol.DeleteMessageRequest{
+			ID: id,
+		}
+
+	case "reply":
+		if len(split) <= 2 {
+			c.output <- "[command error] missing command arguments: use /help to see usage\n"
+			return
+		}
+		id, ok := c.parseMessageID(split[1])
+		if !ok {
+			return
+		}
+		c.outgoing <- &protocol.ReplyRequest{
+			ReplyTo: id,
+			Text:    split[2],
+		}
+
+	case "thread":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		id, ok := c.parseMessageID(split[1])
+		if !ok {
+			return
+		}
+		c.outgoing <- &protocol.ListThreadRequest{
+			Root: id,
+		}
+
+	case "schedule":
+		if len(split) <= 2 {
+			c.output <- "[command error] missing command arguments: use /help to see usage\n"
+			return
+		}
+		when, text, _ := strings.Cut(split[2], " ")
+		at, err := parseWhen(when, time.Now())
+		if err != nil {
+			c.output <- fmt.Sprintf("[command error] %s\n", err)
+			return
+		}
+		c.outgoing <- &protocol.ScheduleMessageRequest{
+			Room: split[1],
+			Text: text,
+			At:   at,
+		}
+
+	case "announce":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		request, err := parseAnnounce(strings.Join(split[1:], " "), time.Now())
+		if err != nil {
+			c.output <- fmt.Sprintf("[command error] %s\n", err)
+			return
+		}
+		c.outgoing <- request
+
+	case "scheduled":
+		c.outgoing <- &protocol.ListScheduledRequest{}
+
+	case "unschedule":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		id, err := strconv.ParseUint(split[1], 10, 32)
+		if err != nil {
+			c.output <- fmt.Sprintf("[command error] invalid scheduled ID %s\n", split[1])
+			return
+		}
+		c.outgoing <- &protocol.CancelScheduledRequest{
+			ID: uint32(id),
+		}
+
+	case "find":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		request, err := parseSearch(strings.Join(split[1:], " "))
+		if err != nil {
+			c.output <- fmt.Sprintf("[command error] %s\n", err)
+			return
+		}
+		c.paged(request)
+
+	case "more":
+		c.more()
+
+	case "react", "unreact":
+		if len(split) <= 2 {
+			c.output <- "[command error] missing command arguments: use /help to see usage\n"
+			return
+		}
+		id, ok := c.parseMessageID(split[1])
+		if !ok {
+			return
+		}
+		if split[0] == "react" {
+			c.outgoing <- &protocol.ReactRequest{
+				ID:       id,
+				Reaction: split[2],
+			}
+		} else {
+			c.outgoing <- &protocol.UnreactRequest{
+				ID:       id,
+				Reaction: split[2],
+			}
+		}
+
+	case "away", "dnd", "back":
+		presence := map[string]protocol.Presence{
+			"away": protocol.Away,
+			"dnd":  protocol.DoNotDisturb,
+			"back": protocol.Online,
+		}[split[0]]
+		c.presenceSet.Store(presence != protocol.Online)
+		c.outgoing <- &protocol.SetPresenceRequest{
+			Presence: presence,
+			Message:  strings.Join(split[1:], " "),
+		}
+
+	case "motd":
+		c.outgoing <- &protocol.GetMOTDRequest{}
+
+	case "serverinfo":
+		c.outgoing <- &protocol.GetServerInfoRequest{}
+
+	case "register":
+		if len(split) < 2 {
+			c.output <- "[command error] missing command argument: use /help to see usage\n"
+			return
+		}
+		c.outgoing <- &protocol.RegisterRequest{
+			Password: strings.Join(split[1:], " "),
+		}
+
 	case "quit":
 		c.outgoing <- &protocol.DisconnectRequest{}
 		_ = c.conn.SetReadDeadline(time.Now())
 	}
 }
+
+// parseMessageID parses a message ID as it is displayed before a message, with or without the leading #.
+func (c *Client) parseMessageID(arg string) (protocol.MessageID, bool) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(arg, "#"), 10, 64)
+	if err != nil || id == 0 {
+		c.output <- fmt.Sprintf("[command error] invalid message ID: %s\n", arg)
+		return 0, false
+	}
+	return protocol.MessageID(id), true
+}
+
+func (c *Client) expandAlias(command string) string {
+	name, rest, _ := strings.Cut(command, " ")
+
+	c.configMutex.RLock()
+	expansion, ok := c.config.Aliases[name]
+	c.configMutex.RUnlock()
+	if !ok {
+		return command
+	}
+
+	if rest == "" {
+		return expansion
+	}
+	return expansion + " " + rest
+}
+
+// parseRoomOption builds a request from the arguments of /set.
+func parseRoomOption(room, option, value string) (*protocol.SetRoomOptionRequest, error) {
+	request := &protocol.SetRoomOptionRequest{
+		Room:   room,
+		Option: 0,
+		Value:  0,
+	}
+
+	switch option {
+	case "outside-posts":
+		request.Option = protocol.AllowOutsidePosts
+		switch value {
+		case "on":
+			request.Value = 1
+		case "off":
+			request.Value = 0
+		default:
+			return nil, errors.New("option value must be on or off")
+		}
+
+	case "lifetime":
+		request.Option = protocol.Lifetime
+		switch value {
+		case "default":
+			request.Value = protocol.DefaultLifetime
+		case "ephemeral":
+			request.Value = protocol.EphemeralRoom
+		case "permanent":
+			request.Value = protocol.PermanentRoom
+		default:
+			return nil, errors.New("option value must be default, ephemeral or permanent")
+		}
+
+	case "grace":
+		request.Option = protocol.GracePeriod
+		if value != "0" {
+			grace, err := time.ParseDuration(value)
+			if err != nil || grace <= 0 || grace/time.Second > math.MaxUint32 {
+				return nil, errors.New("option value must be a duration like 10m, or 0")
+			}
+			request.Value = uint32(grace / time.Second)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown room option: %s", option)
+	}
+
+	return request, nil
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+// The number of chat messages that the client remembers for quoting them in replies.
+const rememberedMessages = 500
+
+// The number of characters of a chat message that are shown when it is quoted.
+const quoteLength = 60
+
+// A quote is a remembered chat message.
+type quote struct {
+	sender string
+	text   string
+}
+
+// remember stores a chat message so that replies to it can quote it, forgetting the oldest message if needed.
+func (c *Client) remember(id protocol.MessageID, sender, text string) {
+	c.messagesMutex.Lock()
+	defer c.messagesMutex.Unlock()
+
+	if _, ok := c.messages[id]; !ok {
+		c.messageOrder = append(c.messageOrder, id)
+	}
+	c.messages[id] = quote{
+		sender: sender,
+		text:   text,
+	}
+
+	if len(c.messageOrder) > rememberedMessages {
+		delete(c.messages, c.messageOrder[0])
+		c.messageOrder = c.messageOrder[1:]
+	}
+}
+
+// edit replaces the text of a remembered chat message.
+func (c *Client) edit(id protocol.MessageID, text string) {
+	c.messagesMutex.Lock()
+	defer c.messagesMutex.Unlock()
+
+	if q, ok := c.messages[id]; ok {
+		q.text = text
+		c.messages[id] = q
+	}
+}
+
+// quote returns a line that shows the chat message with the ID, or only the ID if it is not remembered.
+func (c *Client) quote(id protocol.MessageID) string {
+	c.messagesMutex.Lock()
+	q, ok := c.messages[id]
+	c.messagesMutex.Unlock()
+	if !ok {
+		return fmt.Sprintf("   > #%d\n", id)
+	}
+
+	text := []rune(protocol.StripControl(q.text))
+	if len(text) > quoteLength {
+		text = append(text[:quoteLength], '…')
+	}
+	return fmt.Sprintf("   > #%d <%s> %s\n", id, protocol.StripControl(q.sender), string(text))
+}
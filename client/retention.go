@@ -0,0 +1,95 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+// parseRetention builds a retention from the arguments of /retention.
+// Arguments of the form age:30d, messages:1000 and bytes:65536 set the limits, and missing limits are unlimited.
+func parseRetention(args []string) (protocol.Retention, error) {
+	retention := protocol.Retention{
+		MaxAge:      0,
+		MaxMessages: 0,
+		MaxBytes:    0,
+	}
+
+	for _, arg := range args {
+		limit, value, _ := strings.Cut(arg, ":")
+		var err error
+		switch limit {
+		case "age":
+			retention.MaxAge, err = parseAge(value)
+		case "messages":
+			retention.MaxMessages, err = parseCount(value)
+		case "bytes":
+			retention.MaxBytes, err = parseCount(value)
+		default:
+			return retention, fmt.Errorf("unknown limit %s: use age:, messages: or bytes:", arg)
+		}
+		if err != nil {
+			return retention, fmt.Errorf("invalid limit %s: %w", arg, err)
+		}
+	}
+
+	return retention, nil
+}
+
+// parseAge parses a number of days such as 30d, or a duration such as 12h, into seconds.
+func parseAge(value string) (uint32, error) {
+	var age time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		count, err := strconv.ParseUint(days, 10, 16)
+		if err != nil {
+			return 0, fmt.Errorf("expected a number of days: %w", err)
+		}
+		age = time.Duration(count) * 24 * time.Hour
+	} else {
+		var err error
+		age, err = time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("expected a duration like 30d or 12h: %w", err)
+		}
+	}
+
+	if age < 0 || age/time.Second > math.MaxUint32 {
+		return 0, fmt.Errorf("age is out of range")
+	}
+	return uint32(age / time.Second), nil
+}
+
+func parseCount(value string) (uint32, error) {
+	count, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number: %w", err)
+	}
+	return uint32(count), nil
+}
+
+// describeRetention returns the limits of a retention, or "unlimited".
+func describeRetention(retention protocol.Retention) string {
+	var limits []string
+	if retention.MaxAge > 0 {
+		age := time.Duration(retention.MaxAge) * time.Second
+		if age%(24*time.Hour) == 0 {
+			limits = append(limits, fmt.Sprintf("%d days", age/(24*time.Hour)))
+		} else {
+			limits = append(limits, age.String())
+		}
+	}
+	if retention.MaxMessages > 0 {
+		limits = append(limits, fmt.Sprintf("%d messages", retention.MaxMessages))
+	}
+	if retention.MaxBytes > 0 {
+		limits = append(limits, fmt.Sprintf("%d bytes", retention.MaxBytes))
+	}
+	if len(limits) == 0 {
+		return "unlimited"
+	}
+	return strings.Join(limits, ", ")
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+// parseWhen parses the time argument of /schedule and /announce.
+// It is either a duration from now such as 10m or 1h30m,
+// or a time of day such as 15:04 for the next time that the clock shows it.
+func parseWhen(when string, now time.Time) (time.Time, error) {
+	if delay, err := time.ParseDuration(when); err == nil && delay > 0 {
+		return now.Add(delay), nil
+	}
+
+	clock, err := time.ParseInLocation("15:04", when, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s: use a duration like 10m or a time like 15:04", when)
+	}
+	at := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, nil
+}
+
+// parseAnnounce builds an announce request from the arguments of /announce.
+// Leading arguments of the form rooms:a,b and at:time choose the rooms and the time of the announcement,
+// and the rest of the arguments are its text.
+func parseAnnounce(args string, now time.Time) (*protocol.AnnounceRequest, error) {
+	request := &protocol.AnnounceRequest{
+		Count: 0,
+		Rooms: []string{},
+		Text:  "",
+		At:    time.UnixMilli(0),
+	}
+
+	for {
+		arg, rest, _ := strings.Cut(args, " ")
+		option, value, _ := strings.Cut(arg, ":")
+		if value == "" || (option != "rooms" && option != "at") {
+			break
+		}
+
+		if option == "rooms" {
+			request.Rooms = strings.Split(value, ",")
+		} else {
+			at, err := parseWhen(value, now)
+			if err != nil {
+				return nil, err
+			}
+			request.At = at
+		}
+		args = rest
+	}
+
+	request.Text = args
+	return request, nil
+}
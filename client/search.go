@@ -0,0 +1,53 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+// parseSearch builds a search request from the arguments of /find.
+// Arguments of the form in:room, from:user, after:date and before:date are filters,
+// and the remaining arguments are the words to search for.
+func parseSearch(args string) (*protocol.SearchMessagesRequest, error) {
+	request := &protocol.SearchMessagesRequest{
+		Query:  "",
+		Room:   "",
+		Sender: "",
+		After:  time.UnixMilli(0),
+		Before: time.UnixMilli(0),
+		Cursor: 0,
+		Limit:  0,
+	}
+
+	var words []string
+	for _, arg := range strings.Fields(args) {
+		filter, value, ok := strings.Cut(arg, ":")
+		if !ok || value == "" {
+			words = append(words, arg)
+			continue
+		}
+
+		var err error
+		switch filter {
+		case "in":
+			request.Room = value
+		case "from":
+			request.Sender = value
+		case "after":
+			request.After, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		case "before":
+			request.Before, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		default:
+			words = append(words, arg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %s: use YYYY-MM-DD", value)
+		}
+	}
+
+	request.Query = strings.Join(words, " ")
+	return request, nil
+}
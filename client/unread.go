@@ -0,0 +1,80 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+// seen records a room message that the client displayed. Messages from the user are never unread.
+func (c *Client) seen(room string, id protocol.MessageID, own bool) {
+	c.unreadMutex.Lock()
+	defer c.unreadMutex.Unlock()
+
+	if id > c.lastMessages[room] {
+		c.lastMessages[room] = id
+	}
+	if !own {
+		c.unread[room]++
+	}
+}
+
+// markRead moves the read marker of a room to the last message that the client displayed in it.
+func (c *Client) markRead(room string) {
+	c.unreadMutex.Lock()
+	last := c.lastMessages[room]
+	unread := last > c.readMarkers[room]
+	c.unreadMutex.Unlock()
+
+	if unread {
+		c.outgoing <- &protocol.MarkReadRequest{
+			Room: room,
+			ID:   last,
+		}
+	}
+}
+
+// unreadCount returns a suffix for a room name that shows the number of unread messages in the room.
+func (c *Client) unreadCount(room string) string {
+	count := c.unreadMessages(room)
+	if count == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d unread)", count)
+}
+
+// unreadMessages returns the number of unread messages in a room.
+func (c *Client) unreadMessages(room string) uint32 {
+	c.unreadMutex.Lock()
+	defer c.unreadMutex.Unlock()
+
+	return c.unread[room]
+}
+
+// readLater queues a read receipt for a direct message if the user enabled read receipts.
+func (c *Client) readLater(id protocol.MessageID) {
+	c.configMutex.RLock()
+	enabled := c.config.ReadReceipts
+	c.configMutex.RUnlock()
+	if !enabled || !c.has(protocol.Receipts) {
+		return
+	}
+
+	c.unreadMutex.Lock()
+	c.receipts = append(c.receipts, id)
+	c.unreadMutex.Unlock()
+}
+
+// sendReceipts sends read receipts for the direct messages that were displayed before the user entered a line.
+func (c *Client) sendReceipts() {
+	c.unreadMutex.Lock()
+	receipts := c.receipts
+	c.receipts = nil
+	c.unreadMutex.Unlock()
+
+	for _, id := range receipts {
+		c.outgoing <- &protocol.ReadReceiptRequest{
+			ID: id,
+		}
+	}
+}
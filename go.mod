@@ -1,3 +1,7 @@
 module github.com/mnxn/chat
 
 go 1.20
+
+require golang.org/x/text v0.14.0
+
+require golang.org/x/crypto v0.17.0
@@ -4,9 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 )
 
-var ErrInvalidRequestType = errors.New("invalid RequestType value")
+var (
+	ErrInvalidRequestType = errors.New("invalid RequestType value")
+	ErrInvalidRoomOption  = errors.New("invalid RoomOption value")
+	ErrInvalidPresence    = errors.New("invalid Presence value")
+	ErrInvalidListOrder   = errors.New("invalid ListOrder value")
+)
 
 // ClientRequest messages originate in the clients before being received by the server and responded to.
 type ClientRequest interface {
@@ -59,6 +66,70 @@ func DecodeClientRequest(r io.Reader) (ClientRequest, error) {
 		request = new(JoinRoomRequest)
 	case LeaveRoom:
 		request = new(LeaveRoomRequest)
+	case Block:
+		request = new(BlockRequest)
+	case Unblock:
+		request = new(UnblockRequest)
+	case ListBlocks:
+		request = new(ListBlocksRequest)
+	case SetRoomOption:
+		request = new(SetRoomOptionRequest)
+	case Negotiate:
+		request = new(NegotiateRequest)
+	case Register:
+		request = new(RegisterRequest)
+	case Login:
+		request = new(LoginRequest)
+	case SetPresence:
+		request = new(SetPresenceRequest)
+	case Typing:
+		request = new(TypingRequest)
+	case ChangeName:
+		request = new(ChangeNameRequest)
+	case EditMessage:
+		request = new(EditMessageRequest)
+	case DeleteMessage:
+		request = new(DeleteMessageRequest)
+	case Reply:
+		request = new(ReplyRequest)
+	case ListThread:
+		request = new(ListThreadRequest)
+	case React:
+		request = new(ReactRequest)
+	case Unreact:
+		request = new(UnreactRequest)
+	case MarkRead:
+		request = new(MarkReadRequest)
+	case ReadReceipt:
+		request = new(ReadReceiptRequest)
+	case SearchMessages:
+		request = new(SearchMessagesRequest)
+	case SetTopic:
+		request = new(SetTopicRequest)
+	case ListRoomsPage:
+		request = new(ListRoomsPageRequest)
+	case ListUsersPage:
+		request = new(ListUsersPageRequest)
+	case Subscribe:
+		request = new(SubscribeRequest)
+	case Unsubscribe:
+		request = new(UnsubscribeRequest)
+	case GetMOTD:
+		request = new(GetMOTDRequest)
+	case GetServerInfo:
+		request = new(GetServerInfoRequest)
+	case Announce:
+		request = new(AnnounceRequest)
+	case ScheduleMessage:
+		request = new(ScheduleMessageRequest)
+	case SetRetention:
+		request = new(SetRetentionRequest)
+	case DescribeRoom:
+		request = new(DescribeRoomRequest)
+	case ListScheduled:
+		request = new(ListScheduledRequest)
+	case CancelScheduled:
+		request = new(CancelScheduledRequest)
 	}
 
 	err = request.decodeRequest(r)
@@ -82,6 +153,38 @@ const (
 	CreateRoom
 	JoinRoom
 	LeaveRoom
+	Block
+	Unblock
+	ListBlocks
+	SetRoomOption
+	Negotiate
+	Register
+	Login
+	SetPresence
+	Typing
+	ChangeName
+	EditMessage
+	DeleteMessage
+	Reply
+	ListThread
+	React
+	Unreact
+	MarkRead
+	ReadReceipt
+	SearchMessages
+	SetTopic
+	ListRoomsPage
+	ListUsersPage
+	Subscribe
+	Unsubscribe
+	GetMOTD
+	GetServerInfo
+	Announce
+	ScheduleMessage
+	SetRetention
+	DescribeRoom
+	ListScheduled
+	CancelScheduled
 )
 
 func (r RequestType) GoString() string {
@@ -106,6 +209,70 @@ func (r RequestType) GoString() string {
 		return "JoinRoom"
 	case LeaveRoom:
 		return "LeaveRoom"
+	case Block:
+		return "Block"
+	case Unblock:
+		return "Unblock"
+	case ListBlocks:
+		return "ListBlocks"
+	case SetRoomOption:
+		return "SetRoomOption"
+	case Negotiate:
+		return "Negotiate"
+	case Register:
+		return "Register"
+	case Login:
+		return "Login"
+	case SetPresence:
+		return "SetPresence"
+	case Typing:
+		return "Typing"
+	case ChangeName:
+		return "ChangeName"
+	case EditMessage:
+		return "EditMessage"
+	case DeleteMessage:
+		return "DeleteMessage"
+	case Reply:
+		return "Reply"
+	case ListThread:
+		return "ListThread"
+	case React:
+		return "React"
+	case Unreact:
+		return "Unreact"
+	case MarkRead:
+		return "MarkRead"
+	case ReadReceipt:
+		return "ReadReceipt"
+	case SearchMessages:
+		return "SearchMessages"
+	case SetTopic:
+		return "SetTopic"
+	case ListRoomsPage:
+		return "ListRoomsPage"
+	case ListUsersPage:
+		return "ListUsersPage"
+	case Subscribe:
+		return "Subscribe"
+	case Unsubscribe:
+		return "Unsubscribe"
+	case GetMOTD:
+		return "GetMOTD"
+	case GetServerInfo:
+		return "GetServerInfo"
+	case Announce:
+		return "Announce"
+	case ScheduleMessage:
+		return "ScheduleMessage"
+	case SetRetention:
+		return "SetRetention"
+	case DescribeRoom:
+		return "DescribeRoom"
+	case ListScheduled:
+		return "ListScheduled"
+	case CancelScheduled:
+		return "CancelScheduled"
 	default:
 		return fmt.Sprintf("RequestType(%d)", r)
 	}
@@ -119,7 +286,26 @@ func encodeRequestType(w io.Writer, typ RequestType) error {
 		Connect, Disconnect,
 		ListRooms, ListUsers,
 		MessageRoom, MessageUser,
-		CreateRoom, JoinRoom, LeaveRoom:
+		CreateRoom, JoinRoom, LeaveRoom,
+		Block, Unblock, ListBlocks,
+		SetRoomOption,
+		Negotiate,
+		Register, Login,
+		SetPresence,
+		Typing,
+		ChangeName,
+		EditMessage, DeleteMessage,
+		Reply, ListThread,
+		React, Unreact,
+		MarkRead,
+		ReadReceipt,
+		SearchMessages,
+		SetTopic, ListRoomsPage, ListUsersPage,
+		Subscribe, Unsubscribe,
+		GetMOTD, GetServerInfo,
+		Announce, ScheduleMessage,
+		SetRetention, DescribeRoom,
+		ListScheduled, CancelScheduled:
 		break
 	default:
 		return fmt.Errorf("encode RequestType(%d): %w", typ, ErrInvalidRequestType)
@@ -145,7 +331,26 @@ func decodeRequestType(r io.Reader, typ *RequestType) error {
 		Connect, Disconnect,
 		ListRooms, ListUsers,
 		MessageRoom, MessageUser,
-		CreateRoom, JoinRoom, LeaveRoom:
+		CreateRoom, JoinRoom, LeaveRoom,
+		Block, Unblock, ListBlocks,
+		SetRoomOption,
+		Negotiate,
+		Register, Login,
+		SetPresence,
+		Typing,
+		ChangeName,
+		EditMessage, DeleteMessage,
+		Reply, ListThread,
+		React, Unreact,
+		MarkRead,
+		ReadReceipt,
+		SearchMessages,
+		SetTopic, ListRoomsPage, ListUsersPage,
+		Subscribe, Unsubscribe,
+		GetMOTD, GetServerInfo,
+		Announce, ScheduleMessage,
+		SetRetention, DescribeRoom,
+		ListScheduled, CancelScheduled:
 		break
 	default:
 		return fmt.Errorf("decode RequestType(0x%08X): %w", uint32(*typ), ErrInvalidRequestType)
@@ -163,9 +368,21 @@ func (*KeepaliveRequest) encodeRequest(io.Writer) error { return nil }
 
 func (*KeepaliveRequest) decodeRequest(io.Reader) error { return nil }
 
-// This ConnectRequest MUST be sent to a server at the beginning of a connection.
+// The versions of the protocol. The client sends the version that it uses in its ConnectRequest or LoginRequest.
+const (
+	Version1 uint32 = 1 + iota // The original protocol.
+
+	// Lists of rooms and users carry structured entries.
+	//   - ListRoomsRequests and ListRoomsPageRequests are answered with a RoomEntryListResponse.
+	//   - ListUsersRequests and ListUsersPageRequests are answered with a UserEntryListResponse.
+	//   - The server sends a MOTDResponse after connecting if it has a message of the day.
+	Version2
+)
+
+// This ConnectRequest MUST be sent to a server at the beginning of a connection, unless a LoginRequest is sent instead.
 //   - The server MAY respond with an error message.
 //   - The server MUST update the user list if the client connected successfully.
+//   - The server MUST respond with an ExistingUser error if the name belongs to a registered user.
 type ConnectRequest struct {
 	Version uint32 // The version of the protocol that the client is using.
 	Name    string // The display name the user wishes to connect with.
@@ -218,6 +435,7 @@ func (*DisconnectRequest) decodeRequest(io.Reader) error { return nil }
 //   - The server MAY respond with an error message.
 //   - The server MUST update the room list if the room was created successfully.
 //   - The server MUST NOT add the user to the newly created room until the client joins with a JoinRoomRequest.
+//   - The server MAY remove the room if no user joins it.
 type CreateRoomRequest struct {
 	Room string // Desired name of the new room.
 }
@@ -272,7 +490,8 @@ func (jr *JoinRoomRequest) decodeRequest(r io.Reader) error {
 // A LeaveRoomRequest should be sent by the client to leave a room.
 //   - The server MAY respond with an error message.
 //   - The server MUST update the room's list of users if the room was left successfully.
-//   - The server MUST remove a room from the room list if there are no users remaining.
+//   - The server MUST remove an ephemeral room from the room list once it has had no users for its grace period.
+//     See the Lifetime and GracePeriod room options.
 type LeaveRoomRequest struct {
 	Room string // Desired name of the room to leave.
 }
@@ -302,6 +521,7 @@ func (lr *LeaveRoomRequest) decodeRequest(r io.Reader) error {
 type ListRoomsRequest struct {
 	//  The name of the user to get a list of joined rooms for.
 	//  - If the user name is empty, the server MUST respond with a list of rooms for the entire server.
+	//  - If the user is not the client user, the server MUST only list the rooms that the client user has also joined.
 	User string
 }
 
@@ -330,6 +550,7 @@ func (lr *ListRoomsRequest) decodeRequest(r io.Reader) error {
 type ListUsersRequest struct {
 	// The name of the room to get a list of users for.
 	//   - If the room name is empty, the server MUST respond with a list of users for the entire server.
+	//   - If the client user has not joined the room, the server MUST respond with a NotInRoom error.
 	Room string
 }
 
@@ -355,6 +576,8 @@ func (lu *ListUsersRequest) decodeRequest(r io.Reader) error {
 
 // A MessageRoomRequest should be sent by the client to send a chat message to a room.
 //   - The server MAY respond with an error message.
+//   - The server MUST respond with a NotInRoom error if the client user has not joined the room,
+//     unless the room allows outside posts.
 //   - The server MUST forward the message to other users in the room if sending the chat message was successful.
 type MessageRoomRequest struct {
 	Room string // The name of the room to send the chat message to.
@@ -428,3 +651,1527 @@ func (mu *MessageUserRequest) decodeRequest(r io.Reader) error {
 
 	return nil
 }
+
+// A BlockRequest should be sent by the client to stop receiving direct messages from another user.
+//   - The server MUST NOT forward direct messages from a blocked user to the client user.
+//   - The server MAY silently drop a blocked direct message or respond to the sender with a BlockedUser error.
+type BlockRequest struct {
+	// The name of the user to block.
+	//   - If the user name is empty, the server MUST block direct messages from every user that is not a contact.
+	//     A contact is a user that the client user has sent a direct message to.
+	User string
+}
+
+func (*BlockRequest) RequestType() RequestType { return Block }
+
+func (b *BlockRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, b.User)
+	if err != nil {
+		return fmt.Errorf("encode BlockRequest.User: %w", err)
+	}
+
+	return nil
+}
+
+func (b *BlockRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &b.User)
+	if err != nil {
+		return fmt.Errorf("decode BlockRequest.User: %w", err)
+	}
+
+	return nil
+}
+
+// An UnblockRequest should be sent by the client to receive direct messages from a blocked user again.
+//   - The server MUST NOT respond with an error if the user was not blocked.
+type UnblockRequest struct {
+	// The name of the user to unblock.
+	//   - If the user name is empty, the server MUST stop blocking direct messages from users that are not contacts.
+	User string
+}
+
+func (*UnblockRequest) RequestType() RequestType { return Unblock }
+
+func (u *UnblockRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, u.User)
+	if err != nil {
+		return fmt.Errorf("encode UnblockRequest.User: %w", err)
+	}
+
+	return nil
+}
+
+func (u *UnblockRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &u.User)
+	if err != nil {
+		return fmt.Errorf("decode UnblockRequest.User: %w", err)
+	}
+
+	return nil
+}
+
+// A ListBlocksRequest should be sent by the client to obtain the client user's block list.
+//   - The server MUST respond with a BlockListResponse.
+type ListBlocksRequest struct{}
+
+func (*ListBlocksRequest) RequestType() RequestType { return ListBlocks }
+
+func (*ListBlocksRequest) encodeRequest(io.Writer) error { return nil }
+
+func (*ListBlocksRequest) decodeRequest(io.Reader) error { return nil }
+
+type RoomOption uint32
+
+const (
+	// Whether users that have not joined the room can send chat messages to it.
+	//   - The value MUST be 0 (disallowed) or 1 (allowed). Outside posts are disallowed by default.
+	AllowOutsidePosts RoomOption = 1 + iota
+
+	// When the room is removed after its last member leaves.
+	//   - The value MUST be one of the RoomLifetime constants. Rooms follow the server's default lifetime by default.
+	//   - The server MAY refuse to change the lifetime of rooms that it always keeps.
+	Lifetime
+
+	// The number of seconds that an ephemeral room is kept after its last member leaves.
+	//   - Zero uses the server's default grace period.
+	GracePeriod
+)
+
+// The values of the Lifetime room option.
+const (
+	DefaultLifetime uint32 = iota // The room follows the server's default lifetime.
+	EphemeralRoom                 // The room is removed once it has been empty for its grace period.
+	PermanentRoom                 // The room is kept when it is empty.
+)
+
+func (o RoomOption) GoString() string {
+	switch o {
+	case AllowOutsidePosts:
+		return "AllowOutsidePosts"
+	case Lifetime:
+		return "Lifetime"
+	case GracePeriod:
+		return "GracePeriod"
+	default:
+		return fmt.Sprintf("RoomOption(%d)", o)
+	}
+}
+
+func (o RoomOption) String() string { return o.GoString() }
+
+func encodeRoomOption(w io.Writer, o RoomOption) error {
+	switch o {
+	case AllowOutsidePosts, Lifetime, GracePeriod:
+		break
+	default:
+		return fmt.Errorf("encode RoomOption(%d): %w", o, ErrInvalidRoomOption)
+	}
+
+	err := encodeInt(w, o)
+	if err != nil {
+		return fmt.Errorf("encode RoomOption(%d): %w", o, err)
+	}
+
+	return nil
+}
+
+func decodeRoomOption(r io.Reader, o *RoomOption) error {
+	err := decodeInt(r, o)
+	if err != nil {
+		return fmt.Errorf("decode RoomOption: %w", err)
+	}
+
+	switch *o {
+	case AllowOutsidePosts, Lifetime, GracePeriod:
+		break
+	default:
+		return fmt.Errorf("decode RoomOption(0x%08X): %w", uint32(*o), ErrInvalidRoomOption)
+	}
+
+	return nil
+}
+
+// A SetRoomOptionRequest should be sent by the client to change an option of a room.
+//   - The server MAY respond with an error message.
+//   - The server MUST respond with a PermissionDenied error if the client user is not an operator of the room.
+//     The user that created a room is its operator.
+type SetRoomOptionRequest struct {
+	Room   string     // The name of the room to change.
+	Option RoomOption // The option to change. See RoomOption.
+	Value  uint32     // The new value of the option.
+}
+
+func (*SetRoomOptionRequest) RequestType() RequestType { return SetRoomOption }
+
+func (so *SetRoomOptionRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, so.Room)
+	if err != nil {
+		return fmt.Errorf("encode SetRoomOptionRequest.Room: %w", err)
+	}
+
+	err = encodeRoomOption(w, so.Option)
+	if err != nil {
+		return fmt.Errorf("encode SetRoomOptionRequest.Option: %w", err)
+	}
+
+	err = encodeInt(w, so.Value)
+	if err != nil {
+		return fmt.Errorf("encode SetRoomOptionRequest.Value: %w", err)
+	}
+
+	return nil
+}
+
+func (so *SetRoomOptionRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &so.Room)
+	if err != nil {
+		return fmt.Errorf("decode SetRoomOptionRequest.Room: %w", err)
+	}
+
+	err = decodeRoomOption(r, &so.Option)
+	if err != nil {
+		return fmt.Errorf("decode SetRoomOptionRequest.Option: %w", err)
+	}
+
+	err = decodeInt(r, &so.Value)
+	if err != nil {
+		return fmt.Errorf("decode SetRoomOptionRequest.Value: %w", err)
+	}
+
+	return nil
+}
+
+// Capability is a set of optional protocol features.
+// Each feature is a single bit so that several features can be negotiated in one request.
+type Capability uint32
+
+const (
+	// The server sends the client user's own chat messages back to the client once they have been relayed.
+	//   - Room messages are echoed as a RoomMessageResponse with the client user as the sender.
+	//   - Direct messages are echoed as a UserMessageEchoResponse.
+	//   - Messages are echoed to every client of a logged in user that enabled the capability.
+	EchoMessages Capability = 1 << iota
+
+	// The server queues direct messages to registered users that are offline.
+	//   - Queued messages are sent as OfflineMessageResponses when a client of the recipient enables the capability.
+	//   - The sender is sent a MessageQueuedResponse if it enabled the capability.
+	OfflineMessages
+
+	// The server tells the client about the presence of other users.
+	//   - ListUsersRequests are answered with a PresenceListResponse instead of a UserListResponse.
+	//   - A PresenceChangeResponse is sent when a user that shares a room with the client user changes presence.
+	//   - An AutoReplyResponse is sent when a direct message from the client user is sent to a user that is not online.
+	PresenceUpdates
+
+	// The server relays TypingRequests from other users as UserTypingResponses.
+	TypingNotifications
+
+	// The server sends a NameChangedResponse when the client user
+	// or a user that shares a room with the client user changes name.
+	NameChanges
+
+	// The server sends chat messages as ChatMessageResponses that carry a message ID,
+	// instead of RoomMessageResponses, UserMessageResponses and UserMessageEchoResponses.
+	//   - MessageEditedResponses and MessageDeletedResponses are sent when a chat message that the client received changes.
+	//   - ReplyRequests and ListThreadRequests refer to chat messages by their ID.
+	//   - ReactRequests and UnreactRequests change the reactions to a chat message,
+	//     and ReactionListResponses are sent when the reactions to a chat message that the client received change.
+	//   - MarkReadRequests move the read marker of a room. ReadMarkerResponses are sent for every joined room
+	//     after negotiating, after joining a room, and when a read marker moves.
+	MessageIDs
+
+	// The server sends a ReceiptResponse when a direct message from the client user
+	// has been delivered to a client of the recipient and when the recipient has read it.
+	//   - Read receipts are only sent if a client of the recipient sends a ReadReceiptRequest.
+	//   - The capability is only useful together with MessageIDs.
+	Receipts
+)
+
+// Has reports whether every capability in other is also in c.
+func (c Capability) Has(other Capability) bool { return c&other == other }
+
+func (c Capability) GoString() string {
+	names := []string{}
+	for bit := Capability(1); bit != 0; bit <<= 1 {
+		if !c.Has(bit) {
+			continue
+		}
+		switch bit {
+		case EchoMessages:
+			names = append(names, "EchoMessages")
+		case OfflineMessages:
+			names = append(names, "OfflineMessages")
+		case PresenceUpdates:
+			names = append(names, "PresenceUpdates")
+		case TypingNotifications:
+			names = append(names, "TypingNotifications")
+		case NameChanges:
+			names = append(names, "NameChanges")
+		case MessageIDs:
+			names = append(names, "MessageIDs")
+		case Receipts:
+			names = append(names, "Receipts")
+		default:
+			names = append(names, fmt.Sprintf("Capability(0x%08X)", uint32(bit)))
+		}
+	}
+	if len(names) == 0 {
+		return "Capability(0)"
+	}
+	return strings.Join(names, "|")
+}
+
+func (c Capability) String() string { return c.GoString() }
+
+// A NegotiateRequest should be sent by the client after connecting to enable optional protocol features.
+//   - The server MUST respond with a CapabilitiesResponse.
+//   - The server MUST NOT use a capability that was not requested.
+//   - Each NegotiateRequest replaces the capabilities enabled by the previous one.
+type NegotiateRequest struct {
+	Capabilities Capability // The capabilities that the client supports.
+}
+
+func (*NegotiateRequest) RequestType() RequestType { return Negotiate }
+
+func (n *NegotiateRequest) encodeRequest(w io.Writer) error {
+	err := encodeInt(w, n.Capabilities)
+	if err != nil {
+		return fmt.Errorf("encode NegotiateRequest.Capabilities: %w", err)
+	}
+
+	return nil
+}
+
+func (n *NegotiateRequest) decodeRequest(r io.Reader) error {
+	err := decodeInt(r, &n.Capabilities)
+	if err != nil {
+		return fmt.Errorf("decode NegotiateRequest.Capabilities: %w", err)
+	}
+
+	return nil
+}
+
+// A RegisterRequest should be sent by the client to register the client user's name with a password.
+//   - The server MAY respond with an error message.
+//   - After the name is registered, clients MUST use a LoginRequest to connect with it.
+//   - The password is sent as plain text, so clients SHOULD only register over a trusted network.
+type RegisterRequest struct {
+	Password string // The password that protects the name.
+}
+
+func (*RegisterRequest) RequestType() RequestType { return Register }
+
+// GoString hides the password when the request is formatted with %#v.
+func (rg *RegisterRequest) GoString() string { return "&protocol.RegisterRequest{Password:\"...\"}" }
+
+func (rg *RegisterRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, rg.Password)
+	if err != nil {
+		return fmt.Errorf("encode RegisterRequest.Password: %w", err)
+	}
+
+	return nil
+}
+
+func (rg *RegisterRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &rg.Password)
+	if err != nil {
+		return fmt.Errorf("decode RegisterRequest.Password: %w", err)
+	}
+
+	return nil
+}
+
+// A LoginRequest MAY be sent to a server at the beginning of a connection instead of a ConnectRequest
+// to connect as a registered user.
+//   - The server MUST respond with an AuthenticationFailed error if the name is not registered or the password is wrong.
+//   - A registered user MAY be connected from several clients at the same time.
+//     The server MUST send chat messages for the user to every connected client,
+//     and the user MUST remain in its rooms until the last client disconnects.
+type LoginRequest struct {
+	Version  uint32 // The version of the protocol that the client is using.
+	Name     string // The registered name of the user.
+	Password string // The password that the name was registered with.
+}
+
+func (*LoginRequest) RequestType() RequestType { return Login }
+
+// GoString hides the password when the request is formatted with %#v.
+func (l *LoginRequest) GoString() string {
+	return fmt.Sprintf("&protocol.LoginRequest{Version:0x%x, Name:%q, Password:\"...\"}", l.Version, l.Name)
+}
+
+func (l *LoginRequest) encodeRequest(w io.Writer) error {
+	err := encodeInt(w, l.Version)
+	if err != nil {
+		return fmt.Errorf("encode LoginRequest.Version: %w", err)
+	}
+
+	err = encodeString(w, l.Name)
+	if err != nil {
+		return fmt.Errorf("encode LoginRequest.Name: %w", err)
+	}
+
+	err = encodeString(w, l.Password)
+	if err != nil {
+		return fmt.Errorf("encode LoginRequest.Password: %w", err)
+	}
+
+	return nil
+}
+
+func (l *LoginRequest) decodeRequest(r io.Reader) error {
+	err := decodeInt(r, &l.Version)
+	if err != nil {
+		return fmt.Errorf("decode LoginRequest.Version: %w", err)
+	}
+
+	err = decodeString(r, &l.Name)
+	if err != nil {
+		return fmt.Errorf("decode LoginRequest.Name: %w", err)
+	}
+
+	err = decodeString(r, &l.Password)
+	if err != nil {
+		return fmt.Errorf("decode LoginRequest.Password: %w", err)
+	}
+
+	return nil
+}
+
+// Presence is the availability of a user.
+type Presence uint32
+
+const (
+	Online       Presence = iota // The user is available. This is the presence of newly connected users.
+	Away                         // The user is not at the client.
+	DoNotDisturb                 // The user does not want to be interrupted.
+)
+
+func (p Presence) GoString() string {
+	switch p {
+	case Online:
+		return "Online"
+	case Away:
+		return "Away"
+	case DoNotDisturb:
+		return "DoNotDisturb"
+	default:
+		return fmt.Sprintf("Presence(%d)", p)
+	}
+}
+
+func (p Presence) String() string { return p.GoString() }
+
+func encodePresence(w io.Writer, p Presence) error {
+	switch p {
+	case Online, Away, DoNotDisturb:
+		break
+	default:
+		return fmt.Errorf("encode Presence(%d): %w", p, ErrInvalidPresence)
+	}
+
+	err := encodeInt(w, p)
+	if err != nil {
+		return fmt.Errorf("encode Presence(%d): %w", p, err)
+	}
+
+	return nil
+}
+
+func decodePresence(r io.Reader, p *Presence) error {
+	err := decodeInt(r, p)
+	if err != nil {
+		return fmt.Errorf("decode Presence: %w", err)
+	}
+
+	switch *p {
+	case Online, Away, DoNotDisturb:
+		break
+	default:
+		return fmt.Errorf("decode Presence(0x%08X): %w", uint32(*p), ErrInvalidPresence)
+	}
+
+	return nil
+}
+
+// A SetPresenceRequest should be sent by the client to change the presence of the client user.
+//   - The server MAY respond with an error message.
+//   - The server MUST send a PresenceChangeResponse to clients with the PresenceUpdates capability
+//     whose users share a room with the client user.
+type SetPresenceRequest struct {
+	Presence Presence // The new presence of the client user.
+	Message  string   // A status message such as the reason for being away. May be empty.
+}
+
+func (*SetPresenceRequest) RequestType() RequestType { return SetPresence }
+
+func (sp *SetPresenceRequest) encodeRequest(w io.Writer) error {
+	err := encodePresence(w, sp.Presence)
+	if err != nil {
+		return fmt.Errorf("encode SetPresenceRequest.Presence: %w", err)
+	}
+
+	err = encodeString(w, sp.Message)
+	if err != nil {
+		return fmt.Errorf("encode SetPresenceRequest.Message: %w", err)
+	}
+
+	return nil
+}
+
+func (sp *SetPresenceRequest) decodeRequest(r io.Reader) error {
+	err := decodePresence(r, &sp.Presence)
+	if err != nil {
+		return fmt.Errorf("decode SetPresenceRequest.Presence: %w", err)
+	}
+
+	err = decodeString(r, &sp.Message)
+	if err != nil {
+		return fmt.Errorf("decode SetPresenceRequest.Message: %w", err)
+	}
+
+	return nil
+}
+
+// A TypingRequest should be sent by the client periodically while the client user is composing a chat message.
+//   - Exactly one of Room and User MUST be set.
+//   - The server MUST NOT respond with an error. Requests for missing rooms and users are ignored.
+//   - The server MAY ignore requests that are sent more often than once every few seconds.
+//   - The server MUST send a UserTypingResponse to the other members of the room, or to the user,
+//     if their clients have the TypingNotifications capability. The server MUST NOT store the request.
+type TypingRequest struct {
+	Room string // The name of the room that the chat message is for.
+	User string // The name of the user that the direct message is for.
+}
+
+func (*TypingRequest) RequestType() RequestType { return Typing }
+
+func (t *TypingRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, t.Room)
+	if err != nil {
+		return fmt.Errorf("encode TypingRequest.Room: %w", err)
+	}
+
+	err = encodeString(w, t.User)
+	if err != nil {
+		return fmt.Errorf("encode TypingRequest.User: %w", err)
+	}
+
+	return nil
+}
+
+func (t *TypingRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &t.Room)
+	if err != nil {
+		return fmt.Errorf("decode TypingRequest.Room: %w", err)
+	}
+
+	err = decodeString(r, &t.User)
+	if err != nil {
+		return fmt.Errorf("decode TypingRequest.User: %w", err)
+	}
+
+	return nil
+}
+
+// A ChangeNameRequest should be sent by the client to change the name of the client user without reconnecting.
+//   - The server MAY respond with an error message. The name requirements are the same as for a ConnectRequest.
+//   - The client user MUST keep its rooms, and a registered user MUST keep its registration under the new name.
+type ChangeNameRequest struct {
+	Name string // The new name of the client user.
+}
+
+func (*ChangeNameRequest) RequestType() RequestType { return ChangeName }
+
+func (cn *ChangeNameRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, cn.Name)
+	if err != nil {
+		return fmt.Errorf("encode ChangeNameRequest.Name: %w", err)
+	}
+
+	return nil
+}
+
+func (cn *ChangeNameRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &cn.Name)
+	if err != nil {
+		return fmt.Errorf("decode ChangeNameRequest.Name: %w", err)
+	}
+
+	return nil
+}
+
+// MessageID identifies a chat message that was relayed by the server.
+//   - The server MUST assign increasing IDs that are unique within the server. Zero is not a valid ID.
+type MessageID uint64
+
+// An EditMessageRequest should be sent by the client to replace the text of a chat message sent by the client user.
+//   - The server MAY respond with an error message.
+//   - The server MUST respond with a PermissionDenied error if the client user did not send the chat message.
+type EditMessageRequest struct {
+	ID   MessageID // The ID of the chat message to edit.
+	Text string    // The new text content of the chat message.
+}
+
+func (*EditMessageRequest) RequestType() RequestType { return EditMessage }
+
+func (em *EditMessageRequest) encodeRequest(w io.Writer) error {
+	err := encodeLong(w, em.ID)
+	if err != nil {
+		return fmt.Errorf("encode EditMessageRequest.ID: %w", err)
+	}
+
+	err = encodeString(w, em.Text)
+	if err != nil {
+		return fmt.Errorf("encode EditMessageRequest.Text: %w", err)
+	}
+
+	return nil
+}
+
+func (em *EditMessageRequest) decodeRequest(r io.Reader) error {
+	err := decodeLong(r, &em.ID)
+	if err != nil {
+		return fmt.Errorf("decode EditMessageRequest.ID: %w", err)
+	}
+
+	err = decodeString(r, &em.Text)
+	if err != nil {
+		return fmt.Errorf("decode EditMessageRequest.Text: %w", err)
+	}
+
+	return nil
+}
+
+// A DeleteMessageRequest should be sent by the client to retract a chat message.
+//   - The server MAY respond with an error message.
+//   - The server MUST respond with a PermissionDenied error unless the client user sent the chat message
+//     or is an operator of the room that the chat message was sent to.
+type DeleteMessageRequest struct {
+	ID MessageID // The ID of the chat message to delete.
+}
+
+func (*DeleteMessageRequest) RequestType() RequestType { return DeleteMessage }
+
+func (dm *DeleteMessageRequest) encodeRequest(w io.Writer) error {
+	err := encodeLong(w, dm.ID)
+	if err != nil {
+		return fmt.Errorf("encode DeleteMessageRequest.ID: %w", err)
+	}
+
+	return nil
+}
+
+func (dm *DeleteMessageRequest) decodeRequest(r io.Reader) error {
+	err := decodeLong(r, &dm.ID)
+	if err != nil {
+		return fmt.Errorf("decode DeleteMessageRequest.ID: %w", err)
+	}
+
+	return nil
+}
+
+// A ReplyRequest should be sent by the client to reply to a chat message.
+// The reply is sent to the room of the chat message, or to the other user of a direct message.
+//   - The server MAY respond with an error message.
+//   - The server MUST respond with a MissingMessage error if the client user cannot see the chat message.
+type ReplyRequest struct {
+	ReplyTo MessageID // The ID of the chat message to reply to.
+	Text    string    // The text content of the reply.
+}
+
+func (*ReplyRequest) RequestType() RequestType { return Reply }
+
+func (rp *ReplyRequest) encodeRequest(w io.Writer) error {
+	err := encodeLong(w, rp.ReplyTo)
+	if err != nil {
+		return fmt.Errorf("encode ReplyRequest.ReplyTo: %w", err)
+	}
+
+	err = encodeString(w, rp.Text)
+	if err != nil {
+		return fmt.Errorf("encode ReplyRequest.Text: %w", err)
+	}
+
+	return nil
+}
+
+func (rp *ReplyRequest) decodeRequest(r io.Reader) error {
+	err := decodeLong(r, &rp.ReplyTo)
+	if err != nil {
+		return fmt.Errorf("decode ReplyRequest.ReplyTo: %w", err)
+	}
+
+	err = decodeString(r, &rp.Text)
+	if err != nil {
+		return fmt.Errorf("decode ReplyRequest.Text: %w", err)
+	}
+
+	return nil
+}
+
+// A ListThreadRequest should be sent by the client to receive a chat message and all of its replies.
+//   - The server MUST respond with a ThreadResponse or an error message.
+//   - The server MUST respond with a MissingMessage error if the client user cannot see the chat message.
+type ListThreadRequest struct {
+	Root MessageID // The ID of the first chat message of the thread.
+}
+
+func (*ListThreadRequest) RequestType() RequestType { return ListThread }
+
+func (lt *ListThreadRequest) encodeRequest(w io.Writer) error {
+	err := encodeLong(w, lt.Root)
+	if err != nil {
+		return fmt.Errorf("encode ListThreadRequest.Root: %w", err)
+	}
+
+	return nil
+}
+
+func (lt *ListThreadRequest) decodeRequest(r io.Reader) error {
+	err := decodeLong(r, &lt.Root)
+	if err != nil {
+		return fmt.Errorf("decode ListThreadRequest.Root: %w", err)
+	}
+
+	return nil
+}
+
+// A ReactRequest should be sent by the client to add a reaction of the client user to a chat message.
+//   - The server MAY respond with an error message.
+//   - The server MUST respond with a MissingMessage error if the client user cannot see the chat message.
+//   - The server MUST respond with an InvalidReaction error if the reaction is not a short emoji or word.
+type ReactRequest struct {
+	ID       MessageID // The ID of the chat message to react to.
+	Reaction string    // The reaction, usually a single emoji.
+}
+
+func (*ReactRequest) RequestType() RequestType { return React }
+
+func (re *ReactRequest) encodeRequest(w io.Writer) error {
+	err := encodeLong(w, re.ID)
+	if err != nil {
+		return fmt.Errorf("encode ReactRequest.ID: %w", err)
+	}
+
+	err = encodeString(w, re.Reaction)
+	if err != nil {
+		return fmt.Errorf("encode ReactRequest.Reaction: %w", err)
+	}
+
+	return nil
+}
+
+func (re *ReactRequest) decodeRequest(r io.Reader) error {
+	err := decodeLong(r, &re.ID)
+	if err != nil {
+		return fmt.Errorf("decode ReactRequest.ID: %w", err)
+	}
+
+	err = decodeString(r, &re.Reaction)
+	if err != nil {
+		return fmt.Errorf("decode ReactRequest.Reaction: %w", err)
+	}
+
+	return nil
+}
+
+// An UnreactRequest should be sent by the client to remove a reaction of the client user from a chat message.
+//   - The server MAY respond with an error message.
+//   - The server MUST respond with a MissingMessage error if the client user cannot see the chat message.
+type UnreactRequest struct {
+	ID       MessageID // The ID of the chat message to remove the reaction from.
+	Reaction string    // The reaction to remove.
+}
+
+func (*UnreactRequest) RequestType() RequestType { return Unreact }
+
+func (ur *UnreactRequest) encodeRequest(w io.Writer) error {
+	err := encodeLong(w, ur.ID)
+	if err != nil {
+		return fmt.Errorf("encode UnreactRequest.ID: %w", err)
+	}
+
+	err = encodeString(w, ur.Reaction)
+	if err != nil {
+		return fmt.Errorf("encode UnreactRequest.Reaction: %w", err)
+	}
+
+	return nil
+}
+
+func (ur *UnreactRequest) decodeRequest(r io.Reader) error {
+	err := decodeLong(r, &ur.ID)
+	if err != nil {
+		return fmt.Errorf("decode UnreactRequest.ID: %w", err)
+	}
+
+	err = decodeString(r, &ur.Reaction)
+	if err != nil {
+		return fmt.Errorf("decode UnreactRequest.Reaction: %w", err)
+	}
+
+	return nil
+}
+
+// A MarkReadRequest should be sent by the client when the client user has read the chat messages of a room
+// up to and including a chat message.
+//   - The server MAY respond with an error message.
+//   - The server MUST respond with a MissingMessage error if the chat message was not sent to the room.
+//   - The server MUST ignore the request if the read marker of the room is already at a later chat message.
+type MarkReadRequest struct {
+	Room string    // The name of the room.
+	ID   MessageID // The ID of the last chat message that the client user read.
+}
+
+func (*MarkReadRequest) RequestType() RequestType { return MarkRead }
+
+func (mr *MarkReadRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, mr.Room)
+	if err != nil {
+		return fmt.Errorf("encode MarkReadRequest.Room: %w", err)
+	}
+
+	err = encodeLong(w, mr.ID)
+	if err != nil {
+		return fmt.Errorf("encode MarkReadRequest.ID: %w", err)
+	}
+
+	return nil
+}
+
+func (mr *MarkReadRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &mr.Room)
+	if err != nil {
+		return fmt.Errorf("decode MarkReadRequest.Room: %w", err)
+	}
+
+	err = decodeLong(r, &mr.ID)
+	if err != nil {
+		return fmt.Errorf("decode MarkReadRequest.ID: %w", err)
+	}
+
+	return nil
+}
+
+// A ReadReceiptRequest may be sent by the client when the client user has read a direct message.
+//   - The server MAY respond with an error message.
+//   - The server MUST respond with a MissingMessage error if the client user did not receive the direct message.
+type ReadReceiptRequest struct {
+	ID MessageID // The ID of the direct message.
+}
+
+func (*ReadReceiptRequest) RequestType() RequestType { return ReadReceipt }
+
+func (rr *ReadReceiptRequest) encodeRequest(w io.Writer) error {
+	err := encodeLong(w, rr.ID)
+	if err != nil {
+		return fmt.Errorf("encode ReadReceiptRequest.ID: %w", err)
+	}
+
+	return nil
+}
+
+func (rr *ReadReceiptRequest) decodeRequest(r io.Reader) error {
+	err := decodeLong(r, &rr.ID)
+	if err != nil {
+		return fmt.Errorf("decode ReadReceiptRequest.ID: %w", err)
+	}
+
+	return nil
+}
+
+// A SearchMessagesRequest should be sent by the client to find chat messages in the rooms that the client user has joined.
+// Chat messages match if they contain every word of the query and satisfy every filter.
+//   - The server MUST respond with a SearchResultsResponse or an error message.
+//   - The server MUST respond with a NotInRoom error if the client user has not joined the room of the room filter.
+type SearchMessagesRequest struct {
+	Query  string    // The words to search for. Empty to match every chat message.
+	Room   string    // The name of the room to search in. Empty to search every joined room.
+	Sender string    // The name of the user that sent the chat messages. Empty to match every sender.
+	After  time.Time // Only chat messages sent after this time match. The Unix epoch means no lower bound.
+	Before time.Time // Only chat messages sent before this time match. The Unix epoch means no upper bound.
+	Cursor MessageID // Only chat messages with a lower ID match. Zero to start at the newest chat message.
+	Limit  uint32    // The maximum number of results. Zero for the server's default. The server MAY return fewer.
+}
+
+func (*SearchMessagesRequest) RequestType() RequestType { return SearchMessages }
+
+func (sm *SearchMessagesRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, sm.Query)
+	if err != nil {
+		return fmt.Errorf("encode SearchMessagesRequest.Query: %w", err)
+	}
+
+	err = encodeString(w, sm.Room)
+	if err != nil {
+		return fmt.Errorf("encode SearchMessagesRequest.Room: %w", err)
+	}
+
+	err = encodeString(w, sm.Sender)
+	if err != nil {
+		return fmt.Errorf("encode SearchMessagesRequest.Sender: %w", err)
+	}
+
+	err = encodeTime(w, sm.After)
+	if err != nil {
+		return fmt.Errorf("encode SearchMessagesRequest.After: %w", err)
+	}
+
+	err = encodeTime(w, sm.Before)
+	if err != nil {
+		return fmt.Errorf("encode SearchMessagesRequest.Before: %w", err)
+	}
+
+	err = encodeLong(w, sm.Cursor)
+	if err != nil {
+		return fmt.Errorf("encode SearchMessagesRequest.Cursor: %w", err)
+	}
+
+	err = encodeInt(w, sm.Limit)
+	if err != nil {
+		return fmt.Errorf("encode SearchMessagesRequest.Limit: %w", err)
+	}
+
+	return nil
+}
+
+func (sm *SearchMessagesRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &sm.Query)
+	if err != nil {
+		return fmt.Errorf("decode SearchMessagesRequest.Query: %w", err)
+	}
+
+	err = decodeString(r, &sm.Room)
+	if err != nil {
+		return fmt.Errorf("decode SearchMessagesRequest.Room: %w", err)
+	}
+
+	err = decodeString(r, &sm.Sender)
+	if err != nil {
+		return fmt.Errorf("decode SearchMessagesRequest.Sender: %w", err)
+	}
+
+	err = decodeTime(r, &sm.After)
+	if err != nil {
+		return fmt.Errorf("decode SearchMessagesRequest.After: %w", err)
+	}
+
+	err = decodeTime(r, &sm.Before)
+	if err != nil {
+		return fmt.Errorf("decode SearchMessagesRequest.Before: %w", err)
+	}
+
+	err = decodeLong(r, &sm.Cursor)
+	if err != nil {
+		return fmt.Errorf("decode SearchMessagesRequest.Cursor: %w", err)
+	}
+
+	err = decodeInt(r, &sm.Limit)
+	if err != nil {
+		return fmt.Errorf("decode SearchMessagesRequest.Limit: %w", err)
+	}
+
+	return nil
+}
+
+// A SetTopicRequest should be sent by the client to change the topic of a room.
+//   - The server MAY respond with an error message.
+//   - The server MUST respond with a PermissionDenied error if the client user is not an operator of the room.
+type SetTopicRequest struct {
+	Room  string // The name of the room to change.
+	Topic string // The new topic of the room. Empty to remove the topic.
+}
+
+func (*SetTopicRequest) RequestType() RequestType { return SetTopic }
+
+func (st *SetTopicRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, st.Room)
+	if err != nil {
+		return fmt.Errorf("encode SetTopicRequest.Room: %w", err)
+	}
+
+	err = encodeString(w, st.Topic)
+	if err != nil {
+		return fmt.Errorf("encode SetTopicRequest.Topic: %w", err)
+	}
+
+	return nil
+}
+
+func (st *SetTopicRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &st.Room)
+	if err != nil {
+		return fmt.Errorf("decode SetTopicRequest.Room: %w", err)
+	}
+
+	err = decodeString(r, &st.Topic)
+	if err != nil {
+		return fmt.Errorf("decode SetTopicRequest.Topic: %w", err)
+	}
+
+	return nil
+}
+
+type ListOrder uint32
+
+const (
+	// Entries are sorted by name.
+	OrderByName ListOrder = iota
+	// Rooms are sorted by their number of members and users by their number of joined rooms, largest first.
+	// Entries of the same size are sorted by name.
+	OrderBySize
+)
+
+func (o ListOrder) GoString() string {
+	switch o {
+	case OrderByName:
+		return "OrderByName"
+	case OrderBySize:
+		return "OrderBySize"
+	default:
+		return fmt.Sprintf("ListOrder(%d)", o)
+	}
+}
+
+func (o ListOrder) String() string { return o.GoString() }
+
+func encodeListOrder(w io.Writer, o ListOrder) error {
+	switch o {
+	case OrderByName, OrderBySize:
+		break
+	default:
+		return fmt.Errorf("encode ListOrder(%d): %w", o, ErrInvalidListOrder)
+	}
+
+	err := encodeInt(w, o)
+	if err != nil {
+		return fmt.Errorf("encode ListOrder(%d): %w", o, err)
+	}
+
+	return nil
+}
+
+func decodeListOrder(r io.Reader, o *ListOrder) error {
+	err := decodeInt(r, o)
+	if err != nil {
+		return fmt.Errorf("decode ListOrder: %w", err)
+	}
+
+	switch *o {
+	case OrderByName, OrderBySize:
+		break
+	default:
+		return fmt.Errorf("decode ListOrder(0x%08X): %w", uint32(*o), ErrInvalidListOrder)
+	}
+
+	return nil
+}
+
+// A ListRoomsPageRequest should be sent by the client to obtain one page of a sorted and filtered list of rooms.
+//   - The server MUST respond with an error message or a RoomPageResponse.
+//   - The server MUST respond with an InvalidFilter error if the filter is not a valid pattern.
+type ListRoomsPageRequest struct {
+	// The name of the user to list the joined rooms of.
+	//   - If the user name is empty, the server MUST list the rooms of the entire server.
+	//   - If the user is not the client user, the server MUST only list the rooms that the client user has also joined.
+	User   string
+	Filter string    // A prefix or glob pattern that the names of the entries must match, ignoring case. Empty to match every name.
+	Order  ListOrder // The order of the entries.
+	Cursor string    // The Next value of the previous page. Empty for the first page.
+	Limit  uint32    // The maximum number of entries. Zero for the server's default. The server MAY return fewer.
+}
+
+func (*ListRoomsPageRequest) RequestType() RequestType { return ListRoomsPage }
+
+func (lr *ListRoomsPageRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, lr.User)
+	if err != nil {
+		return fmt.Errorf("encode ListRoomsPageRequest.User: %w", err)
+	}
+
+	err = encodeString(w, lr.Filter)
+	if err != nil {
+		return fmt.Errorf("encode ListRoomsPageRequest.Filter: %w", err)
+	}
+
+	err = encodeListOrder(w, lr.Order)
+	if err != nil {
+		return fmt.Errorf("encode ListRoomsPageRequest.Order: %w", err)
+	}
+
+	err = encodeString(w, lr.Cursor)
+	if err != nil {
+		return fmt.Errorf("encode ListRoomsPageRequest.Cursor: %w", err)
+	}
+
+	err = encodeInt(w, lr.Limit)
+	if err != nil {
+		return fmt.Errorf("encode ListRoomsPageRequest.Limit: %w", err)
+	}
+
+	return nil
+}
+
+func (lr *ListRoomsPageRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &lr.User)
+	if err != nil {
+		return fmt.Errorf("decode ListRoomsPageRequest.User: %w", err)
+	}
+
+	err = decodeString(r, &lr.Filter)
+	if err != nil {
+		return fmt.Errorf("decode ListRoomsPageRequest.Filter: %w", err)
+	}
+
+	err = decodeListOrder(r, &lr.Order)
+	if err != nil {
+		return fmt.Errorf("decode ListRoomsPageRequest.Order: %w", err)
+	}
+
+	err = decodeString(r, &lr.Cursor)
+	if err != nil {
+		return fmt.Errorf("decode ListRoomsPageRequest.Cursor: %w", err)
+	}
+
+	err = decodeInt(r, &lr.Limit)
+	if err != nil {
+		return fmt.Errorf("decode ListRoomsPageRequest.Limit: %w", err)
+	}
+
+	return nil
+}
+
+// A ListUsersPageRequest should be sent by the client to obtain one page of a sorted and filtered list of users.
+//   - The server MUST respond with an error message or a UserPageResponse.
+//   - The server MUST respond with an InvalidFilter error if the filter is not a valid pattern.
+type ListUsersPageRequest struct {
+	// The name of the room to list the users of.
+	//   - If the room name is empty, the server MUST list the users of the entire server.
+	//   - If the client user has not joined the room, the server MUST respond with a NotInRoom error.
+	Room   string
+	Filter string    // A prefix or glob pattern that the names of the entries must match, ignoring case. Empty to match every name.
+	Order  ListOrder // The order of the entries.
+	Cursor string    // The Next value of the previous page. Empty for the first page.
+	Limit  uint32    // The maximum number of entries. Zero for the server's default. The server MAY return fewer.
+}
+
+func (*ListUsersPageRequest) RequestType() RequestType { return ListUsersPage }
+
+func (lu *ListUsersPageRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, lu.Room)
+	if err != nil {
+		return fmt.Errorf("encode ListUsersPageRequest.Room: %w", err)
+	}
+
+	err = encodeString(w, lu.Filter)
+	if err != nil {
+		return fmt.Errorf("encode ListUsersPageRequest.Filter: %w", err)
+	}
+
+	err = encodeListOrder(w, lu.Order)
+	if err != nil {
+		return fmt.Errorf("encode ListUsersPageRequest.Order: %w", err)
+	}
+
+	err = encodeString(w, lu.Cursor)
+	if err != nil {
+		return fmt.Errorf("encode ListUsersPageRequest.Cursor: %w", err)
+	}
+
+	err = encodeInt(w, lu.Limit)
+	if err != nil {
+		return fmt.Errorf("encode ListUsersPageRequest.Limit: %w", err)
+	}
+
+	return nil
+}
+
+func (lu *ListUsersPageRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &lu.Room)
+	if err != nil {
+		return fmt.Errorf("decode ListUsersPageRequest.Room: %w", err)
+	}
+
+	err = decodeString(r, &lu.Filter)
+	if err != nil {
+		return fmt.Errorf("decode ListUsersPageRequest.Filter: %w", err)
+	}
+
+	err = decodeListOrder(r, &lu.Order)
+	if err != nil {
+		return fmt.Errorf("decode ListUsersPageRequest.Order: %w", err)
+	}
+
+	err = decodeString(r, &lu.Cursor)
+	if err != nil {
+		return fmt.Errorf("decode ListUsersPageRequest.Cursor: %w", err)
+	}
+
+	err = decodeInt(r, &lu.Limit)
+	if err != nil {
+		return fmt.Errorf("decode ListUsersPageRequest.Limit: %w", err)
+	}
+
+	return nil
+}
+
+// A SubscribeRequest should be sent by the client to receive the chat messages of the rooms
+// whose names match a glob pattern, without joining the rooms.
+//   - The server MUST respond with a SubscriptionListResponse or an error message.
+//   - The server MUST respond with an InvalidFilter error if the pattern is not valid.
+//   - The server MUST only send the chat messages of rooms that the client user is allowed to monitor.
+//     Server administrators can monitor every room, and other users the rooms they are an operator of.
+//   - The server MUST respond with a PermissionDenied error if the client user is not allowed to monitor
+//     any room that matches the pattern.
+//   - The server MUST NOT list the client user as a member of the rooms it monitors.
+//   - Subscriptions belong to the connection and end when it is closed.
+type SubscribeRequest struct {
+	Pattern string // A prefix or glob pattern that the names of the rooms must match, ignoring case, as in list filters.
+}
+
+func (*SubscribeRequest) RequestType() RequestType { return Subscribe }
+
+func (s *SubscribeRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, s.Pattern)
+	if err != nil {
+		return fmt.Errorf("encode SubscribeRequest.Pattern: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SubscribeRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &s.Pattern)
+	if err != nil {
+		return fmt.Errorf("decode SubscribeRequest.Pattern: %w", err)
+	}
+
+	return nil
+}
+
+// An UnsubscribeRequest should be sent by the client to end a subscription.
+//   - The server MUST respond with a SubscriptionListResponse.
+type UnsubscribeRequest struct {
+	Pattern string // The pattern of the subscription to end. Empty to end every subscription.
+}
+
+func (*UnsubscribeRequest) RequestType() RequestType { return Unsubscribe }
+
+func (u *UnsubscribeRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, u.Pattern)
+	if err != nil {
+		return fmt.Errorf("encode UnsubscribeRequest.Pattern: %w", err)
+	}
+
+	return nil
+}
+
+func (u *UnsubscribeRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &u.Pattern)
+	if err != nil {
+		return fmt.Errorf("decode UnsubscribeRequest.Pattern: %w", err)
+	}
+
+	return nil
+}
+
+// A GetMOTDRequest should be sent by the client to obtain the server's message of the day.
+//   - The server MUST respond with a MOTDResponse.
+type GetMOTDRequest struct{}
+
+func (*GetMOTDRequest) RequestType() RequestType { return GetMOTD }
+
+func (*GetMOTDRequest) encodeRequest(io.Writer) error { return nil }
+
+func (*GetMOTDRequest) decodeRequest(io.Reader) error { return nil }
+
+// A GetServerInfoRequest should be sent by the client to obtain information about the server.
+//   - The server MUST respond with a ServerInfoResponse.
+type GetServerInfoRequest struct{}
+
+func (*GetServerInfoRequest) RequestType() RequestType { return GetServerInfo }
+
+func (*GetServerInfoRequest) encodeRequest(io.Writer) error { return nil }
+
+func (*GetServerInfoRequest) decodeRequest(io.Reader) error { return nil }
+
+// An AnnounceRequest should be sent by the client to broadcast an announcement from a server administrator.
+//   - The server MUST respond with a PermissionDenied error if the client user is not a server administrator.
+//   - The server MUST respond with a MissingRoom error if one of the rooms does not exist.
+//   - The server MUST send an AnnouncementResponse to every connected user, or to every member of the rooms,
+//     when the announcement is made.
+//   - The server MUST respond with a ScheduledResponse if the announcement is scheduled.
+//   - The server MUST NOT make a scheduled announcement if the client user is no longer a server administrator.
+//   - The server MUST keep the scheduled announcements of a registered user when it disconnects,
+//     and MUST cancel those of a guest when it disconnects from every client.
+type AnnounceRequest struct {
+	Count uint32    // The number of rooms.
+	Rooms []string  // The rooms whose members receive the announcement. Empty to announce to every connected user.
+	Text  string    // The text of the announcement.
+	At    time.Time // When to make the announcement. The Unix epoch to make it immediately.
+}
+
+func (*AnnounceRequest) RequestType() RequestType { return Announce }
+
+func (a *AnnounceRequest) encodeRequest(w io.Writer) error {
+	count := uint32(len(a.Rooms))
+	err := encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode AnnounceRequest.Count: %w", err)
+	}
+
+	for i, room := range a.Rooms {
+		err = encodeString(w, room)
+		if err != nil {
+			return fmt.Errorf("encode AnnounceRequest.Rooms[%d]: %w", i, err)
+		}
+	}
+
+	err = encodeString(w, a.Text)
+	if err != nil {
+		return fmt.Errorf("encode AnnounceRequest.Text: %w", err)
+	}
+
+	err = encodeTime(w, a.At)
+	if err != nil {
+		return fmt.Errorf("encode AnnounceRequest.At: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AnnounceRequest) decodeRequest(r io.Reader) error {
+	err := decodeInt(r, &a.Count)
+	if err != nil {
+		return fmt.Errorf("decode AnnounceRequest.Count: %w", err)
+	}
+
+	// Rooms grows as they are decoded because the count is not checked before login.
+	a.Rooms = nil
+	for i := uint32(0); i < a.Count; i++ {
+		var room string
+		err = decodeString(r, &room)
+		if err != nil {
+			return fmt.Errorf("decode AnnounceRequest.Rooms[%d]: %w", i, err)
+		}
+		a.Rooms = append(a.Rooms, room)
+	}
+
+	err = decodeString(r, &a.Text)
+	if err != nil {
+		return fmt.Errorf("decode AnnounceRequest.Text: %w", err)
+	}
+
+	err = decodeTime(r, &a.At)
+	if err != nil {
+		return fmt.Errorf("decode AnnounceRequest.At: %w", err)
+	}
+
+	return nil
+}
+
+// A ScheduleMessageRequest should be sent by the client to have the server send a chat message to a room later.
+//   - The server MUST respond with a ScheduledResponse or an error message.
+//   - The server MUST check the room and text like a MessageRoomRequest when the chat message is scheduled,
+//     and MUST drop the chat message if the room was removed, or if the client user is connected
+//     and can no longer post to the room, when it is sent.
+//   - The server MUST keep the scheduled chat messages of a registered user when it disconnects,
+//     and MUST cancel those of a guest when it disconnects from every client.
+type ScheduleMessageRequest struct {
+	Room string    // The name of the room to send the chat message to.
+	Text string    // The text of the chat message.
+	At   time.Time // When to send the chat message. A time in the past sends it immediately.
+}
+
+func (*ScheduleMessageRequest) RequestType() RequestType { return ScheduleMessage }
+
+func (sm *ScheduleMessageRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, sm.Room)
+	if err != nil {
+		return fmt.Errorf("encode ScheduleMessageRequest.Room: %w", err)
+	}
+
+	err = encodeString(w, sm.Text)
+	if err != nil {
+		return fmt.Errorf("encode ScheduleMessageRequest.Text: %w", err)
+	}
+
+	err = encodeTime(w, sm.At)
+	if err != nil {
+		return fmt.Errorf("encode ScheduleMessageRequest.At: %w", err)
+	}
+
+	return nil
+}
+
+func (sm *ScheduleMessageRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &sm.Room)
+	if err != nil {
+		return fmt.Errorf("decode ScheduleMessageRequest.Room: %w", err)
+	}
+
+	err = decodeString(r, &sm.Text)
+	if err != nil {
+		return fmt.Errorf("decode ScheduleMessageRequest.Text: %w", err)
+	}
+
+	err = decodeTime(r, &sm.At)
+	if err != nil {
+		return fmt.Errorf("decode ScheduleMessageRequest.At: %w", err)
+	}
+
+	return nil
+}
+
+// Retention limits the chat messages of a room that the server keeps. Zero fields are unlimited.
+//   - The server MUST delete the oldest chat messages of the room that exceed any of the limits.
+//   - The server MAY delete chat messages some time after they exceed a limit.
+type Retention struct {
+	MaxAge      uint32 // The number of seconds that chat messages are kept.
+	MaxMessages uint32 // The number of the latest chat messages that are kept.
+	MaxBytes    uint32 // The number of bytes of text of the latest chat messages that are kept.
+}
+
+func encodeRetention(w io.Writer, rt Retention) error {
+	err := encodeInt(w, rt.MaxAge)
+	if err != nil {
+		return fmt.Errorf("encode Retention.MaxAge: %w", err)
+	}
+
+	err = encodeInt(w, rt.MaxMessages)
+	if err != nil {
+		return fmt.Errorf("encode Retention.MaxMessages: %w", err)
+	}
+
+	err = encodeInt(w, rt.MaxBytes)
+	if err != nil {
+		return fmt.Errorf("encode Retention.MaxBytes: %w", err)
+	}
+
+	return nil
+}
+
+func decodeRetention(r io.Reader, rt *Retention) error {
+	err := decodeInt(r, &rt.MaxAge)
+	if err != nil {
+		return fmt.Errorf("decode Retention.MaxAge: %w", err)
+	}
+
+	err = decodeInt(r, &rt.MaxMessages)
+	if err != nil {
+		return fmt.Errorf("decode Retention.MaxMessages: %w", err)
+	}
+
+	err = decodeInt(r, &rt.MaxBytes)
+	if err != nil {
+		return fmt.Errorf("decode Retention.MaxBytes: %w", err)
+	}
+
+	return nil
+}
+
+// A SetRetentionRequest should be sent by the client to change how long the server keeps the chat messages of a room.
+//   - The server MUST respond with a RoomDetailsResponse or an error message.
+//   - The server MUST respond with a PermissionDenied error if the client user is not an operator of the room.
+//   - The server MAY enforce a server-wide retention that is stricter than the retention of the room.
+type SetRetentionRequest struct {
+	Room      string    // The name of the room.
+	Retention Retention // The new retention of the room. Zero fields remove the limits of the room.
+}
+
+func (*SetRetentionRequest) RequestType() RequestType { return SetRetention }
+
+func (sr *SetRetentionRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, sr.Room)
+	if err != nil {
+		return fmt.Errorf("encode SetRetentionRequest.Room: %w", err)
+	}
+
+	err = encodeRetention(w, sr.Retention)
+	if err != nil {
+		return fmt.Errorf("encode SetRetentionRequest.Retention: %w", err)
+	}
+
+	return nil
+}
+
+func (sr *SetRetentionRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &sr.Room)
+	if err != nil {
+		return fmt.Errorf("decode SetRetentionRequest.Room: %w", err)
+	}
+
+	err = decodeRetention(r, &sr.Retention)
+	if err != nil {
+		return fmt.Errorf("decode SetRetentionRequest.Retention: %w", err)
+	}
+
+	return nil
+}
+
+// A DescribeRoomRequest should be sent by the client to obtain the details of a room.
+//   - The server MUST respond with a RoomDetailsResponse or an error message.
+type DescribeRoomRequest struct {
+	Room string // The name of the room.
+}
+
+func (*DescribeRoomRequest) RequestType() RequestType { return DescribeRoom }
+
+func (d *DescribeRoomRequest) encodeRequest(w io.Writer) error {
+	err := encodeString(w, d.Room)
+	if err != nil {
+		return fmt.Errorf("encode DescribeRoomRequest.Room: %w", err)
+	}
+
+	return nil
+}
+
+func (d *DescribeRoomRequest) decodeRequest(r io.Reader) error {
+	err := decodeString(r, &d.Room)
+	if err != nil {
+		return fmt.Errorf("decode DescribeRoomRequest.Room: %w", err)
+	}
+
+	return nil
+}
+
+// A ListScheduledRequest should be sent by the client to obtain the chat messages and announcements
+// that the client user scheduled and that the server has not sent yet.
+//   - The server MUST respond with a ScheduledListResponse.
+type ListScheduledRequest struct{}
+
+func (*ListScheduledRequest) RequestType() RequestType { return ListScheduled }
+
+func (*ListScheduledRequest) encodeRequest(io.Writer) error { return nil }
+
+func (*ListScheduledRequest) decodeRequest(io.Reader) error { return nil }
+
+// A CancelScheduledRequest should be sent by the client to cancel a chat message or announcement
+// that the client user scheduled.
+//   - The server MUST respond with a ScheduledListResponse of the remaining items or an error message.
+//   - The server MUST respond with a MissingScheduled error if the client user has no scheduled item with the ID.
+type CancelScheduledRequest struct {
+	ID uint32 // The ID from the ScheduledResponse.
+}
+
+func (*CancelScheduledRequest) RequestType() RequestType { return CancelScheduled }
+
+func (cs *CancelScheduledRequest) encodeRequest(w io.Writer) error {
+	err := encodeInt(w, cs.ID)
+	if err != nil {
+		return fmt.Errorf("encode CancelScheduledRequest.ID: %w", err)
+	}
+
+	return nil
+}
+
+func (cs *CancelScheduledRequest) decodeRequest(r io.Reader) error {
+	err := decodeInt(r, &cs.ID)
+	if err != nil {
+		return fmt.Errorf("decode CancelScheduledRequest.ID: %w", err)
+	}
+
+	return nil
+}
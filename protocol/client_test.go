@@ -4,10 +4,53 @@ import (
 	"bytes"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/mnxn/chat/generic"
 )
 
+var roomOptionTests = []struct {
+	RoomOption
+	bytes []byte
+}{
+	{AllowOutsidePosts, []byte{
+		0, 0, 0, 1, // uint32(1)
+	}},
+	{Lifetime, []byte{
+		0, 0, 0, 2, // uint32(2)
+	}},
+	{GracePeriod, []byte{
+		0, 0, 0, 3, // uint32(3)
+	}},
+}
+
+var listOrderTests = []struct {
+	ListOrder
+	bytes []byte
+}{
+	{OrderByName, []byte{
+		0, 0, 0, 0, // uint32(0)
+	}},
+	{OrderBySize, []byte{
+		0, 0, 0, 1, // uint32(1)
+	}},
+}
+
+var presenceTests = []struct {
+	Presence
+	bytes []byte
+}{
+	{Online, []byte{
+		0, 0, 0, 0, // uint32(0)
+	}},
+	{Away, []byte{
+		0, 0, 0, 1, // uint32(1)
+	}},
+	{DoNotDisturb, []byte{
+		0, 0, 0, 2, // uint32(2)
+	}},
+}
+
 var clientRequestTests = []struct {
 	ClientRequest
 	bytes []byte
@@ -141,6 +184,622 @@ var clientRequestTests = []struct {
 			108, 101, 97, 118, 101, // "leave"
 		},
 	},
+
+	{
+		&BlockRequest{
+			User: "",
+		},
+		[]byte{
+			0, 0, 0, 10, // Block
+			0, 0, 0, 0, // uint32(0)
+		},
+	},
+	{
+		&BlockRequest{
+			User: "spam",
+		},
+		[]byte{
+			0, 0, 0, 10, // Block
+
+			0, 0, 0, 4, // uint32(4)
+			115, 112, 97, 109, // "spam"
+		},
+	},
+
+	{
+		&UnblockRequest{
+			User: "spam",
+		},
+		[]byte{
+			0, 0, 0, 11, // Unblock
+
+			0, 0, 0, 4, // uint32(4)
+			115, 112, 97, 109, // "spam"
+		},
+	},
+
+	{
+		&ListBlocksRequest{},
+		[]byte{
+			0, 0, 0, 12, // ListBlocks
+		},
+	},
+
+	{
+		&SetRoomOptionRequest{
+			Room:   "room",
+			Option: AllowOutsidePosts,
+			Value:  1,
+		},
+		[]byte{
+			0, 0, 0, 13, // SetRoomOption
+
+			0, 0, 0, 4, // uint32(4)
+			114, 111, 111, 109, // "room"
+
+			0, 0, 0, 1, // AllowOutsidePosts
+			0, 0, 0, 1, // uint32(1)
+		},
+	},
+
+	{
+		&NegotiateRequest{
+			Capabilities: EchoMessages,
+		},
+		[]byte{
+			0, 0, 0, 14, // Negotiate
+			0, 0, 0, 1, // EchoMessages
+		},
+	},
+
+	{
+		&RegisterRequest{
+			Password: "pw",
+		},
+		[]byte{
+			0, 0, 0, 15, // Register
+
+			0, 0, 0, 2, // uint32(2)
+			112, 119, // "pw"
+		},
+	},
+
+	{
+		&LoginRequest{
+			Version:  1,
+			Name:     "me",
+			Password: "pw",
+		},
+		[]byte{
+			0, 0, 0, 16, // Login
+			0, 0, 0, 1, // uint32(1)
+
+			0, 0, 0, 2, // uint32(2)
+			109, 101, // "me"
+
+			0, 0, 0, 2, // uint32(2)
+			112, 119, // "pw"
+		},
+	},
+
+	{
+		&SetPresenceRequest{
+			Presence: Away,
+			Message:  "brb",
+		},
+		[]byte{
+			0, 0, 0, 17, // SetPresence
+			0, 0, 0, 1, // Away
+
+			0, 0, 0, 3, // uint32(3)
+			98, 114, 98, // "brb"
+		},
+	},
+	{
+		&TypingRequest{
+			Room: "abc",
+			User: "",
+		},
+		[]byte{
+			0, 0, 0, 18, // Typing
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 0, // uint32(0)
+		},
+	},
+	{
+		&ChangeNameRequest{
+			Name: "me",
+		},
+		[]byte{
+			0, 0, 0, 19, // ChangeName
+
+			0, 0, 0, 2, // uint32(2)
+			109, 101, // "me"
+		},
+	},
+
+	{
+		&EditMessageRequest{
+			ID:   7,
+			Text: "hi",
+		},
+		[]byte{
+			0, 0, 0, 20, // EditMessage
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+	{
+		&DeleteMessageRequest{
+			ID: 7,
+		},
+		[]byte{
+			0, 0, 0, 21, // DeleteMessage
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+		},
+	},
+
+	{
+		&ReplyRequest{
+			ReplyTo: 7,
+			Text:    "hi",
+		},
+		[]byte{
+			0, 0, 0, 22, // Reply
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+	{
+		&ListThreadRequest{
+			Root: 7,
+		},
+		[]byte{
+			0, 0, 0, 23, // ListThread
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+		},
+	},
+	{
+		&ReactRequest{
+			ID:       7,
+			Reaction: "ok",
+		},
+		[]byte{
+			0, 0, 0, 24, // React
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+
+			0, 0, 0, 2, // uint32(2)
+			111, 107, // "ok"
+		},
+	},
+	{
+		&UnreactRequest{
+			ID:       7,
+			Reaction: "ok",
+		},
+		[]byte{
+			0, 0, 0, 25, // Unreact
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+
+			0, 0, 0, 2, // uint32(2)
+			111, 107, // "ok"
+		},
+	},
+	{
+		&MarkReadRequest{
+			Room: "abc",
+			ID:   7,
+		},
+		[]byte{
+			0, 0, 0, 26, // MarkRead
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+		},
+	},
+	{
+		&ReadReceiptRequest{
+			ID: 7,
+		},
+		[]byte{
+			0, 0, 0, 27, // ReadReceipt
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+		},
+	},
+	{
+		&SearchMessagesRequest{
+			Query:  "hi",
+			Room:   "abc",
+			Sender: "",
+			After:  time.UnixMilli(1700000000123).UTC(),
+			Before: time.UnixMilli(0).UTC(),
+			Cursor: 7,
+			Limit:  20,
+		},
+		[]byte{
+			0, 0, 0, 28, // SearchMessages
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 1, 139, 207, 229, 104, 123, // uint64(1700000000123)
+
+			0, 0, 0, 0, 0, 0, 0, 0, // uint64(0)
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+
+			0, 0, 0, 20, // uint32(20)
+		},
+	},
+	{
+		&SetTopicRequest{
+			Room:  "abc",
+			Topic: "hi",
+		},
+		[]byte{
+			0, 0, 0, 29, // SetTopic
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+	{
+		&ListRoomsPageRequest{
+			User:   "",
+			Filter: "a*",
+			Order:  OrderBySize,
+			Cursor: "abc",
+			Limit:  20,
+		},
+		[]byte{
+			0, 0, 0, 30, // ListRoomsPage
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 2, // uint32(2)
+			97, 42, // "a*"
+
+			0, 0, 0, 1, // OrderBySize
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 20, // uint32(20)
+		},
+	},
+	{
+		&ListUsersPageRequest{
+			Room:   "abc",
+			Filter: "",
+			Order:  OrderByName,
+			Cursor: "",
+			Limit:  0,
+		},
+		[]byte{
+			0, 0, 0, 31, // ListUsersPage
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 0, // OrderByName
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 0, // uint32(0)
+		},
+	},
+	{
+		&SubscribeRequest{
+			Pattern: "a*",
+		},
+		[]byte{
+			0, 0, 0, 32, // Subscribe
+
+			0, 0, 0, 2, // uint32(2)
+			97, 42, // "a*"
+		},
+	},
+	{
+		&UnsubscribeRequest{
+			Pattern: "",
+		},
+		[]byte{
+			0, 0, 0, 33, // Unsubscribe
+
+			0, 0, 0, 0, // uint32(0)
+		},
+	},
+	{
+		&GetMOTDRequest{},
+		[]byte{
+			0, 0, 0, 34, // GetMOTD
+		},
+	},
+	{
+		&GetServerInfoRequest{},
+		[]byte{
+			0, 0, 0, 35, // GetServerInfo
+		},
+	},
+	{
+		&AnnounceRequest{
+			Count: 1,
+			Rooms: []string{"abc"},
+			Text:  "hi",
+			At:    time.UnixMilli(0).UTC(),
+		},
+		[]byte{
+			0, 0, 0, 36, // Announce
+
+			0, 0, 0, 1, // uint32(1)
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+
+			0, 0, 0, 0, 0, 0, 0, 0, // uint64(0)
+		},
+	},
+	{
+		&ScheduleMessageRequest{
+			Room: "abc",
+			Text: "hi",
+			At:   time.UnixMilli(1700000000123).UTC(),
+		},
+		[]byte{
+			0, 0, 0, 37, // ScheduleMessage
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+
+			0, 0, 1, 139, 207, 229, 104, 123, // uint64(1700000000123)
+		},
+	},
+	{
+		&SetRetentionRequest{
+			Room: "abc",
+			Retention: Retention{
+				MaxAge:      86400,
+				MaxMessages: 100,
+				MaxBytes:    0,
+			},
+		},
+		[]byte{
+			0, 0, 0, 38, // SetRetention
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 1, 81, 128, // uint32(86400)
+
+			0, 0, 0, 100, // uint32(100)
+
+			0, 0, 0, 0, // uint32(0)
+		},
+	},
+	{
+		&DescribeRoomRequest{
+			Room: "abc",
+		},
+		[]byte{
+			0, 0, 0, 39, // DescribeRoom
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+		},
+	},
+	{
+		&ListScheduledRequest{},
+		[]byte{
+			0, 0, 0, 40, // ListScheduled
+		},
+	},
+	{
+		&CancelScheduledRequest{
+			ID: 3,
+		},
+		[]byte{
+			0, 0, 0, 41, // CancelScheduled
+
+			0, 0, 0, 3, // uint32(3)
+		},
+	},
+}
+
+func TestEncodeRoomOption(t *testing.T) {
+	t.Parallel()
+
+	for i := range roomOptionTests {
+		test := roomOptionTests[i]
+		t.Run("encodeRoomOption", func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			err := encodeRoomOption(&buf, test.RoomOption)
+			if !generic.TestError(t, "encode", test.RoomOption, nil, err) {
+				return
+			}
+			actual := buf.Bytes()
+
+			generic.TestEqual(t, "encode", test.RoomOption, test.bytes, actual)
+		})
+	}
+
+	t.Run("encodeRoomOption", func(t *testing.T) {
+		t.Parallel()
+
+		invalidValue := RoomOption(1000)
+		err := encodeRoomOption(io.Discard, invalidValue)
+		generic.TestError(t, "encode", invalidValue, ErrInvalidRoomOption, err)
+	})
+}
+
+func TestDecodeRoomOption(t *testing.T) {
+	t.Parallel()
+
+	for i := range roomOptionTests {
+		test := roomOptionTests[i]
+		t.Run("decodeRoomOption", func(t *testing.T) {
+			t.Parallel()
+
+			var actual RoomOption
+			err := decodeRoomOption(bytes.NewReader(test.bytes), &actual)
+			if !generic.TestError(t, "decode", test.bytes, nil, err) {
+				return
+			}
+
+			generic.TestEqual(t, "decode", test.bytes, test.RoomOption, actual)
+		})
+	}
+
+	t.Run("decodeRoomOption", func(t *testing.T) {
+		t.Parallel()
+
+		invalidBytes := []byte{0xFF, 0xFF, 0xFF, 0xFF}
+		err := decodeRoomOption(bytes.NewBuffer(invalidBytes), new(RoomOption))
+		generic.TestError(t, "decode", invalidBytes, ErrInvalidRoomOption, err)
+	})
+}
+
+func TestEncodeListOrder(t *testing.T) {
+	t.Parallel()
+
+	for i := range listOrderTests {
+		test := listOrderTests[i]
+		t.Run("encodeListOrder", func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			err := encodeListOrder(&buf, test.ListOrder)
+			if !generic.TestError(t, "encode", test.ListOrder, nil, err) {
+				return
+			}
+			actual := buf.Bytes()
+
+			generic.TestEqual(t, "encode", test.ListOrder, test.bytes, actual)
+		})
+	}
+
+	t.Run("encodeListOrder", func(t *testing.T) {
+		t.Parallel()
+
+		invalidValue := ListOrder(1000)
+		err := encodeListOrder(io.Discard, invalidValue)
+		generic.TestError(t, "encode", invalidValue, ErrInvalidListOrder, err)
+	})
+}
+
+func TestDecodeListOrder(t *testing.T) {
+	t.Parallel()
+
+	for i := range listOrderTests {
+		test := listOrderTests[i]
+		t.Run("decodeListOrder", func(t *testing.T) {
+			t.Parallel()
+
+			var actual ListOrder
+			err := decodeListOrder(bytes.NewReader(test.bytes), &actual)
+			if !generic.TestError(t, "decode", test.bytes, nil, err) {
+				return
+			}
+
+			generic.TestEqual(t, "decode", test.bytes, test.ListOrder, actual)
+		})
+	}
+
+	t.Run("decodeListOrder", func(t *testing.T) {
+		t.Parallel()
+
+		invalidBytes := []byte{0xFF, 0xFF, 0xFF, 0xFF}
+		err := decodeListOrder(bytes.NewBuffer(invalidBytes), new(ListOrder))
+		generic.TestError(t, "decode", invalidBytes, ErrInvalidListOrder, err)
+	})
+}
+
+func TestEncodePresence(t *testing.T) {
+	t.Parallel()
+
+	for i := range presenceTests {
+		test := presenceTests[i]
+		t.Run("encodePresence", func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			err := encodePresence(&buf, test.Presence)
+			if !generic.TestError(t, "encode", test.Presence, nil, err) {
+				return
+			}
+			actual := buf.Bytes()
+
+			generic.TestEqual(t, "encode", test.Presence, test.bytes, actual)
+		})
+	}
+
+	t.Run("encodePresence", func(t *testing.T) {
+		t.Parallel()
+
+		invalidValue := Presence(1000)
+		err := encodePresence(io.Discard, invalidValue)
+		generic.TestError(t, "encode", invalidValue, ErrInvalidPresence, err)
+	})
+}
+
+func TestDecodePresence(t *testing.T) {
+	t.Parallel()
+
+	for i := range presenceTests {
+		test := presenceTests[i]
+		t.Run("decodePresence", func(t *testing.T) {
+			t.Parallel()
+
+			var actual Presence
+			err := decodePresence(bytes.NewReader(test.bytes), &actual)
+			if !generic.TestError(t, "decode", test.bytes, nil, err) {
+				return
+			}
+
+			generic.TestEqual(t, "decode", test.bytes, test.Presence, actual)
+		})
+	}
+
+	t.Run("decodePresence", func(t *testing.T) {
+		t.Parallel()
+
+		invalidBytes := []byte{0xFF, 0xFF, 0xFF, 0xFF}
+		err := decodePresence(bytes.NewBuffer(invalidBytes), new(Presence))
+		generic.TestError(t, "decode", invalidBytes, ErrInvalidPresence, err)
+	})
 }
 
 func TestEncodeClientRequest(t *testing.T) {
@@ -203,3 +862,20 @@ func TestDecodeClientRequestSequential(t *testing.T) {
 
 	generic.TestEqual(t, "sequential", len(actual), expected, actual)
 }
+
+func TestDecodeAnnounceCount(t *testing.T) {
+	t.Parallel()
+
+	input := []byte{
+		0, 0, 0, 36, // Announce
+
+		255, 255, 255, 255, // uint32(4294967295)
+
+		0, 0, 0, 3, // uint32(3)
+		97, 98, 99, // "abc"
+	}
+
+	// A count larger than the rooms that follow fails when the input ends instead of allocating every room.
+	_, err := DecodeClientRequest(bytes.NewReader(input))
+	generic.TestError(t, "decode", input, io.EOF, err)
+}
@@ -9,6 +9,13 @@
 //
 //   - String data MUST be a valid sequence of UTF-8 bytes.
 //
+// # Booleans
+//
+// Boolean fields are represented as a 32-bit unsigned integer.
+//
+//   - False MUST be encoded as 0 and true MUST be encoded as 1.
+//   - Any other value is invalid.
+//
 // # Message Types
 //
 // The first field of each message is a field indicating the message type.
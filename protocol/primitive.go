@@ -5,10 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 	"unicode/utf8"
 )
 
-var ErrInvalidUtf8String = errors.New("invalid UTF-8 string")
+var (
+	ErrInvalidUtf8String = errors.New("invalid UTF-8 string")
+	ErrInvalidBool       = errors.New("invalid bool value")
+)
 
 var byteOrder = binary.BigEndian
 
@@ -30,6 +34,78 @@ func decodeInt[T ~uint32](r io.Reader, i *T) error {
 	return nil
 }
 
+func encodeLong[T ~uint64](w io.Writer, i T) error {
+	err := binary.Write(w, byteOrder, uint64(i))
+	if err != nil {
+		return fmt.Errorf("encode uint64: %w", err)
+	}
+
+	return nil
+}
+
+func decodeLong[T ~uint64](r io.Reader, i *T) error {
+	err := binary.Read(r, byteOrder, i)
+	if err != nil {
+		return fmt.Errorf("decode uint64: %w", err)
+	}
+
+	return nil
+}
+
+func encodeBool(w io.Writer, b bool) error {
+	var i uint32
+	if b {
+		i = 1
+	}
+
+	err := binary.Write(w, byteOrder, i)
+	if err != nil {
+		return fmt.Errorf("encode bool: %w", err)
+	}
+
+	return nil
+}
+
+func decodeBool(r io.Reader, b *bool) error {
+	var i uint32
+	err := binary.Read(r, byteOrder, &i)
+	if err != nil {
+		return fmt.Errorf("decode bool: %w", err)
+	}
+
+	switch i {
+	case 0:
+		*b = false
+	case 1:
+		*b = true
+	default:
+		return fmt.Errorf("decode bool(0x%08X): %w", i, ErrInvalidBool)
+	}
+
+	return nil
+}
+
+// Times are encoded as the number of milliseconds since the Unix epoch in UTC.
+func encodeTime(w io.Writer, t time.Time) error {
+	err := encodeLong(w, uint64(t.UnixMilli()))
+	if err != nil {
+		return fmt.Errorf("encode time: %w", err)
+	}
+
+	return nil
+}
+
+func decodeTime(r io.Reader, t *time.Time) error {
+	var ms uint64
+	err := decodeLong(r, &ms)
+	if err != nil {
+		return fmt.Errorf("decode time: %w", err)
+	}
+
+	*t = time.UnixMilli(int64(ms)).UTC()
+	return nil
+}
+
 func encodeString(w io.Writer, s string) error {
 	bytes := []byte(s)
 
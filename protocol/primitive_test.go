@@ -3,6 +3,7 @@ package protocol
 import (
 	"bytes"
 	"testing"
+	"time"
 	"unicode/utf8"
 
 	"github.com/mnxn/chat/generic"
@@ -68,6 +69,116 @@ func TestDecodeString(t *testing.T) {
 	}
 }
 
+var boolTests = []struct {
+	bool
+	bytes []byte
+}{
+	{false, []byte{
+		0, 0, 0, 0, // uint32(0)
+	}},
+	{true, []byte{
+		0, 0, 0, 1, // uint32(1)
+	}},
+}
+
+func TestEncodeBool(t *testing.T) {
+	t.Parallel()
+
+	for i := range boolTests {
+		test := boolTests[i]
+		t.Run("encodeBool", func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			err := encodeBool(&buf, test.bool)
+			if !generic.TestError(t, "encode", test.bool, nil, err) {
+				return
+			}
+			actual := buf.Bytes()
+
+			generic.TestEqual(t, "encode", test.bool, test.bytes, actual)
+		})
+	}
+}
+
+func TestDecodeBool(t *testing.T) {
+	t.Parallel()
+
+	for i := range boolTests {
+		test := boolTests[i]
+		t.Run("decodeBool", func(t *testing.T) {
+			t.Parallel()
+
+			var actual bool
+			err := decodeBool(bytes.NewReader(test.bytes), &actual)
+			if !generic.TestError(t, "decode", test.bytes, nil, err) {
+				return
+			}
+
+			generic.TestEqual(t, "decode", test.bytes, test.bool, actual)
+		})
+	}
+
+	t.Run("decodeBool", func(t *testing.T) {
+		t.Parallel()
+
+		invalidBytes := []byte{0, 0, 0, 2}
+		err := decodeBool(bytes.NewReader(invalidBytes), new(bool))
+		generic.TestError(t, "decode", invalidBytes, ErrInvalidBool, err)
+	})
+}
+
+var timeTests = []struct {
+	time.Time
+	bytes []byte
+}{
+	{time.UnixMilli(0).UTC(), []byte{
+		0, 0, 0, 0, 0, 0, 0, 0, // uint64(0)
+	}},
+	{time.UnixMilli(1700000000123).UTC(), []byte{
+		0, 0, 1, 139, 207, 229, 104, 123, // uint64(1700000000123)
+	}},
+}
+
+func TestEncodeTime(t *testing.T) {
+	t.Parallel()
+
+	for i := range timeTests {
+		test := timeTests[i]
+		t.Run("encodeTime", func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			err := encodeTime(&buf, test.Time)
+			if !generic.TestError(t, "encode", test.Time, nil, err) {
+				return
+			}
+			actual := buf.Bytes()
+
+			generic.TestEqual(t, "encode", test.Time, test.bytes, actual)
+		})
+	}
+}
+
+func TestDecodeTime(t *testing.T) {
+	t.Parallel()
+
+	for i := range timeTests {
+		test := timeTests[i]
+		t.Run("decodeTime", func(t *testing.T) {
+			t.Parallel()
+
+			var actual time.Time
+			err := decodeTime(bytes.NewReader(test.bytes), &actual)
+			if !generic.TestError(t, "decode", test.bytes, nil, err) {
+				return
+			}
+
+			generic.TestEqual(t, "decode", test.bytes, test.Time, actual)
+		})
+	}
+}
+
 func FuzzRoundtripString(f *testing.F) {
 	seeds := []string{"", "hello123!", "åßçœ®¥"}
 	for _, seed := range seeds {
@@ -11,6 +11,38 @@ type RequestVisitor interface {
 	CreateRoom(*CreateRoomRequest)
 	JoinRoom(*JoinRoomRequest)
 	LeaveRoom(*LeaveRoomRequest)
+	Block(*BlockRequest)
+	Unblock(*UnblockRequest)
+	ListBlocks(*ListBlocksRequest)
+	SetRoomOption(*SetRoomOptionRequest)
+	Negotiate(*NegotiateRequest)
+	Register(*RegisterRequest)
+	Login(*LoginRequest)
+	SetPresence(*SetPresenceRequest)
+	Typing(*TypingRequest)
+	ChangeName(*ChangeNameRequest)
+	EditMessage(*EditMessageRequest)
+	DeleteMessage(*DeleteMessageRequest)
+	Reply(*ReplyRequest)
+	ListThread(*ListThreadRequest)
+	React(*ReactRequest)
+	Unreact(*UnreactRequest)
+	MarkRead(*MarkReadRequest)
+	ReadReceipt(*ReadReceiptRequest)
+	SearchMessages(*SearchMessagesRequest)
+	SetTopic(*SetTopicRequest)
+	ListRoomsPage(*ListRoomsPageRequest)
+	ListUsersPage(*ListUsersPageRequest)
+	Subscribe(*SubscribeRequest)
+	Unsubscribe(*UnsubscribeRequest)
+	GetMOTD(*GetMOTDRequest)
+	GetServerInfo(*GetServerInfoRequest)
+	Announce(*AnnounceRequest)
+	ScheduleMessage(*ScheduleMessageRequest)
+	SetRetention(*SetRetentionRequest)
+	DescribeRoom(*DescribeRoomRequest)
+	ListScheduled(*ListScheduledRequest)
+	CancelScheduled(*CancelScheduledRequest)
 }
 
 func (k *KeepaliveRequest) Accept(v RequestVisitor) { v.Keepalive(k) }
@@ -27,3 +59,61 @@ func (mu *MessageUserRequest) Accept(v RequestVisitor) { v.MessageUser(mu) }
 func (cr *CreateRoomRequest) Accept(v RequestVisitor) { v.CreateRoom(cr) }
 func (jr *JoinRoomRequest) Accept(v RequestVisitor)   { v.JoinRoom(jr) }
 func (lr *LeaveRoomRequest) Accept(v RequestVisitor)  { v.LeaveRoom(lr) }
+
+func (b *BlockRequest) Accept(v RequestVisitor)       { v.Block(b) }
+func (u *UnblockRequest) Accept(v RequestVisitor)     { v.Unblock(u) }
+func (lb *ListBlocksRequest) Accept(v RequestVisitor) { v.ListBlocks(lb) }
+
+func (so *SetRoomOptionRequest) Accept(v RequestVisitor) { v.SetRoomOption(so) }
+
+func (n *NegotiateRequest) Accept(v RequestVisitor) { v.Negotiate(n) }
+
+func (rg *RegisterRequest) Accept(v RequestVisitor) { v.Register(rg) }
+func (l *LoginRequest) Accept(v RequestVisitor)     { v.Login(l) }
+
+func (sp *SetPresenceRequest) Accept(v RequestVisitor) { v.SetPresence(sp) }
+
+func (t *TypingRequest) Accept(v RequestVisitor) { v.Typing(t) }
+
+func (cn *ChangeNameRequest) Accept(v RequestVisitor) { v.ChangeName(cn) }
+
+func (em *EditMessageRequest) Accept(v RequestVisitor)   { v.EditMessage(em) }
+func (dm *DeleteMessageRequest) Accept(v RequestVisitor) { v.DeleteMessage(dm) }
+
+func (rp *ReplyRequest) Accept(v RequestVisitor)      { v.Reply(rp) }
+func (lt *ListThreadRequest) Accept(v RequestVisitor) { v.ListThread(lt) }
+
+func (re *ReactRequest) Accept(v RequestVisitor)   { v.React(re) }
+func (ur *UnreactRequest) Accept(v RequestVisitor) { v.Unreact(ur) }
+
+func (mr *MarkReadRequest) Accept(v RequestVisitor) { v.MarkRead(mr) }
+
+func (rr *ReadReceiptRequest) Accept(v RequestVisitor) { v.ReadReceipt(rr) }
+
+func (sm *SearchMessagesRequest) Accept(v RequestVisitor) { v.SearchMessages(sm) }
+
+func (st *SetTopicRequest) Accept(v RequestVisitor) { v.SetTopic(st) }
+
+func (lr *ListRoomsPageRequest) Accept(v RequestVisitor) { v.ListRoomsPage(lr) }
+
+func (lu *ListUsersPageRequest) Accept(v RequestVisitor) { v.ListUsersPage(lu) }
+
+func (s *SubscribeRequest) Accept(v RequestVisitor) { v.Subscribe(s) }
+
+func (u *UnsubscribeRequest) Accept(v RequestVisitor) { v.Unsubscribe(u) }
+
+func (g *GetMOTDRequest) Accept(v RequestVisitor) { v.GetMOTD(g) }
+
+func (g *GetServerInfoRequest) Accept(v RequestVisitor) { v.GetServerInfo(g) }
+
+func (a *AnnounceRequest) Accept(v RequestVisitor) { v.Announce(a) }
+
+func (sm *ScheduleMessageRequest) Accept(v RequestVisitor) { v.ScheduleMessage(sm) }
+
+func (sr *SetRetentionRequest) Accept(v RequestVisitor) { v.SetRetention(sr) }
+
+func (d *DescribeRoomRequest) Accept(v RequestVisitor) { v.DescribeRoom(d) }
+
+func (ls *ListScheduledRequest) Accept(v RequestVisitor) { v.ListScheduled(ls) }
+
+func (cs *CancelScheduledRequest) Accept(v RequestVisitor) { v.CancelScheduled(cs) }
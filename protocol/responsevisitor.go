@@ -7,6 +7,35 @@ type ResponseVisitor interface {
 	UserList(*UserListResponse)
 	RoomMessage(*RoomMessageResponse)
 	UserMessage(*UserMessageResponse)
+	BlockList(*BlockListResponse)
+	Capabilities(*CapabilitiesResponse)
+	UserMessageEcho(*UserMessageEchoResponse)
+	OfflineMessage(*OfflineMessageResponse)
+	MessageQueued(*MessageQueuedResponse)
+	PresenceList(*PresenceListResponse)
+	PresenceChange(*PresenceChangeResponse)
+	AutoReply(*AutoReplyResponse)
+	UserTyping(*UserTypingResponse)
+	NameChanged(*NameChangedResponse)
+	ChatMessage(*ChatMessageResponse)
+	MessageEdited(*MessageEditedResponse)
+	MessageDeleted(*MessageDeletedResponse)
+	Thread(*ThreadResponse)
+	ReactionList(*ReactionListResponse)
+	ReadMarker(*ReadMarkerResponse)
+	Receipt(*ReceiptResponse)
+	SearchResults(*SearchResultsResponse)
+	RoomPage(*RoomPageResponse)
+	UserPage(*UserPageResponse)
+	RoomEntryList(*RoomEntryListResponse)
+	UserEntryList(*UserEntryListResponse)
+	SubscriptionList(*SubscriptionListResponse)
+	MOTD(*MOTDResponse)
+	ServerInfo(*ServerInfoResponse)
+	Announcement(*AnnouncementResponse)
+	Scheduled(*ScheduledResponse)
+	RoomDetails(*RoomDetailsResponse)
+	ScheduledList(*ScheduledListResponse)
 }
 
 func (e *ErrorResponse) Accept(v ResponseVisitor)       { v.Error(e) }
@@ -15,5 +44,57 @@ func (fe *FatalErrorResponse) Accept(v ResponseVisitor) { v.FatalError(fe) }
 func (rl *RoomListResponse) Accept(v ResponseVisitor) { v.RoomList(rl) }
 func (ul *UserListResponse) Accept(v ResponseVisitor) { v.UserList(ul) }
 
-func (rm *RoomMessageResponse) Accept(v ResponseVisitor) { v.RoomMessage(rm) }
-func (um *UserMessageResponse) Accept(v ResponseVisitor) { v.UserMessage(um) }
+func (rm *RoomMessageResponse) Accept(v ResponseVisitor)      { v.RoomMessage(rm) }
+func (um *UserMessageResponse) Accept(v ResponseVisitor)      { v.UserMessage(um) }
+func (ume *UserMessageEchoResponse) Accept(v ResponseVisitor) { v.UserMessageEcho(ume) }
+
+func (bl *BlockListResponse) Accept(v ResponseVisitor) { v.BlockList(bl) }
+
+func (c *CapabilitiesResponse) Accept(v ResponseVisitor) { v.Capabilities(c) }
+
+func (om *OfflineMessageResponse) Accept(v ResponseVisitor) { v.OfflineMessage(om) }
+func (mq *MessageQueuedResponse) Accept(v ResponseVisitor)  { v.MessageQueued(mq) }
+
+func (pl *PresenceListResponse) Accept(v ResponseVisitor)   { v.PresenceList(pl) }
+func (pc *PresenceChangeResponse) Accept(v ResponseVisitor) { v.PresenceChange(pc) }
+func (ar *AutoReplyResponse) Accept(v ResponseVisitor)      { v.AutoReply(ar) }
+
+func (ut *UserTypingResponse) Accept(v ResponseVisitor) { v.UserTyping(ut) }
+
+func (nc *NameChangedResponse) Accept(v ResponseVisitor) { v.NameChanged(nc) }
+
+func (cm *ChatMessageResponse) Accept(v ResponseVisitor)    { v.ChatMessage(cm) }
+func (me *MessageEditedResponse) Accept(v ResponseVisitor)  { v.MessageEdited(me) }
+func (md *MessageDeletedResponse) Accept(v ResponseVisitor) { v.MessageDeleted(md) }
+
+func (th *ThreadResponse) Accept(v ResponseVisitor) { v.Thread(th) }
+
+func (rl *ReactionListResponse) Accept(v ResponseVisitor) { v.ReactionList(rl) }
+
+func (rm *ReadMarkerResponse) Accept(v ResponseVisitor) { v.ReadMarker(rm) }
+
+func (rc *ReceiptResponse) Accept(v ResponseVisitor) { v.Receipt(rc) }
+
+func (sr *SearchResultsResponse) Accept(v ResponseVisitor) { v.SearchResults(sr) }
+
+func (rp *RoomPageResponse) Accept(v ResponseVisitor) { v.RoomPage(rp) }
+
+func (up *UserPageResponse) Accept(v ResponseVisitor) { v.UserPage(up) }
+
+func (rl *RoomEntryListResponse) Accept(v ResponseVisitor) { v.RoomEntryList(rl) }
+
+func (ul *UserEntryListResponse) Accept(v ResponseVisitor) { v.UserEntryList(ul) }
+
+func (sl *SubscriptionListResponse) Accept(v ResponseVisitor) { v.SubscriptionList(sl) }
+
+func (m *MOTDResponse) Accept(v ResponseVisitor) { v.MOTD(m) }
+
+func (si *ServerInfoResponse) Accept(v ResponseVisitor) { v.ServerInfo(si) }
+
+func (a *AnnouncementResponse) Accept(v ResponseVisitor) { v.Announcement(a) }
+
+func (s *ScheduledResponse) Accept(v ResponseVisitor) { v.Scheduled(s) }
+
+func (rd *RoomDetailsResponse) Accept(v ResponseVisitor) { v.RoomDetails(rd) }
+
+func (sl *ScheduledListResponse) Accept(v ResponseVisitor) { v.ScheduledList(sl) }
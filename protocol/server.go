@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 )
 
 var (
@@ -54,6 +56,64 @@ func DecodeServerResponse(r io.Reader) (ServerResponse, error) {
 		response = new(RoomMessageResponse)
 	case UserMessage:
 		response = new(UserMessageResponse)
+	case BlockList:
+		response = new(BlockListResponse)
+	case Capabilities:
+		response = new(CapabilitiesResponse)
+	case UserMessageEcho:
+		response = new(UserMessageEchoResponse)
+	case OfflineMessage:
+		response = new(OfflineMessageResponse)
+	case MessageQueued:
+		response = new(MessageQueuedResponse)
+	case PresenceList:
+		response = new(PresenceListResponse)
+	case PresenceChange:
+		response = new(PresenceChangeResponse)
+	case AutoReply:
+		response = new(AutoReplyResponse)
+	case UserTyping:
+		response = new(UserTypingResponse)
+	case NameChanged:
+		response = new(NameChangedResponse)
+	case ChatMessage:
+		response = new(ChatMessageResponse)
+	case MessageEdited:
+		response = new(MessageEditedResponse)
+	case MessageDeleted:
+		response = new(MessageDeletedResponse)
+	case Thread:
+		response = new(ThreadResponse)
+	case ReactionList:
+		response = new(ReactionListResponse)
+	case ReadMarker:
+		response = new(ReadMarkerResponse)
+	case Receipt:
+		response = new(ReceiptResponse)
+	case SearchResults:
+		response = new(SearchResultsResponse)
+	case RoomPage:
+		response = new(RoomPageResponse)
+	case UserPage:
+		response = new(UserPageResponse)
+	case RoomEntryList:
+		response = new(RoomEntryListResponse)
+	case UserEntryList:
+		response = new(UserEntryListResponse)
+	case SubscriptionList:
+		response = new(SubscriptionListResponse)
+	case MOTD:
+		response = new(MOTDResponse)
+	case ServerInfo:
+		response = new(ServerInfoResponse)
+	case Announcement:
+		response = new(AnnouncementResponse)
+	case Scheduled:
+		response = new(ScheduledResponse)
+	case RoomDetails:
+		response = new(RoomDetailsResponse)
+	case ScheduledList:
+		response = new(ScheduledListResponse)
 	}
 
 	err = response.decodeResponse(r)
@@ -73,6 +133,35 @@ const (
 	UserList
 	RoomMessage
 	UserMessage
+	BlockList
+	Capabilities
+	UserMessageEcho
+	OfflineMessage
+	MessageQueued
+	PresenceList
+	PresenceChange
+	AutoReply
+	UserTyping
+	NameChanged
+	ChatMessage
+	MessageEdited
+	MessageDeleted
+	Thread
+	ReactionList
+	ReadMarker
+	Receipt
+	SearchResults
+	RoomPage
+	UserPage
+	RoomEntryList
+	UserEntryList
+	SubscriptionList
+	MOTD
+	ServerInfo
+	Announcement
+	Scheduled
+	RoomDetails
+	ScheduledList
 )
 
 func (r ResponseType) GoString() string {
@@ -89,6 +178,64 @@ func (r ResponseType) GoString() string {
 		return "RoomMessage"
 	case UserMessage:
 		return "UserMessage"
+	case BlockList:
+		return "BlockList"
+	case Capabilities:
+		return "Capabilities"
+	case UserMessageEcho:
+		return "UserMessageEcho"
+	case OfflineMessage:
+		return "OfflineMessage"
+	case MessageQueued:
+		return "MessageQueued"
+	case PresenceList:
+		return "PresenceList"
+	case PresenceChange:
+		return "PresenceChange"
+	case AutoReply:
+		return "AutoReply"
+	case UserTyping:
+		return "UserTyping"
+	case NameChanged:
+		return "NameChanged"
+	case ChatMessage:
+		return "ChatMessage"
+	case MessageEdited:
+		return "MessageEdited"
+	case MessageDeleted:
+		return "MessageDeleted"
+	case Thread:
+		return "Thread"
+	case ReactionList:
+		return "ReactionList"
+	case ReadMarker:
+		return "ReadMarker"
+	case Receipt:
+		return "Receipt"
+	case SearchResults:
+		return "SearchResults"
+	case RoomPage:
+		return "RoomPage"
+	case UserPage:
+		return "UserPage"
+	case RoomEntryList:
+		return "RoomEntryList"
+	case UserEntryList:
+		return "UserEntryList"
+	case SubscriptionList:
+		return "SubscriptionList"
+	case MOTD:
+		return "MOTD"
+	case ServerInfo:
+		return "ServerInfo"
+	case Announcement:
+		return "Announcement"
+	case Scheduled:
+		return "Scheduled"
+	case RoomDetails:
+		return "RoomDetails"
+	case ScheduledList:
+		return "ScheduledList"
 	default:
 		return fmt.Sprintf("ResponseType(%d)", r)
 	}
@@ -100,7 +247,26 @@ func encodeResponseType(w io.Writer, typ ResponseType) error {
 	switch typ {
 	case Error, FatalError,
 		RoomList, UserList,
-		RoomMessage, UserMessage:
+		RoomMessage, UserMessage,
+		BlockList,
+		Capabilities, UserMessageEcho,
+		OfflineMessage, MessageQueued,
+		PresenceList, PresenceChange, AutoReply,
+		UserTyping,
+		NameChanged,
+		ChatMessage, MessageEdited, MessageDeleted,
+		Thread,
+		ReactionList,
+		ReadMarker,
+		Receipt,
+		SearchResults,
+		RoomPage, UserPage,
+		RoomEntryList, UserEntryList,
+		SubscriptionList,
+		MOTD, ServerInfo,
+		Announcement, Scheduled,
+		RoomDetails,
+		ScheduledList:
 		break
 	default:
 		return fmt.Errorf("encode ResponseType(%d): %w", typ, ErrInvalidResponseType)
@@ -123,7 +289,26 @@ func decodeResponseType(r io.Reader, typ *ResponseType) error {
 	switch *typ {
 	case Error, FatalError,
 		RoomList, UserList,
-		RoomMessage, UserMessage:
+		RoomMessage, UserMessage,
+		BlockList,
+		Capabilities, UserMessageEcho,
+		OfflineMessage, MessageQueued,
+		PresenceList, PresenceChange, AutoReply,
+		UserTyping,
+		NameChanged,
+		ChatMessage, MessageEdited, MessageDeleted,
+		Thread,
+		ReactionList,
+		ReadMarker,
+		Receipt,
+		SearchResults,
+		RoomPage, UserPage,
+		RoomEntryList, UserEntryList,
+		SubscriptionList,
+		MOTD, ServerInfo,
+		Announcement, Scheduled,
+		RoomDetails,
+		ScheduledList:
 		break
 	default:
 		return fmt.Errorf("decode ResponseType(0x%08X): %w", uint32(*typ), ErrInvalidResponseType)
@@ -176,6 +361,42 @@ const (
 	// The client is attempting to send a chat message with text that does not satisfy the server's text content requirements.
 	//   - The server SHOULD include additional information that explains the text content requirements.
 	InvalidText
+
+	// The client is attempting to send a direct message to a user that has blocked the client user.
+	BlockedUser
+
+	// The request would exceed one of the server's configured limits.
+	//   - The server SHOULD include additional information that explains the limit.
+	//   - This error MUST be sent in a FatalError server message if it is a response to a ConnectRequest.
+	LimitReached
+
+	// The client is attempting to send a chat message to or list the users of a room that the client user has not joined.
+	//   - The server MAY allow users outside of a room to send chat messages to it. See AllowOutsidePosts.
+	NotInRoom
+
+	// The client user is not allowed to perform the request.
+	//   - The server SHOULD include additional information that explains the required permission.
+	PermissionDenied
+
+	// The client is attempting to log in with a name that is not registered or with the wrong password.
+	//   - This error MUST be sent in a FatalError server message.
+	AuthenticationFailed
+
+	// The message ID from the client was not found.
+	//   - The Info field SHOULD contain the message ID.
+	MissingMessage
+
+	// The client is attempting to react to a chat message with text that is not a valid reaction.
+	//   - The server SHOULD include additional information that explains the reaction requirements.
+	InvalidReaction
+
+	// The client is attempting to filter a list with a pattern that is not valid.
+	//   - The server SHOULD include the pattern as additional information.
+	InvalidFilter
+
+	// The ID of a scheduled chat message or announcement from the client was not found.
+	//   - The Info field SHOULD contain the ID.
+	MissingScheduled
 )
 
 func (e ErrorType) GoString() string {
@@ -204,6 +425,24 @@ func (e ErrorType) GoString() string {
 		return "InvalidUser"
 	case InvalidText:
 		return "InvalidText"
+	case BlockedUser:
+		return "BlockedUser"
+	case LimitReached:
+		return "LimitReached"
+	case NotInRoom:
+		return "NotInRoom"
+	case PermissionDenied:
+		return "PermissionDenied"
+	case AuthenticationFailed:
+		return "AuthenticationFailed"
+	case MissingMessage:
+		return "MissingMessage"
+	case InvalidReaction:
+		return "InvalidReaction"
+	case InvalidFilter:
+		return "InvalidFilter"
+	case MissingScheduled:
+		return "MissingScheduled"
 	default:
 		return fmt.Sprintf("ErrorType(%d)", e)
 	}
@@ -219,7 +458,13 @@ func encodeErrorType(w io.Writer, e ErrorType) error {
 		UnsupportedVersion,
 		MissingRoom, MissingUser,
 		ExistingRoom, ExistingUser,
-		InvalidRoom, InvalidUser, InvalidText:
+		InvalidRoom, InvalidUser, InvalidText,
+		BlockedUser, LimitReached,
+		NotInRoom, PermissionDenied, AuthenticationFailed,
+		MissingMessage,
+		InvalidReaction,
+		InvalidFilter,
+		MissingScheduled:
 		break
 	default:
 		return fmt.Errorf("encode ErrorType(%d): %w", e, ErrInvalidErrorType)
@@ -246,7 +491,13 @@ func decodeErrorType(r io.Reader, e *ErrorType) error {
 		UnsupportedVersion,
 		MissingRoom, MissingUser,
 		ExistingRoom, ExistingUser,
-		InvalidRoom, InvalidUser, InvalidText:
+		InvalidRoom, InvalidUser, InvalidText,
+		BlockedUser, LimitReached,
+		NotInRoom, PermissionDenied, AuthenticationFailed,
+		MissingMessage,
+		InvalidReaction,
+		InvalidFilter,
+		MissingScheduled:
 		break
 	default:
 		return fmt.Errorf("decode ErrorType(0x%08X): %w", uint32(*e), ErrInvalidErrorType)
@@ -516,3 +767,1866 @@ func (um *UserMessageResponse) decodeResponse(r io.Reader) error {
 
 	return nil
 }
+
+// A BlockListResponse is sent as a response to clients that ask for their block list.
+type BlockListResponse struct {
+	Strangers bool     // Whether direct messages from users that are not contacts are blocked.
+	Count     uint32   // The number of blocked users in the response.
+	Users     []string // The array of blocked user names.
+}
+
+func (*BlockListResponse) ResponseType() ResponseType { return BlockList }
+
+func (bl *BlockListResponse) encodeResponse(w io.Writer) error {
+	err := encodeBool(w, bl.Strangers)
+	if err != nil {
+		return fmt.Errorf("encode BlockListResponse.Strangers: %w", err)
+	}
+
+	count := uint32(len(bl.Users))
+	err = encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode BlockListResponse.Count: %w", err)
+	}
+
+	for i, user := range bl.Users {
+		err = encodeString(w, user)
+		if err != nil {
+			return fmt.Errorf("encode BlockListResponse.Users[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (bl *BlockListResponse) decodeResponse(r io.Reader) error {
+	err := decodeBool(r, &bl.Strangers)
+	if err != nil {
+		return fmt.Errorf("decode BlockListResponse.Strangers: %w", err)
+	}
+
+	err = decodeInt(r, &bl.Count)
+	if err != nil {
+		return fmt.Errorf("decode BlockListResponse.Count: %w", err)
+	}
+	bl.Users = make([]string, bl.Count)
+
+	for i := uint32(0); i < bl.Count; i++ {
+		err = decodeString(r, &bl.Users[i])
+		if err != nil {
+			return fmt.Errorf("decode BlockListResponse.Users[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// A CapabilitiesResponse is sent as a response to clients that negotiate capabilities.
+type CapabilitiesResponse struct {
+	Capabilities Capability // The requested capabilities that the server enabled for the connection.
+}
+
+func (*CapabilitiesResponse) ResponseType() ResponseType { return Capabilities }
+
+func (c *CapabilitiesResponse) encodeResponse(w io.Writer) error {
+	err := encodeInt(w, c.Capabilities)
+	if err != nil {
+		return fmt.Errorf("encode CapabilitiesResponse.Capabilities: %w", err)
+	}
+
+	return nil
+}
+
+func (c *CapabilitiesResponse) decodeResponse(r io.Reader) error {
+	err := decodeInt(r, &c.Capabilities)
+	if err != nil {
+		return fmt.Errorf("decode CapabilitiesResponse.Capabilities: %w", err)
+	}
+
+	return nil
+}
+
+// A UserMessageEchoResponse is sent to a client with the EchoMessages capability
+// when a direct message from the client user has been relayed.
+type UserMessageEchoResponse struct {
+	Recipient string // The name of the user that the direct message was sent to.
+	Text      string // The text content of the chat message as it was relayed.
+}
+
+func (*UserMessageEchoResponse) ResponseType() ResponseType { return UserMessageEcho }
+
+func (ume *UserMessageEchoResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, ume.Recipient)
+	if err != nil {
+		return fmt.Errorf("encode UserMessageEchoResponse.Recipient: %w", err)
+	}
+
+	err = encodeString(w, ume.Text)
+	if err != nil {
+		return fmt.Errorf("encode UserMessageEchoResponse.Text: %w", err)
+	}
+
+	return nil
+}
+
+func (ume *UserMessageEchoResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &ume.Recipient)
+	if err != nil {
+		return fmt.Errorf("decode UserMessageEchoResponse.Recipient: %w", err)
+	}
+
+	err = decodeString(r, &ume.Text)
+	if err != nil {
+		return fmt.Errorf("decode UserMessageEchoResponse.Text: %w", err)
+	}
+
+	return nil
+}
+
+// An OfflineMessageResponse is sent to a client with the OfflineMessages capability
+// for each direct message that was queued while the client user was offline.
+type OfflineMessageResponse struct {
+	Time   time.Time // The time that the server received the chat message.
+	Sender string    // The name of the user that sent the direct message.
+	Text   string    // The text content of the chat message.
+}
+
+func (*OfflineMessageResponse) ResponseType() ResponseType { return OfflineMessage }
+
+func (om *OfflineMessageResponse) encodeResponse(w io.Writer) error {
+	err := encodeTime(w, om.Time)
+	if err != nil {
+		return fmt.Errorf("encode OfflineMessageResponse.Time: %w", err)
+	}
+
+	err = encodeString(w, om.Sender)
+	if err != nil {
+		return fmt.Errorf("encode OfflineMessageResponse.Sender: %w", err)
+	}
+
+	err = encodeString(w, om.Text)
+	if err != nil {
+		return fmt.Errorf("encode OfflineMessageResponse.Text: %w", err)
+	}
+
+	return nil
+}
+
+func (om *OfflineMessageResponse) decodeResponse(r io.Reader) error {
+	err := decodeTime(r, &om.Time)
+	if err != nil {
+		return fmt.Errorf("decode OfflineMessageResponse.Time: %w", err)
+	}
+
+	err = decodeString(r, &om.Sender)
+	if err != nil {
+		return fmt.Errorf("decode OfflineMessageResponse.Sender: %w", err)
+	}
+
+	err = decodeString(r, &om.Text)
+	if err != nil {
+		return fmt.Errorf("decode OfflineMessageResponse.Text: %w", err)
+	}
+
+	return nil
+}
+
+// A MessageQueuedResponse is sent to a client with the OfflineMessages capability
+// when a direct message from the client user was queued because the recipient is offline.
+type MessageQueuedResponse struct {
+	Recipient string // The name of the registered user that the direct message was queued for.
+}
+
+func (*MessageQueuedResponse) ResponseType() ResponseType { return MessageQueued }
+
+func (mq *MessageQueuedResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, mq.Recipient)
+	if err != nil {
+		return fmt.Errorf("encode MessageQueuedResponse.Recipient: %w", err)
+	}
+
+	return nil
+}
+
+func (mq *MessageQueuedResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &mq.Recipient)
+	if err != nil {
+		return fmt.Errorf("decode MessageQueuedResponse.Recipient: %w", err)
+	}
+
+	return nil
+}
+
+// A UserPresence is an entry of a PresenceListResponse or a UserPageResponse.
+type UserPresence struct {
+	Name     string   // The name of the user.
+	Presence Presence // The presence of the user.
+	Message  string   // The status message of the user. May be empty.
+}
+
+// A PresenceListResponse is sent instead of a UserListResponse to a client with the PresenceUpdates capability.
+type PresenceListResponse struct {
+	Room  string         // The room the users are located in. Empty if the response is for the list of users in the entire server.
+	Count uint32         // The number of users in the room/server.
+	Users []UserPresence // The array of users.
+}
+
+func (*PresenceListResponse) ResponseType() ResponseType { return PresenceList }
+
+func (pl *PresenceListResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, pl.Room)
+	if err != nil {
+		return fmt.Errorf("encode PresenceListResponse.Room: %w", err)
+	}
+
+	count := uint32(len(pl.Users))
+	err = encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode PresenceListResponse.Count: %w", err)
+	}
+
+	for i, user := range pl.Users {
+		err = encodeString(w, user.Name)
+		if err != nil {
+			return fmt.Errorf("encode PresenceListResponse.Users[%d].Name: %w", i, err)
+		}
+
+		err = encodePresence(w, user.Presence)
+		if err != nil {
+			return fmt.Errorf("encode PresenceListResponse.Users[%d].Presence: %w", i, err)
+		}
+
+		err = encodeString(w, user.Message)
+		if err != nil {
+			return fmt.Errorf("encode PresenceListResponse.Users[%d].Message: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (pl *PresenceListResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &pl.Room)
+	if err != nil {
+		return fmt.Errorf("decode PresenceListResponse.Room: %w", err)
+	}
+
+	err = decodeInt(r, &pl.Count)
+	if err != nil {
+		return fmt.Errorf("decode PresenceListResponse.Count: %w", err)
+	}
+	pl.Users = make([]UserPresence, pl.Count)
+
+	for i := uint32(0); i < pl.Count; i++ {
+		err = decodeString(r, &pl.Users[i].Name)
+		if err != nil {
+			return fmt.Errorf("decode PresenceListResponse.Users[%d].Name: %w", i, err)
+		}
+
+		err = decodePresence(r, &pl.Users[i].Presence)
+		if err != nil {
+			return fmt.Errorf("decode PresenceListResponse.Users[%d].Presence: %w", i, err)
+		}
+
+		err = decodeString(r, &pl.Users[i].Message)
+		if err != nil {
+			return fmt.Errorf("decode PresenceListResponse.Users[%d].Message: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// A PresenceChangeResponse is sent to a client with the PresenceUpdates capability
+// when a user that shares a room with the client user changes presence.
+type PresenceChangeResponse struct {
+	User     string   // The name of the user whose presence changed.
+	Presence Presence // The new presence of the user.
+	Message  string   // The new status message of the user. May be empty.
+}
+
+func (*PresenceChangeResponse) ResponseType() ResponseType { return PresenceChange }
+
+func (pc *PresenceChangeResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, pc.User)
+	if err != nil {
+		return fmt.Errorf("encode PresenceChangeResponse.User: %w", err)
+	}
+
+	err = encodePresence(w, pc.Presence)
+	if err != nil {
+		return fmt.Errorf("encode PresenceChangeResponse.Presence: %w", err)
+	}
+
+	err = encodeString(w, pc.Message)
+	if err != nil {
+		return fmt.Errorf("encode PresenceChangeResponse.Message: %w", err)
+	}
+
+	return nil
+}
+
+func (pc *PresenceChangeResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &pc.User)
+	if err != nil {
+		return fmt.Errorf("decode PresenceChangeResponse.User: %w", err)
+	}
+
+	err = decodePresence(r, &pc.Presence)
+	if err != nil {
+		return fmt.Errorf("decode PresenceChangeResponse.Presence: %w", err)
+	}
+
+	err = decodeString(r, &pc.Message)
+	if err != nil {
+		return fmt.Errorf("decode PresenceChangeResponse.Message: %w", err)
+	}
+
+	return nil
+}
+
+// An AutoReplyResponse is sent to a client with the PresenceUpdates capability
+// when a direct message from the client user was delivered to a user that is not online.
+type AutoReplyResponse struct {
+	User     string   // The name of the user that the direct message was sent to.
+	Presence Presence // The presence of the user.
+	Message  string   // The status message of the user. May be empty.
+}
+
+func (*AutoReplyResponse) ResponseType() ResponseType { return AutoReply }
+
+func (ar *AutoReplyResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, ar.User)
+	if err != nil {
+		return fmt.Errorf("encode AutoReplyResponse.User: %w", err)
+	}
+
+	err = encodePresence(w, ar.Presence)
+	if err != nil {
+		return fmt.Errorf("encode AutoReplyResponse.Presence: %w", err)
+	}
+
+	err = encodeString(w, ar.Message)
+	if err != nil {
+		return fmt.Errorf("encode AutoReplyResponse.Message: %w", err)
+	}
+
+	return nil
+}
+
+func (ar *AutoReplyResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &ar.User)
+	if err != nil {
+		return fmt.Errorf("decode AutoReplyResponse.User: %w", err)
+	}
+
+	err = decodePresence(r, &ar.Presence)
+	if err != nil {
+		return fmt.Errorf("decode AutoReplyResponse.Presence: %w", err)
+	}
+
+	err = decodeString(r, &ar.Message)
+	if err != nil {
+		return fmt.Errorf("decode AutoReplyResponse.Message: %w", err)
+	}
+
+	return nil
+}
+
+// A UserTypingResponse is sent to a client with the TypingNotifications capability
+// when another user is composing a chat message to a room that the client user has joined or to the client user.
+type UserTypingResponse struct {
+	User string // The name of the user that is typing.
+	Room string // The name of the room that the user is typing in. Empty if the user is typing a direct message.
+}
+
+func (*UserTypingResponse) ResponseType() ResponseType { return UserTyping }
+
+func (ut *UserTypingResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, ut.User)
+	if err != nil {
+		return fmt.Errorf("encode UserTypingResponse.User: %w", err)
+	}
+
+	err = encodeString(w, ut.Room)
+	if err != nil {
+		return fmt.Errorf("encode UserTypingResponse.Room: %w", err)
+	}
+
+	return nil
+}
+
+func (ut *UserTypingResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &ut.User)
+	if err != nil {
+		return fmt.Errorf("decode UserTypingResponse.User: %w", err)
+	}
+
+	err = decodeString(r, &ut.Room)
+	if err != nil {
+		return fmt.Errorf("decode UserTypingResponse.Room: %w", err)
+	}
+
+	return nil
+}
+
+// A NameChangedResponse is sent to a client with the NameChanges capability
+// when the client user or a user that shares a room with the client user changes name.
+type NameChangedResponse struct {
+	OldName string // The previous name of the user.
+	NewName string // The new name of the user.
+}
+
+func (*NameChangedResponse) ResponseType() ResponseType { return NameChanged }
+
+func (nc *NameChangedResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, nc.OldName)
+	if err != nil {
+		return fmt.Errorf("encode NameChangedResponse.OldName: %w", err)
+	}
+
+	err = encodeString(w, nc.NewName)
+	if err != nil {
+		return fmt.Errorf("encode NameChangedResponse.NewName: %w", err)
+	}
+
+	return nil
+}
+
+func (nc *NameChangedResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &nc.OldName)
+	if err != nil {
+		return fmt.Errorf("decode NameChangedResponse.OldName: %w", err)
+	}
+
+	err = decodeString(r, &nc.NewName)
+	if err != nil {
+		return fmt.Errorf("decode NameChangedResponse.NewName: %w", err)
+	}
+
+	return nil
+}
+
+// A ChatMessageResponse is sent to a client with the MessageIDs capability for each chat message that it receives.
+//   - Room messages have a Room and no Recipient. Direct messages have a Recipient and no Room.
+//   - Chat messages from the client user are only sent if the client also has the EchoMessages capability.
+type ChatMessageResponse struct {
+	ID        MessageID // The ID that the server assigned to the chat message.
+	Time      time.Time // The time that the server received the chat message.
+	ReplyTo   MessageID // The ID of the chat message that this chat message replies to. Zero if it is not a reply.
+	Room      string    // The name of the room the chat message was sent to.
+	Sender    string    // The name of the user that sent the chat message.
+	Recipient string    // The name of the user that the direct message was sent to.
+	Text      string    // The text content of the chat message.
+}
+
+func (*ChatMessageResponse) ResponseType() ResponseType { return ChatMessage }
+
+func (cm *ChatMessageResponse) encodeResponse(w io.Writer) error {
+	err := encodeLong(w, cm.ID)
+	if err != nil {
+		return fmt.Errorf("encode ChatMessageResponse.ID: %w", err)
+	}
+
+	err = encodeTime(w, cm.Time)
+	if err != nil {
+		return fmt.Errorf("encode ChatMessageResponse.Time: %w", err)
+	}
+
+	err = encodeLong(w, cm.ReplyTo)
+	if err != nil {
+		return fmt.Errorf("encode ChatMessageResponse.ReplyTo: %w", err)
+	}
+
+	err = encodeString(w, cm.Room)
+	if err != nil {
+		return fmt.Errorf("encode ChatMessageResponse.Room: %w", err)
+	}
+
+	err = encodeString(w, cm.Sender)
+	if err != nil {
+		return fmt.Errorf("encode ChatMessageResponse.Sender: %w", err)
+	}
+
+	err = encodeString(w, cm.Recipient)
+	if err != nil {
+		return fmt.Errorf("encode ChatMessageResponse.Recipient: %w", err)
+	}
+
+	err = encodeString(w, cm.Text)
+	if err != nil {
+		return fmt.Errorf("encode ChatMessageResponse.Text: %w", err)
+	}
+
+	return nil
+}
+
+func (cm *ChatMessageResponse) decodeResponse(r io.Reader) error {
+	err := decodeLong(r, &cm.ID)
+	if err != nil {
+		return fmt.Errorf("decode ChatMessageResponse.ID: %w", err)
+	}
+
+	err = decodeTime(r, &cm.Time)
+	if err != nil {
+		return fmt.Errorf("decode ChatMessageResponse.Time: %w", err)
+	}
+
+	err = decodeLong(r, &cm.ReplyTo)
+	if err != nil {
+		return fmt.Errorf("decode ChatMessageResponse.ReplyTo: %w", err)
+	}
+
+	err = decodeString(r, &cm.Room)
+	if err != nil {
+		return fmt.Errorf("decode ChatMessageResponse.Room: %w", err)
+	}
+
+	err = decodeString(r, &cm.Sender)
+	if err != nil {
+		return fmt.Errorf("decode ChatMessageResponse.Sender: %w", err)
+	}
+
+	err = decodeString(r, &cm.Recipient)
+	if err != nil {
+		return fmt.Errorf("decode ChatMessageResponse.Recipient: %w", err)
+	}
+
+	err = decodeString(r, &cm.Text)
+	if err != nil {
+		return fmt.Errorf("decode ChatMessageResponse.Text: %w", err)
+	}
+
+	return nil
+}
+
+// A MessageEditedResponse is sent to a client with the MessageIDs capability
+// when the sender of a chat message that the client received has edited it.
+type MessageEditedResponse struct {
+	ID     MessageID // The ID of the edited chat message.
+	Time   time.Time // The time that the chat message was edited.
+	Room   string    // The name of the room the chat message was sent to. Empty for direct messages.
+	Sender string    // The name of the user that sent and edited the chat message.
+	Text   string    // The new text content of the chat message.
+}
+
+func (*MessageEditedResponse) ResponseType() ResponseType { return MessageEdited }
+
+func (me *MessageEditedResponse) encodeResponse(w io.Writer) error {
+	err := encodeLong(w, me.ID)
+	if err != nil {
+		return fmt.Errorf("encode MessageEditedResponse.ID: %w", err)
+	}
+
+	err = encodeTime(w, me.Time)
+	if err != nil {
+		return fmt.Errorf("encode MessageEditedResponse.Time: %w", err)
+	}
+
+	err = encodeString(w, me.Room)
+	if err != nil {
+		return fmt.Errorf("encode MessageEditedResponse.Room: %w", err)
+	}
+
+	err = encodeString(w, me.Sender)
+	if err != nil {
+		return fmt.Errorf("encode MessageEditedResponse.Sender: %w", err)
+	}
+
+	err = encodeString(w, me.Text)
+	if err != nil {
+		return fmt.Errorf("encode MessageEditedResponse.Text: %w", err)
+	}
+
+	return nil
+}
+
+func (me *MessageEditedResponse) decodeResponse(r io.Reader) error {
+	err := decodeLong(r, &me.ID)
+	if err != nil {
+		return fmt.Errorf("decode MessageEditedResponse.ID: %w", err)
+	}
+
+	err = decodeTime(r, &me.Time)
+	if err != nil {
+		return fmt.Errorf("decode MessageEditedResponse.Time: %w", err)
+	}
+
+	err = decodeString(r, &me.Room)
+	if err != nil {
+		return fmt.Errorf("decode MessageEditedResponse.Room: %w", err)
+	}
+
+	err = decodeString(r, &me.Sender)
+	if err != nil {
+		return fmt.Errorf("decode MessageEditedResponse.Sender: %w", err)
+	}
+
+	err = decodeString(r, &me.Text)
+	if err != nil {
+		return fmt.Errorf("decode MessageEditedResponse.Text: %w", err)
+	}
+
+	return nil
+}
+
+// A MessageDeletedResponse is sent to a client with the MessageIDs capability
+// when a chat message that the client received has been deleted.
+type MessageDeletedResponse struct {
+	ID   MessageID // The ID of the deleted chat message.
+	Room string    // The name of the room the chat message was sent to. Empty for direct messages.
+	User string    // The name of the user that deleted the chat message.
+}
+
+func (*MessageDeletedResponse) ResponseType() ResponseType { return MessageDeleted }
+
+func (md *MessageDeletedResponse) encodeResponse(w io.Writer) error {
+	err := encodeLong(w, md.ID)
+	if err != nil {
+		return fmt.Errorf("encode MessageDeletedResponse.ID: %w", err)
+	}
+
+	err = encodeString(w, md.Room)
+	if err != nil {
+		return fmt.Errorf("encode MessageDeletedResponse.Room: %w", err)
+	}
+
+	err = encodeString(w, md.User)
+	if err != nil {
+		return fmt.Errorf("encode MessageDeletedResponse.User: %w", err)
+	}
+
+	return nil
+}
+
+func (md *MessageDeletedResponse) decodeResponse(r io.Reader) error {
+	err := decodeLong(r, &md.ID)
+	if err != nil {
+		return fmt.Errorf("decode MessageDeletedResponse.ID: %w", err)
+	}
+
+	err = decodeString(r, &md.Room)
+	if err != nil {
+		return fmt.Errorf("decode MessageDeletedResponse.Room: %w", err)
+	}
+
+	err = decodeString(r, &md.User)
+	if err != nil {
+		return fmt.Errorf("decode MessageDeletedResponse.User: %w", err)
+	}
+
+	return nil
+}
+
+// A ThreadResponse is sent in response to a ListThreadRequest.
+type ThreadResponse struct {
+	Root     MessageID             // The ID of the first chat message of the thread.
+	Count    uint32                // The number of chat messages in the thread.
+	Messages []ChatMessageResponse // The chat messages of the thread in the order they were sent, starting with the root.
+}
+
+func (*ThreadResponse) ResponseType() ResponseType { return Thread }
+
+func (th *ThreadResponse) encodeResponse(w io.Writer) error {
+	err := encodeLong(w, th.Root)
+	if err != nil {
+		return fmt.Errorf("encode ThreadResponse.Root: %w", err)
+	}
+
+	count := uint32(len(th.Messages))
+	err = encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode ThreadResponse.Count: %w", err)
+	}
+
+	for i := range th.Messages {
+		err = th.Messages[i].encodeResponse(w)
+		if err != nil {
+			return fmt.Errorf("encode ThreadResponse.Messages[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (th *ThreadResponse) decodeResponse(r io.Reader) error {
+	err := decodeLong(r, &th.Root)
+	if err != nil {
+		return fmt.Errorf("decode ThreadResponse.Root: %w", err)
+	}
+
+	err = decodeInt(r, &th.Count)
+	if err != nil {
+		return fmt.Errorf("decode ThreadResponse.Count: %w", err)
+	}
+	th.Messages = make([]ChatMessageResponse, th.Count)
+
+	for i := uint32(0); i < th.Count; i++ {
+		err = th.Messages[i].decodeResponse(r)
+		if err != nil {
+			return fmt.Errorf("decode ThreadResponse.Messages[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// A Reaction is an entry of a ReactionListResponse.
+type Reaction struct {
+	Reaction string // The reaction, usually a single emoji.
+	Count    uint32 // The number of users that reacted with the reaction.
+}
+
+// A ReactionListResponse is sent to a client with the MessageIDs capability
+// when the reactions to a chat message that it received change.
+type ReactionListResponse struct {
+	ID        MessageID  // The ID of the chat message.
+	Room      string     // The name of the room the chat message was sent to. Empty if it is a direct message.
+	User      string     // The name of the user whose reaction changed.
+	Count     uint32     // The number of different reactions to the chat message.
+	Reactions []Reaction // The reactions in the order they were first added.
+}
+
+func (*ReactionListResponse) ResponseType() ResponseType { return ReactionList }
+
+func (rl *ReactionListResponse) encodeResponse(w io.Writer) error {
+	err := encodeLong(w, rl.ID)
+	if err != nil {
+		return fmt.Errorf("encode ReactionListResponse.ID: %w", err)
+	}
+
+	err = encodeString(w, rl.Room)
+	if err != nil {
+		return fmt.Errorf("encode ReactionListResponse.Room: %w", err)
+	}
+
+	err = encodeString(w, rl.User)
+	if err != nil {
+		return fmt.Errorf("encode ReactionListResponse.User: %w", err)
+	}
+
+	count := uint32(len(rl.Reactions))
+	err = encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode ReactionListResponse.Count: %w", err)
+	}
+
+	for i, reaction := range rl.Reactions {
+		err = encodeString(w, reaction.Reaction)
+		if err != nil {
+			return fmt.Errorf("encode ReactionListResponse.Reactions[%d].Reaction: %w", i, err)
+		}
+
+		err = encodeInt(w, reaction.Count)
+		if err != nil {
+			return fmt.Errorf("encode ReactionListResponse.Reactions[%d].Count: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (rl *ReactionListResponse) decodeResponse(r io.Reader) error {
+	err := decodeLong(r, &rl.ID)
+	if err != nil {
+		return fmt.Errorf("decode ReactionListResponse.ID: %w", err)
+	}
+
+	err = decodeString(r, &rl.Room)
+	if err != nil {
+		return fmt.Errorf("decode ReactionListResponse.Room: %w", err)
+	}
+
+	err = decodeString(r, &rl.User)
+	if err != nil {
+		return fmt.Errorf("decode ReactionListResponse.User: %w", err)
+	}
+
+	err = decodeInt(r, &rl.Count)
+	if err != nil {
+		return fmt.Errorf("decode ReactionListResponse.Count: %w", err)
+	}
+	rl.Reactions = make([]Reaction, rl.Count)
+
+	for i := uint32(0); i < rl.Count; i++ {
+		err = decodeString(r, &rl.Reactions[i].Reaction)
+		if err != nil {
+			return fmt.Errorf("decode ReactionListResponse.Reactions[%d].Reaction: %w", i, err)
+		}
+
+		err = decodeInt(r, &rl.Reactions[i].Count)
+		if err != nil {
+			return fmt.Errorf("decode ReactionListResponse.Reactions[%d].Count: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// A ReadMarkerResponse is sent to a client with the MessageIDs capability to tell it which chat messages of a room
+// the client user has read. The read marker is shared by all clients of the user.
+type ReadMarkerResponse struct {
+	Room   string    // The name of the room.
+	ID     MessageID // The ID of the last chat message that the user read. Zero if the room has no chat messages.
+	Unread uint32    // The number of chat messages from other users after the read marker.
+}
+
+func (*ReadMarkerResponse) ResponseType() ResponseType { return ReadMarker }
+
+func (rm *ReadMarkerResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, rm.Room)
+	if err != nil {
+		return fmt.Errorf("encode ReadMarkerResponse.Room: %w", err)
+	}
+
+	err = encodeLong(w, rm.ID)
+	if err != nil {
+		return fmt.Errorf("encode ReadMarkerResponse.ID: %w", err)
+	}
+
+	err = encodeInt(w, rm.Unread)
+	if err != nil {
+		return fmt.Errorf("encode ReadMarkerResponse.Unread: %w", err)
+	}
+
+	return nil
+}
+
+func (rm *ReadMarkerResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &rm.Room)
+	if err != nil {
+		return fmt.Errorf("decode ReadMarkerResponse.Room: %w", err)
+	}
+
+	err = decodeLong(r, &rm.ID)
+	if err != nil {
+		return fmt.Errorf("decode ReadMarkerResponse.ID: %w", err)
+	}
+
+	err = decodeInt(r, &rm.Unread)
+	if err != nil {
+		return fmt.Errorf("decode ReadMarkerResponse.Unread: %w", err)
+	}
+
+	return nil
+}
+
+// A ReceiptResponse is sent to a client with the Receipts capability when the state of a direct message changes.
+type ReceiptResponse struct {
+	ID   MessageID // The ID of the direct message.
+	User string    // The name of the recipient.
+	Read bool      // Whether the recipient read the direct message. Otherwise, it was delivered.
+}
+
+func (*ReceiptResponse) ResponseType() ResponseType { return Receipt }
+
+func (rc *ReceiptResponse) encodeResponse(w io.Writer) error {
+	err := encodeLong(w, rc.ID)
+	if err != nil {
+		return fmt.Errorf("encode ReceiptResponse.ID: %w", err)
+	}
+
+	err = encodeString(w, rc.User)
+	if err != nil {
+		return fmt.Errorf("encode ReceiptResponse.User: %w", err)
+	}
+
+	err = encodeBool(w, rc.Read)
+	if err != nil {
+		return fmt.Errorf("encode ReceiptResponse.Read: %w", err)
+	}
+
+	return nil
+}
+
+func (rc *ReceiptResponse) decodeResponse(r io.Reader) error {
+	err := decodeLong(r, &rc.ID)
+	if err != nil {
+		return fmt.Errorf("decode ReceiptResponse.ID: %w", err)
+	}
+
+	err = decodeString(r, &rc.User)
+	if err != nil {
+		return fmt.Errorf("decode ReceiptResponse.User: %w", err)
+	}
+
+	err = decodeBool(r, &rc.Read)
+	if err != nil {
+		return fmt.Errorf("decode ReceiptResponse.Read: %w", err)
+	}
+
+	return nil
+}
+
+// A SearchResultsResponse is sent in response to a SearchMessagesRequest.
+type SearchResultsResponse struct {
+	Query    string                // The query of the request.
+	Next     MessageID             // The cursor for the next page of results. Zero if there are no more results.
+	Count    uint32                // The number of chat messages in this page of results.
+	Messages []ChatMessageResponse // The matching chat messages from newest to oldest.
+}
+
+func (*SearchResultsResponse) ResponseType() ResponseType { return SearchResults }
+
+func (sr *SearchResultsResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, sr.Query)
+	if err != nil {
+		return fmt.Errorf("encode SearchResultsResponse.Query: %w", err)
+	}
+
+	err = encodeLong(w, sr.Next)
+	if err != nil {
+		return fmt.Errorf("encode SearchResultsResponse.Next: %w", err)
+	}
+
+	count := uint32(len(sr.Messages))
+	err = encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode SearchResultsResponse.Count: %w", err)
+	}
+
+	for i := range sr.Messages {
+		err = sr.Messages[i].encodeResponse(w)
+		if err != nil {
+			return fmt.Errorf("encode SearchResultsResponse.Messages[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (sr *SearchResultsResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &sr.Query)
+	if err != nil {
+		return fmt.Errorf("decode SearchResultsResponse.Query: %w", err)
+	}
+
+	err = decodeLong(r, &sr.Next)
+	if err != nil {
+		return fmt.Errorf("decode SearchResultsResponse.Next: %w", err)
+	}
+
+	err = decodeInt(r, &sr.Count)
+	if err != nil {
+		return fmt.Errorf("decode SearchResultsResponse.Count: %w", err)
+	}
+	sr.Messages = make([]ChatMessageResponse, sr.Count)
+
+	for i := uint32(0); i < sr.Count; i++ {
+		err = sr.Messages[i].decodeResponse(r)
+		if err != nil {
+			return fmt.Errorf("decode SearchResultsResponse.Messages[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// A RoomInfo is an entry of a RoomPageResponse.
+type RoomInfo struct {
+	Name    string // The name of the room.
+	Members uint32 // The number of users in the room.
+	Topic   string // The topic of the room. May be empty.
+}
+
+// A RoomPageResponse is sent in response to a ListRoomsPageRequest.
+type RoomPageResponse struct {
+	User  string     // The user of the request. Empty if the response is for the rooms of the entire server.
+	Next  string     // The cursor for the next page. Empty if there are no more rooms.
+	Count uint32     // The number of rooms in this page.
+	Rooms []RoomInfo // The rooms in the order of the request.
+}
+
+func (*RoomPageResponse) ResponseType() ResponseType { return RoomPage }
+
+func (rp *RoomPageResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, rp.User)
+	if err != nil {
+		return fmt.Errorf("encode RoomPageResponse.User: %w", err)
+	}
+
+	err = encodeString(w, rp.Next)
+	if err != nil {
+		return fmt.Errorf("encode RoomPageResponse.Next: %w", err)
+	}
+
+	count := uint32(len(rp.Rooms))
+	err = encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode RoomPageResponse.Count: %w", err)
+	}
+
+	for i, room := range rp.Rooms {
+		err = encodeString(w, room.Name)
+		if err != nil {
+			return fmt.Errorf("encode RoomPageResponse.Rooms[%d].Name: %w", i, err)
+		}
+
+		err = encodeInt(w, room.Members)
+		if err != nil {
+			return fmt.Errorf("encode RoomPageResponse.Rooms[%d].Members: %w", i, err)
+		}
+
+		err = encodeString(w, room.Topic)
+		if err != nil {
+			return fmt.Errorf("encode RoomPageResponse.Rooms[%d].Topic: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (rp *RoomPageResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &rp.User)
+	if err != nil {
+		return fmt.Errorf("decode RoomPageResponse.User: %w", err)
+	}
+
+	err = decodeString(r, &rp.Next)
+	if err != nil {
+		return fmt.Errorf("decode RoomPageResponse.Next: %w", err)
+	}
+
+	err = decodeInt(r, &rp.Count)
+	if err != nil {
+		return fmt.Errorf("decode RoomPageResponse.Count: %w", err)
+	}
+	rp.Rooms = make([]RoomInfo, rp.Count)
+
+	for i := uint32(0); i < rp.Count; i++ {
+		err = decodeString(r, &rp.Rooms[i].Name)
+		if err != nil {
+			return fmt.Errorf("decode RoomPageResponse.Rooms[%d].Name: %w", i, err)
+		}
+
+		err = decodeInt(r, &rp.Rooms[i].Members)
+		if err != nil {
+			return fmt.Errorf("decode RoomPageResponse.Rooms[%d].Members: %w", i, err)
+		}
+
+		err = decodeString(r, &rp.Rooms[i].Topic)
+		if err != nil {
+			return fmt.Errorf("decode RoomPageResponse.Rooms[%d].Topic: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// A UserPageResponse is sent in response to a ListUsersPageRequest.
+type UserPageResponse struct {
+	Room  string         // The room of the request. Empty if the response is for the users of the entire server.
+	Next  string         // The cursor for the next page. Empty if there are no more users.
+	Count uint32         // The number of users in this page.
+	Users []UserPresence // The users in the order of the request.
+}
+
+func (*UserPageResponse) ResponseType() ResponseType { return UserPage }
+
+func (up *UserPageResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, up.Room)
+	if err != nil {
+		return fmt.Errorf("encode UserPageResponse.Room: %w", err)
+	}
+
+	err = encodeString(w, up.Next)
+	if err != nil {
+		return fmt.Errorf("encode UserPageResponse.Next: %w", err)
+	}
+
+	count := uint32(len(up.Users))
+	err = encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode UserPageResponse.Count: %w", err)
+	}
+
+	for i, user := range up.Users {
+		err = encodeString(w, user.Name)
+		if err != nil {
+			return fmt.Errorf("encode UserPageResponse.Users[%d].Name: %w", i, err)
+		}
+
+		err = encodePresence(w, user.Presence)
+		if err != nil {
+			return fmt.Errorf("encode UserPageResponse.Users[%d].Presence: %w", i, err)
+		}
+
+		err = encodeString(w, user.Message)
+		if err != nil {
+			return fmt.Errorf("encode UserPageResponse.Users[%d].Message: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (up *UserPageResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &up.Room)
+	if err != nil {
+		return fmt.Errorf("decode UserPageResponse.Room: %w", err)
+	}
+
+	err = decodeString(r, &up.Next)
+	if err != nil {
+		return fmt.Errorf("decode UserPageResponse.Next: %w", err)
+	}
+
+	err = decodeInt(r, &up.Count)
+	if err != nil {
+		return fmt.Errorf("decode UserPageResponse.Count: %w", err)
+	}
+	up.Users = make([]UserPresence, up.Count)
+
+	for i := uint32(0); i < up.Count; i++ {
+		err = decodeString(r, &up.Users[i].Name)
+		if err != nil {
+			return fmt.Errorf("decode UserPageResponse.Users[%d].Name: %w", i, err)
+		}
+
+		err = decodePresence(r, &up.Users[i].Presence)
+		if err != nil {
+			return fmt.Errorf("decode UserPageResponse.Users[%d].Presence: %w", i, err)
+		}
+
+		err = decodeString(r, &up.Users[i].Message)
+		if err != nil {
+			return fmt.Errorf("decode UserPageResponse.Users[%d].Message: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// RoomFlags is a set of properties of a room in a RoomEntry.
+type RoomFlags uint32
+
+const (
+	RoomJoined       RoomFlags = 1 << iota // The client user has joined the room.
+	RoomOperator                           // The client user is an operator of the room.
+	RoomPermanent                          // The room exists even without users.
+	RoomOutsidePosts                       // Users that have not joined the room can send chat messages to it.
+)
+
+// Has reports whether every flag in other is also in f.
+func (f RoomFlags) Has(other RoomFlags) bool { return f&other == other }
+
+func (f RoomFlags) GoString() string {
+	names := []string{}
+	for bit := RoomFlags(1); bit != 0; bit <<= 1 {
+		if !f.Has(bit) {
+			continue
+		}
+		switch bit {
+		case RoomJoined:
+			names = append(names, "RoomJoined")
+		case RoomOperator:
+			names = append(names, "RoomOperator")
+		case RoomPermanent:
+			names = append(names, "RoomPermanent")
+		case RoomOutsidePosts:
+			names = append(names, "RoomOutsidePosts")
+		default:
+			names = append(names, fmt.Sprintf("RoomFlags(0x%08X)", uint32(bit)))
+		}
+	}
+	if len(names) == 0 {
+		return "RoomFlags(0)"
+	}
+	return strings.Join(names, "|")
+}
+
+func (f RoomFlags) String() string { return f.GoString() }
+
+// A RoomEntry is an entry of a RoomEntryListResponse.
+type RoomEntry struct {
+	Name    string    // The name of the room.
+	Members uint32    // The number of users in the room.
+	Topic   string    // The topic of the room. May be empty.
+	Flags   RoomFlags // The properties of the room for the client user.
+}
+
+// A RoomEntryListResponse is sent instead of a RoomListResponse or RoomPageResponse to a client that uses Version2.
+type RoomEntryListResponse struct {
+	User  string      // The user of the request. Empty if the response is for the rooms of the entire server.
+	Next  string      // The cursor for the next page. Always empty in response to a ListRoomsRequest.
+	Count uint32      // The number of rooms in the response.
+	Rooms []RoomEntry // The rooms in the order of the request.
+}
+
+func (*RoomEntryListResponse) ResponseType() ResponseType { return RoomEntryList }
+
+func (rl *RoomEntryListResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, rl.User)
+	if err != nil {
+		return fmt.Errorf("encode RoomEntryListResponse.User: %w", err)
+	}
+
+	err = encodeString(w, rl.Next)
+	if err != nil {
+		return fmt.Errorf("encode RoomEntryListResponse.Next: %w", err)
+	}
+
+	count := uint32(len(rl.Rooms))
+	err = encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode RoomEntryListResponse.Count: %w", err)
+	}
+
+	for i, room := range rl.Rooms {
+		err = encodeString(w, room.Name)
+		if err != nil {
+			return fmt.Errorf("encode RoomEntryListResponse.Rooms[%d].Name: %w", i, err)
+		}
+
+		err = encodeInt(w, room.Members)
+		if err != nil {
+			return fmt.Errorf("encode RoomEntryListResponse.Rooms[%d].Members: %w", i, err)
+		}
+
+		err = encodeString(w, room.Topic)
+		if err != nil {
+			return fmt.Errorf("encode RoomEntryListResponse.Rooms[%d].Topic: %w", i, err)
+		}
+
+		err = encodeInt(w, room.Flags)
+		if err != nil {
+			return fmt.Errorf("encode RoomEntryListResponse.Rooms[%d].Flags: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (rl *RoomEntryListResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &rl.User)
+	if err != nil {
+		return fmt.Errorf("decode RoomEntryListResponse.User: %w", err)
+	}
+
+	err = decodeString(r, &rl.Next)
+	if err != nil {
+		return fmt.Errorf("decode RoomEntryListResponse.Next: %w", err)
+	}
+
+	err = decodeInt(r, &rl.Count)
+	if err != nil {
+		return fmt.Errorf("decode RoomEntryListResponse.Count: %w", err)
+	}
+	rl.Rooms = make([]RoomEntry, rl.Count)
+
+	for i := uint32(0); i < rl.Count; i++ {
+		err = decodeString(r, &rl.Rooms[i].Name)
+		if err != nil {
+			return fmt.Errorf("decode RoomEntryListResponse.Rooms[%d].Name: %w", i, err)
+		}
+
+		err = decodeInt(r, &rl.Rooms[i].Members)
+		if err != nil {
+			return fmt.Errorf("decode RoomEntryListResponse.Rooms[%d].Members: %w", i, err)
+		}
+
+		err = decodeString(r, &rl.Rooms[i].Topic)
+		if err != nil {
+			return fmt.Errorf("decode RoomEntryListResponse.Rooms[%d].Topic: %w", i, err)
+		}
+
+		err = decodeInt(r, &rl.Rooms[i].Flags)
+		if err != nil {
+			return fmt.Errorf("decode RoomEntryListResponse.Rooms[%d].Flags: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// A UserEntry is an entry of a UserEntryListResponse.
+type UserEntry struct {
+	Name     string   // The name of the user.
+	Presence Presence // The presence of the user.
+	Message  string   // The status message of the user. May be empty.
+	Idle     uint32   // The number of seconds since the user last sent a request other than a KeepaliveRequest.
+}
+
+// A UserEntryListResponse is sent instead of a UserListResponse, PresenceListResponse or UserPageResponse
+// to a client that uses Version2.
+type UserEntryListResponse struct {
+	Room  string      // The room of the request. Empty if the response is for the users of the entire server.
+	Next  string      // The cursor for the next page. Always empty in response to a ListUsersRequest.
+	Count uint32      // The number of users in the response.
+	Users []UserEntry // The users in the order of the request.
+}
+
+func (*UserEntryListResponse) ResponseType() ResponseType { return UserEntryList }
+
+func (ul *UserEntryListResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, ul.Room)
+	if err != nil {
+		return fmt.Errorf("encode UserEntryListResponse.Room: %w", err)
+	}
+
+	err = encodeString(w, ul.Next)
+	if err != nil {
+		return fmt.Errorf("encode UserEntryListResponse.Next: %w", err)
+	}
+
+	count := uint32(len(ul.Users))
+	err = encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode UserEntryListResponse.Count: %w", err)
+	}
+
+	for i, user := range ul.Users {
+		err = encodeString(w, user.Name)
+		if err != nil {
+			return fmt.Errorf("encode UserEntryListResponse.Users[%d].Name: %w", i, err)
+		}
+
+		err = encodePresence(w, user.Presence)
+		if err != nil {
+			return fmt.Errorf("encode UserEntryListResponse.Users[%d].Presence: %w", i, err)
+		}
+
+		err = encodeString(w, user.Message)
+		if err != nil {
+			return fmt.Errorf("encode UserEntryListResponse.Users[%d].Message: %w", i, err)
+		}
+
+		err = encodeInt(w, user.Idle)
+		if err != nil {
+			return fmt.Errorf("encode UserEntryListResponse.Users[%d].Idle: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (ul *UserEntryListResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &ul.Room)
+	if err != nil {
+		return fmt.Errorf("decode UserEntryListResponse.Room: %w", err)
+	}
+
+	err = decodeString(r, &ul.Next)
+	if err != nil {
+		return fmt.Errorf("decode UserEntryListResponse.Next: %w", err)
+	}
+
+	err = decodeInt(r, &ul.Count)
+	if err != nil {
+		return fmt.Errorf("decode UserEntryListResponse.Count: %w", err)
+	}
+	ul.Users = make([]UserEntry, ul.Count)
+
+	for i := uint32(0); i < ul.Count; i++ {
+		err = decodeString(r, &ul.Users[i].Name)
+		if err != nil {
+			return fmt.Errorf("decode UserEntryListResponse.Users[%d].Name: %w", i, err)
+		}
+
+		err = decodePresence(r, &ul.Users[i].Presence)
+		if err != nil {
+			return fmt.Errorf("decode UserEntryListResponse.Users[%d].Presence: %w", i, err)
+		}
+
+		err = decodeString(r, &ul.Users[i].Message)
+		if err != nil {
+			return fmt.Errorf("decode UserEntryListResponse.Users[%d].Message: %w", i, err)
+		}
+
+		err = decodeInt(r, &ul.Users[i].Idle)
+		if err != nil {
+			return fmt.Errorf("decode UserEntryListResponse.Users[%d].Idle: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// A SubscriptionListResponse is sent in response to a SubscribeRequest or an UnsubscribeRequest.
+type SubscriptionListResponse struct {
+	Count    uint32   // The number of subscriptions of the connection.
+	Patterns []string // The patterns of the subscriptions in the order they were made.
+}
+
+func (*SubscriptionListResponse) ResponseType() ResponseType { return SubscriptionList }
+
+func (sl *SubscriptionListResponse) encodeResponse(w io.Writer) error {
+	count := uint32(len(sl.Patterns))
+	err := encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode SubscriptionListResponse.Count: %w", err)
+	}
+
+	for i, pattern := range sl.Patterns {
+		err = encodeString(w, pattern)
+		if err != nil {
+			return fmt.Errorf("encode SubscriptionListResponse.Patterns[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (sl *SubscriptionListResponse) decodeResponse(r io.Reader) error {
+	err := decodeInt(r, &sl.Count)
+	if err != nil {
+		return fmt.Errorf("decode SubscriptionListResponse.Count: %w", err)
+	}
+	sl.Patterns = make([]string, sl.Count)
+
+	for i := uint32(0); i < sl.Count; i++ {
+		err = decodeString(r, &sl.Patterns[i])
+		if err != nil {
+			return fmt.Errorf("decode SubscriptionListResponse.Patterns[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// A MOTDResponse carries the server's message of the day.
+//   - It is sent in response to a GetMOTDRequest.
+//   - It is sent after a ConnectRequest or LoginRequest succeeds to a client that uses Version2,
+//     if the server has a message of the day.
+type MOTDResponse struct {
+	Text string // The message of the day. Empty if the server does not have one.
+}
+
+func (*MOTDResponse) ResponseType() ResponseType { return MOTD }
+
+func (m *MOTDResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, m.Text)
+	if err != nil {
+		return fmt.Errorf("encode MOTDResponse.Text: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MOTDResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &m.Text)
+	if err != nil {
+		return fmt.Errorf("decode MOTDResponse.Text: %w", err)
+	}
+
+	return nil
+}
+
+// A ServerInfoResponse is sent in response to a GetServerInfoRequest.
+type ServerInfoResponse struct {
+	Name       string // The name of the server.
+	Version    string // The version of the server software.
+	Uptime     uint32 // The number of seconds since the server started.
+	MinVersion uint32 // The oldest protocol version that the server supports.
+	MaxVersion uint32 // The newest protocol version that the server supports.
+	MaxUsers   uint32 // The number of users that can be connected at once. Zero means unlimited.
+	MaxRooms   uint32 // The number of rooms that can exist at once. Zero means unlimited.
+	MaxQueued  uint32 // The number of direct messages queued for an offline registered user. Zero disables queueing.
+	MaxText    uint32 // The maximum number of characters in a chat message. Zero means unlimited.
+	Users      uint32 // The number of users that are connected.
+	Rooms      uint32 // The number of rooms that exist.
+}
+
+func (*ServerInfoResponse) ResponseType() ResponseType { return ServerInfo }
+
+func (si *ServerInfoResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, si.Name)
+	if err != nil {
+		return fmt.Errorf("encode ServerInfoResponse.Name: %w", err)
+	}
+
+	err = encodeString(w, si.Version)
+	if err != nil {
+		return fmt.Errorf("encode ServerInfoResponse.Version: %w", err)
+	}
+
+	err = encodeInt(w, si.Uptime)
+	if err != nil {
+		return fmt.Errorf("encode ServerInfoResponse.Uptime: %w", err)
+	}
+
+	err = encodeInt(w, si.MinVersion)
+	if err != nil {
+		return fmt.Errorf("encode ServerInfoResponse.MinVersion: %w", err)
+	}
+
+	err = encodeInt(w, si.MaxVersion)
+	if err != nil {
+		return fmt.Errorf("encode ServerInfoResponse.MaxVersion: %w", err)
+	}
+
+	err = encodeInt(w, si.MaxUsers)
+	if err != nil {
+		return fmt.Errorf("encode ServerInfoResponse.MaxUsers: %w", err)
+	}
+
+	err = encodeInt(w, si.MaxRooms)
+	if err != nil {
+		return fmt.Errorf("encode ServerInfoResponse.MaxRooms: %w", err)
+	}
+
+	err = encodeInt(w, si.MaxQueued)
+	if err != nil {
+		return fmt.Errorf("encode ServerInfoResponse.MaxQueued: %w", err)
+	}
+
+	err = encodeInt(w, si.MaxText)
+	if err != nil {
+		return fmt.Errorf("encode ServerInfoResponse.MaxText: %w", err)
+	}
+
+	err = encodeInt(w, si.Users)
+	if err != nil {
+		return fmt.Errorf("encode ServerInfoResponse.Users: %w", err)
+	}
+
+	err = encodeInt(w, si.Rooms)
+	if err != nil {
+		return fmt.Errorf("encode ServerInfoResponse.Rooms: %w", err)
+	}
+
+	return nil
+}
+
+func (si *ServerInfoResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &si.Name)
+	if err != nil {
+		return fmt.Errorf("decode ServerInfoResponse.Name: %w", err)
+	}
+
+	err = decodeString(r, &si.Version)
+	if err != nil {
+		return fmt.Errorf("decode ServerInfoResponse.Version: %w", err)
+	}
+
+	err = decodeInt(r, &si.Uptime)
+	if err != nil {
+		return fmt.Errorf("decode ServerInfoResponse.Uptime: %w", err)
+	}
+
+	err = decodeInt(r, &si.MinVersion)
+	if err != nil {
+		return fmt.Errorf("decode ServerInfoResponse.MinVersion: %w", err)
+	}
+
+	err = decodeInt(r, &si.MaxVersion)
+	if err != nil {
+		return fmt.Errorf("decode ServerInfoResponse.MaxVersion: %w", err)
+	}
+
+	err = decodeInt(r, &si.MaxUsers)
+	if err != nil {
+		return fmt.Errorf("decode ServerInfoResponse.MaxUsers: %w", err)
+	}
+
+	err = decodeInt(r, &si.MaxRooms)
+	if err != nil {
+		return fmt.Errorf("decode ServerInfoResponse.MaxRooms: %w", err)
+	}
+
+	err = decodeInt(r, &si.MaxQueued)
+	if err != nil {
+		return fmt.Errorf("decode ServerInfoResponse.MaxQueued: %w", err)
+	}
+
+	err = decodeInt(r, &si.MaxText)
+	if err != nil {
+		return fmt.Errorf("decode ServerInfoResponse.MaxText: %w", err)
+	}
+
+	err = decodeInt(r, &si.Users)
+	if err != nil {
+		return fmt.Errorf("decode ServerInfoResponse.Users: %w", err)
+	}
+
+	err = decodeInt(r, &si.Rooms)
+	if err != nil {
+		return fmt.Errorf("decode ServerInfoResponse.Rooms: %w", err)
+	}
+
+	return nil
+}
+
+// An AnnouncementResponse carries an announcement from a server administrator.
+//   - It is sent to clients that use Version2. Other clients are sent the announcement as a RoomMessageResponse
+//     if it was made to a room, or as a UserMessageResponse from the sender otherwise.
+type AnnouncementResponse struct {
+	Sender string    // The name of the server administrator that made the announcement.
+	Room   string    // The room that the announcement was made to. Empty if it was made to every connected user.
+	Text   string    // The text of the announcement.
+	Time   time.Time // When the announcement was made.
+}
+
+func (*AnnouncementResponse) ResponseType() ResponseType { return Announcement }
+
+func (a *AnnouncementResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, a.Sender)
+	if err != nil {
+		return fmt.Errorf("encode AnnouncementResponse.Sender: %w", err)
+	}
+
+	err = encodeString(w, a.Room)
+	if err != nil {
+		return fmt.Errorf("encode AnnouncementResponse.Room: %w", err)
+	}
+
+	err = encodeString(w, a.Text)
+	if err != nil {
+		return fmt.Errorf("encode AnnouncementResponse.Text: %w", err)
+	}
+
+	err = encodeTime(w, a.Time)
+	if err != nil {
+		return fmt.Errorf("encode AnnouncementResponse.Time: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AnnouncementResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &a.Sender)
+	if err != nil {
+		return fmt.Errorf("decode AnnouncementResponse.Sender: %w", err)
+	}
+
+	err = decodeString(r, &a.Room)
+	if err != nil {
+		return fmt.Errorf("decode AnnouncementResponse.Room: %w", err)
+	}
+
+	err = decodeString(r, &a.Text)
+	if err != nil {
+		return fmt.Errorf("decode AnnouncementResponse.Text: %w", err)
+	}
+
+	err = decodeTime(r, &a.Time)
+	if err != nil {
+		return fmt.Errorf("decode AnnouncementResponse.Time: %w", err)
+	}
+
+	return nil
+}
+
+// A ScheduledResponse is sent in response to a ScheduleMessageRequest or a scheduled AnnounceRequest.
+type ScheduledResponse struct {
+	ID uint32    // Identifies the scheduled chat message or announcement among those of the client user.
+	At time.Time // When the server will send the chat message or make the announcement.
+}
+
+func (*ScheduledResponse) ResponseType() ResponseType { return Scheduled }
+
+func (s *ScheduledResponse) encodeResponse(w io.Writer) error {
+	err := encodeInt(w, s.ID)
+	if err != nil {
+		return fmt.Errorf("encode ScheduledResponse.ID: %w", err)
+	}
+
+	err = encodeTime(w, s.At)
+	if err != nil {
+		return fmt.Errorf("encode ScheduledResponse.At: %w", err)
+	}
+
+	return nil
+}
+
+func (s *ScheduledResponse) decodeResponse(r io.Reader) error {
+	err := decodeInt(r, &s.ID)
+	if err != nil {
+		return fmt.Errorf("decode ScheduledResponse.ID: %w", err)
+	}
+
+	err = decodeTime(r, &s.At)
+	if err != nil {
+		return fmt.Errorf("decode ScheduledResponse.At: %w", err)
+	}
+
+	return nil
+}
+
+// A RoomDetailsResponse is sent in response to a DescribeRoomRequest or a SetRetentionRequest.
+type RoomDetailsResponse struct {
+	Name      string    // The name of the room.
+	Members   uint32    // The number of users in the room.
+	Topic     string    // The topic of the room. May be empty.
+	Flags     RoomFlags // The flags of the room for the client user.
+	Retention Retention // The retention that the operators of the room set.
+	Effective Retention // The retention that the server enforces, including its server-wide retention.
+}
+
+func (*RoomDetailsResponse) ResponseType() ResponseType { return RoomDetails }
+
+func (rd *RoomDetailsResponse) encodeResponse(w io.Writer) error {
+	err := encodeString(w, rd.Name)
+	if err != nil {
+		return fmt.Errorf("encode RoomDetailsResponse.Name: %w", err)
+	}
+
+	err = encodeInt(w, rd.Members)
+	if err != nil {
+		return fmt.Errorf("encode RoomDetailsResponse.Members: %w", err)
+	}
+
+	err = encodeString(w, rd.Topic)
+	if err != nil {
+		return fmt.Errorf("encode RoomDetailsResponse.Topic: %w", err)
+	}
+
+	err = encodeInt(w, rd.Flags)
+	if err != nil {
+		return fmt.Errorf("encode RoomDetailsResponse.Flags: %w", err)
+	}
+
+	err = encodeRetention(w, rd.Retention)
+	if err != nil {
+		return fmt.Errorf("encode RoomDetailsResponse.Retention: %w", err)
+	}
+
+	err = encodeRetention(w, rd.Effective)
+	if err != nil {
+		return fmt.Errorf("encode RoomDetailsResponse.Effective: %w", err)
+	}
+
+	return nil
+}
+
+func (rd *RoomDetailsResponse) decodeResponse(r io.Reader) error {
+	err := decodeString(r, &rd.Name)
+	if err != nil {
+		return fmt.Errorf("decode RoomDetailsResponse.Name: %w", err)
+	}
+
+	err = decodeInt(r, &rd.Members)
+	if err != nil {
+		return fmt.Errorf("decode RoomDetailsResponse.Members: %w", err)
+	}
+
+	err = decodeString(r, &rd.Topic)
+	if err != nil {
+		return fmt.Errorf("decode RoomDetailsResponse.Topic: %w", err)
+	}
+
+	err = decodeInt(r, &rd.Flags)
+	if err != nil {
+		return fmt.Errorf("decode RoomDetailsResponse.Flags: %w", err)
+	}
+
+	err = decodeRetention(r, &rd.Retention)
+	if err != nil {
+		return fmt.Errorf("decode RoomDetailsResponse.Retention: %w", err)
+	}
+
+	err = decodeRetention(r, &rd.Effective)
+	if err != nil {
+		return fmt.Errorf("decode RoomDetailsResponse.Effective: %w", err)
+	}
+
+	return nil
+}
+
+// A ScheduledItem is a chat message or announcement that the server will send later.
+type ScheduledItem struct {
+	ID           uint32    // The ID from the ScheduledResponse.
+	At           time.Time // When the server will send the chat message or make the announcement.
+	Announcement bool      // Whether the item is an announcement instead of a chat message.
+	Count        uint32    // The number of rooms.
+	Rooms        []string  // The room of a chat message, or the rooms of an announcement. Empty to announce to every connected user.
+	Text         string    // The text of the chat message or announcement.
+}
+
+// A ScheduledListResponse is sent in response to a ListScheduledRequest or a CancelScheduledRequest.
+type ScheduledListResponse struct {
+	Count uint32          // The number of scheduled items.
+	Items []ScheduledItem // The scheduled items in the order that the server will send them.
+}
+
+func (*ScheduledListResponse) ResponseType() ResponseType { return ScheduledList }
+
+func (sl *ScheduledListResponse) encodeResponse(w io.Writer) error {
+	count := uint32(len(sl.Items))
+	err := encodeInt(w, count)
+	if err != nil {
+		return fmt.Errorf("encode ScheduledListResponse.Count: %w", err)
+	}
+
+	for i, item := range sl.Items {
+		err = encodeInt(w, item.ID)
+		if err != nil {
+			return fmt.Errorf("encode ScheduledListResponse.Items[%d].ID: %w", i, err)
+		}
+
+		err = encodeTime(w, item.At)
+		if err != nil {
+			return fmt.Errorf("encode ScheduledListResponse.Items[%d].At: %w", i, err)
+		}
+
+		err = encodeBool(w, item.Announcement)
+		if err != nil {
+			return fmt.Errorf("encode ScheduledListResponse.Items[%d].Announcement: %w", i, err)
+		}
+
+		rooms := uint32(len(item.Rooms))
+		err = encodeInt(w, rooms)
+		if err != nil {
+			return fmt.Errorf("encode ScheduledListResponse.Items[%d].Count: %w", i, err)
+		}
+
+		for j, room := range item.Rooms {
+			err = encodeString(w, room)
+			if err != nil {
+				return fmt.Errorf("encode ScheduledListResponse.Items[%d].Rooms[%d]: %w", i, j, err)
+			}
+		}
+
+		err = encodeString(w, item.Text)
+		if err != nil {
+			return fmt.Errorf("encode ScheduledListResponse.Items[%d].Text: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (sl *ScheduledListResponse) decodeResponse(r io.Reader) error {
+	err := decodeInt(r, &sl.Count)
+	if err != nil {
+		return fmt.Errorf("decode ScheduledListResponse.Count: %w", err)
+	}
+	sl.Items = make([]ScheduledItem, sl.Count)
+
+	for i := uint32(0); i < sl.Count; i++ {
+		err = decodeInt(r, &sl.Items[i].ID)
+		if err != nil {
+			return fmt.Errorf("decode ScheduledListResponse.Items[%d].ID: %w", i, err)
+		}
+
+		err = decodeTime(r, &sl.Items[i].At)
+		if err != nil {
+			return fmt.Errorf("decode ScheduledListResponse.Items[%d].At: %w", i, err)
+		}
+
+		err = decodeBool(r, &sl.Items[i].Announcement)
+		if err != nil {
+			return fmt.Errorf("decode ScheduledListResponse.Items[%d].Announcement: %w", i, err)
+		}
+
+		err = decodeInt(r, &sl.Items[i].Count)
+		if err != nil {
+			return fmt.Errorf("decode ScheduledListResponse.Items[%d].Count: %w", i, err)
+		}
+		sl.Items[i].Rooms = make([]string, sl.Items[i].Count)
+
+		for j := uint32(0); j < sl.Items[i].Count; j++ {
+			err = decodeString(r, &sl.Items[i].Rooms[j])
+			if err != nil {
+				return fmt.Errorf("decode ScheduledListResponse.Items[%d].Rooms[%d]: %w", i, j, err)
+			}
+		}
+
+		err = decodeString(r, &sl.Items[i].Text)
+		if err != nil {
+			return fmt.Errorf("decode ScheduledListResponse.Items[%d].Text: %w", i, err)
+		}
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/mnxn/chat/generic"
 )
@@ -48,6 +49,33 @@ var errorTypeTests = []struct {
 	{InvalidText, []byte{
 		0, 0, 0, 12, // uint32(12)
 	}},
+	{BlockedUser, []byte{
+		0, 0, 0, 13, // uint32(13)
+	}},
+	{LimitReached, []byte{
+		0, 0, 0, 14, // uint32(14)
+	}},
+	{NotInRoom, []byte{
+		0, 0, 0, 15, // uint32(15)
+	}},
+	{PermissionDenied, []byte{
+		0, 0, 0, 16, // uint32(16)
+	}},
+	{AuthenticationFailed, []byte{
+		0, 0, 0, 17, // uint32(17)
+	}},
+	{MissingMessage, []byte{
+		0, 0, 0, 18, // uint32(18)
+	}},
+	{InvalidReaction, []byte{
+		0, 0, 0, 19, // uint32(19)
+	}},
+	{InvalidFilter, []byte{
+		0, 0, 0, 20, // uint32(20)
+	}},
+	{MissingScheduled, []byte{
+		0, 0, 0, 21, // uint32(21)
+	}},
 }
 
 var serverResponseTests = []struct {
@@ -193,6 +221,744 @@ var serverResponseTests = []struct {
 			84, 69, 88, 84, // "TEXT"
 		},
 	},
+
+	{
+		&BlockListResponse{
+			Strangers: false,
+			Count:     0,
+			Users:     []string{},
+		},
+		[]byte{
+			0, 0, 0, 7, // BlockList
+			0, 0, 0, 0, // false
+			0, 0, 0, 0, // uint32(0)
+		},
+	},
+	{
+		&BlockListResponse{
+			Strangers: true,
+			Count:     2,
+			Users: []string{
+				"x",
+				"yz",
+			},
+		},
+		[]byte{
+			0, 0, 0, 7, // BlockList
+			0, 0, 0, 1, // true
+
+			0, 0, 0, 2, // uint32(2)
+
+			0, 0, 0, 1, // uint32(1)
+			120, // "x"
+
+			0, 0, 0, 2, // uint32(2)
+			121, 122, // "yz"
+		},
+	},
+
+	{
+		&CapabilitiesResponse{
+			Capabilities: 0,
+		},
+		[]byte{
+			0, 0, 0, 8, // Capabilities
+			0, 0, 0, 0, // Capability(0)
+		},
+	},
+	{
+		&CapabilitiesResponse{
+			Capabilities: EchoMessages,
+		},
+		[]byte{
+			0, 0, 0, 8, // Capabilities
+			0, 0, 0, 1, // EchoMessages
+		},
+	},
+
+	{
+		&UserMessageEchoResponse{
+			Recipient: "bob",
+			Text:      "hi",
+		},
+		[]byte{
+			0, 0, 0, 9, // UserMessageEcho
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+
+	{
+		&OfflineMessageResponse{
+			Time:   time.UnixMilli(1700000000123).UTC(),
+			Sender: "bob",
+			Text:   "hi",
+		},
+		[]byte{
+			0, 0, 0, 10, // OfflineMessage
+
+			0, 0, 1, 139, 207, 229, 104, 123, // uint64(1700000000123)
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+	{
+		&MessageQueuedResponse{
+			Recipient: "bob",
+		},
+		[]byte{
+			0, 0, 0, 11, // MessageQueued
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+		},
+	},
+
+	{
+		&PresenceListResponse{
+			Room:  "abc",
+			Count: 2,
+			Users: []UserPresence{
+				{Name: "a", Presence: Online, Message: ""},
+				{Name: "b", Presence: Away, Message: "hi"},
+			},
+		},
+		[]byte{
+			0, 0, 0, 12, // PresenceList
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 2, // uint32(2)
+
+			0, 0, 0, 1, // uint32(1)
+			97,         // "a"
+			0, 0, 0, 0, // Online
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 1, // uint32(1)
+			98,         // "b"
+			0, 0, 0, 1, // Away
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+	{
+		&PresenceChangeResponse{
+			User:     "bob",
+			Presence: DoNotDisturb,
+			Message:  "",
+		},
+		[]byte{
+			0, 0, 0, 13, // PresenceChange
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 2, // DoNotDisturb
+
+			0, 0, 0, 0, // uint32(0)
+		},
+	},
+	{
+		&AutoReplyResponse{
+			User:     "bob",
+			Presence: Away,
+			Message:  "hi",
+		},
+		[]byte{
+			0, 0, 0, 14, // AutoReply
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 1, // Away
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+
+	{
+		&UserTypingResponse{
+			User: "bob",
+			Room: "abc",
+		},
+		[]byte{
+			0, 0, 0, 15, // UserTyping
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+		},
+	},
+
+	{
+		&NameChangedResponse{
+			OldName: "bob",
+			NewName: "me",
+		},
+		[]byte{
+			0, 0, 0, 16, // NameChanged
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 2, // uint32(2)
+			109, 101, // "me"
+		},
+	},
+
+	{
+		&ChatMessageResponse{
+			ID:        7,
+			Time:      time.UnixMilli(1700000000123).UTC(),
+			ReplyTo:   5,
+			Room:      "abc",
+			Sender:    "bob",
+			Recipient: "",
+			Text:      "hi",
+		},
+		[]byte{
+			0, 0, 0, 17, // ChatMessage
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+
+			0, 0, 1, 139, 207, 229, 104, 123, // uint64(1700000000123)
+
+			0, 0, 0, 0, 0, 0, 0, 5, // uint64(5)
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+	{
+		&MessageEditedResponse{
+			ID:     7,
+			Time:   time.UnixMilli(1700000000123).UTC(),
+			Room:   "",
+			Sender: "bob",
+			Text:   "hi",
+		},
+		[]byte{
+			0, 0, 0, 18, // MessageEdited
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+
+			0, 0, 1, 139, 207, 229, 104, 123, // uint64(1700000000123)
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+	{
+		&MessageDeletedResponse{
+			ID:   7,
+			Room: "abc",
+			User: "bob",
+		},
+		[]byte{
+			0, 0, 0, 19, // MessageDeleted
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+		},
+	},
+	{
+		&ThreadResponse{
+			Root:  5,
+			Count: 1,
+			Messages: []ChatMessageResponse{
+				{
+					ID:        5,
+					Time:      time.UnixMilli(1700000000123).UTC(),
+					ReplyTo:   0,
+					Room:      "",
+					Sender:    "bob",
+					Recipient: "me",
+					Text:      "hi",
+				},
+			},
+		},
+		[]byte{
+			0, 0, 0, 20, // Thread
+
+			0, 0, 0, 0, 0, 0, 0, 5, // uint64(5)
+
+			0, 0, 0, 1, // uint32(1)
+
+			0, 0, 0, 0, 0, 0, 0, 5, // uint64(5)
+
+			0, 0, 1, 139, 207, 229, 104, 123, // uint64(1700000000123)
+
+			0, 0, 0, 0, 0, 0, 0, 0, // uint64(0)
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 2, // uint32(2)
+			109, 101, // "me"
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+	{
+		&ReactionListResponse{
+			ID:    7,
+			Room:  "abc",
+			User:  "bob",
+			Count: 2,
+			Reactions: []Reaction{
+				{Reaction: "ok", Count: 3},
+				{Reaction: "\u2764", Count: 1},
+			},
+		},
+		[]byte{
+			0, 0, 0, 21, // ReactionList
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 2, // uint32(2)
+
+			0, 0, 0, 2, // uint32(2)
+			111, 107, // "ok"
+
+			0, 0, 0, 3, // uint32(3)
+
+			0, 0, 0, 3, // uint32(3)
+			226, 157, 164, // "\u2764"
+
+			0, 0, 0, 1, // uint32(1)
+		},
+	},
+	{
+		&ReadMarkerResponse{
+			Room:   "abc",
+			ID:     7,
+			Unread: 3,
+		},
+		[]byte{
+			0, 0, 0, 22, // ReadMarker
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+
+			0, 0, 0, 3, // uint32(3)
+		},
+	},
+	{
+		&ReceiptResponse{
+			ID:   7,
+			User: "bob",
+			Read: true,
+		},
+		[]byte{
+			0, 0, 0, 23, // Receipt
+
+			0, 0, 0, 0, 0, 0, 0, 7, // uint64(7)
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 1, // true
+		},
+	},
+	{
+		&SearchResultsResponse{
+			Query: "hi",
+			Next:  5,
+			Count: 1,
+			Messages: []ChatMessageResponse{
+				{
+					ID:        5,
+					Time:      time.UnixMilli(1700000000123).UTC(),
+					ReplyTo:   0,
+					Room:      "abc",
+					Sender:    "bob",
+					Recipient: "",
+					Text:      "hi",
+				},
+			},
+		},
+		[]byte{
+			0, 0, 0, 24, // SearchResults
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+
+			0, 0, 0, 0, 0, 0, 0, 5, // uint64(5)
+
+			0, 0, 0, 1, // uint32(1)
+
+			0, 0, 0, 0, 0, 0, 0, 5, // uint64(5)
+
+			0, 0, 1, 139, 207, 229, 104, 123, // uint64(1700000000123)
+
+			0, 0, 0, 0, 0, 0, 0, 0, // uint64(0)
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+	{
+		&RoomPageResponse{
+			User:  "",
+			Next:  "abc",
+			Count: 1,
+			Rooms: []RoomInfo{
+				{Name: "abc", Members: 3, Topic: "hi"},
+			},
+		},
+		[]byte{
+			0, 0, 0, 25, // RoomPage
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 1, // uint32(1)
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 3, // uint32(3)
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+	{
+		&UserPageResponse{
+			Room:  "abc",
+			Next:  "",
+			Count: 1,
+			Users: []UserPresence{
+				{Name: "bob", Presence: Away, Message: ""},
+			},
+		},
+		[]byte{
+			0, 0, 0, 26, // UserPage
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 1, // uint32(1)
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 1, // Away
+
+			0, 0, 0, 0, // uint32(0)
+		},
+	},
+	{
+		&RoomEntryListResponse{
+			User:  "",
+			Next:  "",
+			Count: 1,
+			Rooms: []RoomEntry{
+				{Name: "abc", Members: 3, Topic: "hi", Flags: RoomJoined | RoomPermanent},
+			},
+		},
+		[]byte{
+			0, 0, 0, 27, // RoomEntryList
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 1, // uint32(1)
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 3, // uint32(3)
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+
+			0, 0, 0, 5, // RoomJoined|RoomPermanent
+		},
+	},
+	{
+		&UserEntryListResponse{
+			Room:  "abc",
+			Next:  "bob",
+			Count: 1,
+			Users: []UserEntry{
+				{Name: "bob", Presence: Away, Message: "", Idle: 300},
+			},
+		},
+		[]byte{
+			0, 0, 0, 28, // UserEntryList
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 1, // uint32(1)
+
+			0, 0, 0, 3, // uint32(3)
+			98, 111, 98, // "bob"
+
+			0, 0, 0, 1, // Away
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 1, 44, // uint32(300)
+		},
+	},
+	{
+		&SubscriptionListResponse{
+			Count:    2,
+			Patterns: []string{"a*", "b"},
+		},
+		[]byte{
+			0, 0, 0, 29, // SubscriptionList
+
+			0, 0, 0, 2, // uint32(2)
+
+			0, 0, 0, 2, // uint32(2)
+			97, 42, // "a*"
+
+			0, 0, 0, 1, // uint32(1)
+			98, // "b"
+		},
+	},
+	{
+		&MOTDResponse{
+			Text: "hi",
+		},
+		[]byte{
+			0, 0, 0, 30, // MOTD
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+		},
+	},
+	{
+		&ServerInfoResponse{
+			Name:       "chat",
+			Version:    "v1",
+			Uptime:     300,
+			MinVersion: 1,
+			MaxVersion: 2,
+			MaxUsers:   100,
+			MaxRooms:   0,
+			MaxQueued:  10,
+			MaxText:    2000,
+			Users:      3,
+			Rooms:      4,
+		},
+		[]byte{
+			0, 0, 0, 31, // ServerInfo
+
+			0, 0, 0, 4, // uint32(4)
+			99, 104, 97, 116, // "chat"
+
+			0, 0, 0, 2, // uint32(2)
+			118, 49, // "v1"
+
+			0, 0, 1, 44, // uint32(300)
+
+			0, 0, 0, 1, // uint32(1)
+
+			0, 0, 0, 2, // uint32(2)
+
+			0, 0, 0, 100, // uint32(100)
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 10, // uint32(10)
+
+			0, 0, 7, 208, // uint32(2000)
+
+			0, 0, 0, 3, // uint32(3)
+
+			0, 0, 0, 4, // uint32(4)
+		},
+	},
+	{
+		&AnnouncementResponse{
+			Sender: "root",
+			Room:   "",
+			Text:   "hi",
+			Time:   time.UnixMilli(1700000000123).UTC(),
+		},
+		[]byte{
+			0, 0, 0, 32, // Announcement
+
+			0, 0, 0, 4, // uint32(4)
+			114, 111, 111, 116, // "root"
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+
+			0, 0, 1, 139, 207, 229, 104, 123, // uint64(1700000000123)
+		},
+	},
+	{
+		&ScheduledResponse{
+			ID: 3,
+			At: time.UnixMilli(1700000000123).UTC(),
+		},
+		[]byte{
+			0, 0, 0, 33, // Scheduled
+
+			0, 0, 0, 3, // uint32(3)
+
+			0, 0, 1, 139, 207, 229, 104, 123, // uint64(1700000000123)
+		},
+	},
+	{
+		&RoomDetailsResponse{
+			Name:    "abc",
+			Members: 2,
+			Topic:   "",
+			Flags:   RoomJoined | RoomOperator,
+			Retention: Retention{
+				MaxAge:      0,
+				MaxMessages: 100,
+				MaxBytes:    0,
+			},
+			Effective: Retention{
+				MaxAge:      86400,
+				MaxMessages: 100,
+				MaxBytes:    0,
+			},
+		},
+		[]byte{
+			0, 0, 0, 34, // RoomDetails
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 2, // uint32(2)
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 3, // RoomJoined|RoomOperator
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 100, // uint32(100)
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 1, 81, 128, // uint32(86400)
+
+			0, 0, 0, 100, // uint32(100)
+
+			0, 0, 0, 0, // uint32(0)
+		},
+	},
+	{
+		&ScheduledListResponse{
+			Count: 2,
+			Items: []ScheduledItem{
+				{
+					ID:           3,
+					At:           time.UnixMilli(1700000000123).UTC(),
+					Announcement: false,
+					Count:        1,
+					Rooms:        []string{"abc"},
+					Text:         "hi",
+				},
+				{
+					ID:           4,
+					At:           time.UnixMilli(0).UTC(),
+					Announcement: true,
+					Count:        0,
+					Rooms:        []string{},
+					Text:         "",
+				},
+			},
+		},
+		[]byte{
+			0, 0, 0, 35, // ScheduledList
+
+			0, 0, 0, 2, // uint32(2)
+
+			0, 0, 0, 3, // uint32(3)
+
+			0, 0, 1, 139, 207, 229, 104, 123, // uint64(1700000000123)
+
+			0, 0, 0, 0, // false
+
+			0, 0, 0, 1, // uint32(1)
+
+			0, 0, 0, 3, // uint32(3)
+			97, 98, 99, // "abc"
+
+			0, 0, 0, 2, // uint32(2)
+			104, 105, // "hi"
+
+			0, 0, 0, 4, // uint32(4)
+
+			0, 0, 0, 0, 0, 0, 0, 0, // uint64(0)
+
+			0, 0, 0, 1, // true
+
+			0, 0, 0, 0, // uint32(0)
+
+			0, 0, 0, 0, // uint32(0)
+		},
+	},
 }
 
 func TestEncodeErrorType(t *testing.T) {
@@ -0,0 +1,70 @@
+package protocol
+
+import (
+	"strings"
+	"unicode"
+)
+
+// StripControl returns s without terminal escape sequences, control characters,
+// and bidirectional formatting characters that can change how surrounding text is displayed.
+func StripControl(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\x1b' || r == '\u009b':
+			i = skipEscape(runes, i)
+		case unicode.IsControl(r), isBidiControl(r):
+			continue
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
+
+// skipEscape returns the index of the last rune of the escape sequence that starts at runes[i].
+func skipEscape(runes []rune, i int) int {
+	if runes[i] == '\u009b' {
+		return skipCSI(runes, i+1)
+	}
+	if i+1 >= len(runes) {
+		return i
+	}
+
+	switch runes[i+1] {
+	case '[':
+		return skipCSI(runes, i+2)
+	case ']', 'P', 'X', '^', '_':
+		// OSC, DCS, SOS, PM and APC strings end with BEL or ST (ESC \).
+		for j := i + 2; j < len(runes); j++ {
+			if runes[j] == '\a' {
+				return j
+			}
+			if runes[j] == '\x1b' && j+1 < len(runes) && runes[j+1] == '\\' {
+				return j + 1
+			}
+		}
+		return len(runes) - 1
+	default:
+		return i + 1
+	}
+}
+
+// skipCSI returns the index of the final byte of a control sequence whose parameters start at runes[i].
+func skipCSI(runes []rune, i int) int {
+	for ; i < len(runes); i++ {
+		if '@' <= runes[i] && runes[i] <= '~' {
+			return i
+		}
+	}
+	return len(runes) - 1
+}
+
+func isBidiControl(r rune) bool {
+	return ('\u202a' <= r && r <= '\u202e') || ('\u2066' <= r && r <= '\u2069')
+}
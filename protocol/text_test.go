@@ -0,0 +1,40 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/mnxn/chat/generic"
+)
+
+var stripControlTests = []struct {
+	input    string
+	expected string
+}{
+	{"", ""},
+	{"hello, world!", "hello, world!"},
+	{"αβγ 😀", "αβγ 😀"},
+	{"line\nbreak", "linebreak"},
+	{"tab\tbell\a", "tabbell"},
+	{"\x1b[31mred\x1b[0m", "red"},
+	{"\x1b[2J\x1b[Hclear", "clear"},
+	{"\u009b31mred", "red"},
+	{"\x1b]0;title\aafter", "after"},
+	{"\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\", "link"},
+	{"\x1bcreset", "reset"},
+	{"unterminated\x1b[", "unterminated"},
+	{"evil\u202egnp.exe", "evilgnp.exe"},
+}
+
+func TestStripControl(t *testing.T) {
+	t.Parallel()
+
+	for i := range stripControlTests {
+		test := stripControlTests[i]
+		t.Run("StripControl", func(t *testing.T) {
+			t.Parallel()
+
+			actual := StripControl(test.input)
+			generic.TestEqual(t, "strip", test.input, test.expected, actual)
+		})
+	}
+}
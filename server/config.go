@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config holds the settings of a server.
+type Config struct {
+	Name         string    `json:"name"`          // The name of the server that clients are shown.
+	MOTD         string    `json:"motd"`          // The message of the day sent to clients after connecting. Empty for none.
+	Listen       []string  `json:"listen"`        // TCP addresses to accept connections on.
+	Limits       Limits    `json:"limits"`        // Limits on the server's resources.
+	UserNames    NameRules `json:"user_names"`    // Naming requirements for users.
+	RoomNames    NameRules `json:"room_names"`    // Naming requirements for rooms.
+	Text         TextRules `json:"text"`          // Requirements for chat message text.
+	DefaultRooms []string  `json:"default_rooms"` // Rooms that exist from startup and are never removed.
+	BlockedError bool      `json:"blocked_error"` // Reply with a BlockedUser error instead of dropping blocked direct messages.
+	StateFile    string    `json:"state_file"`    // File that registered accounts are saved to. Empty keeps them in memory.
+	HistoryFile  string    `json:"history_file"`  // File that chat messages are logged to. Empty keeps them in memory.
+	Admins       []string  `json:"admins"`        // Registered users that administer the server.
+	Retention    Retention `json:"retention"`     // Limits on the messages of each room and direct conversation kept in the history. Rooms can only be stricter.
+	Rooms        Lifetime  `json:"rooms"`         // When rooms that users create are removed.
+
+	// Policies used instead of UserNames and RoomNames when set.
+	UserPolicy NamePolicy `json:"-"`
+	RoomPolicy NamePolicy `json:"-"`
+}
+
+// Limits bounds the resources that clients can use. Zero means unlimited.
+type Limits struct {
+	MaxUsers int `json:"max_users"` // The number of users that can be connected at once.
+	MaxRooms int `json:"max_rooms"` // The number of rooms that can exist at once.
+
+	// The number of direct messages that can be queued for an offline registered user.
+	// Zero disables queueing.
+	MaxQueued int `json:"max_queued"`
+}
+
+// DefaultConfig returns the configuration used when no config file is given.
+func DefaultConfig() *Config {
+	return &Config{
+		Name:   "chat",
+		MOTD:   "",
+		Listen: []string{":5555"},
+		Limits: Limits{
+			MaxUsers: 0,
+			MaxRooms: 0,
+
+			MaxQueued: 100,
+		},
+		UserNames:    DefaultNameRules(),
+		RoomNames:    DefaultNameRules(),
+		Text:         DefaultTextRules(),
+		DefaultRooms: []string{},
+		BlockedError: false,
+		StateFile:    "",
+		HistoryFile:  "",
+		Admins:       []string{},
+		Retention: Retention{
+			MaxAgeDays:  0,
+			MaxMessages: 0,
+			MaxBytes:    0,
+		},
+		Rooms: Lifetime{
+			Permanent:       false,
+			GraceSeconds:    0,
+			UnjoinedSeconds: 60 * 60,
+		},
+
+		UserPolicy: nil,
+		RoomPolicy: nil,
+	}
+}
+
+// LoadConfig reads the config file at path on top of the default configuration.
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %w", path, err)
+	}
+
+	if len(config.Listen) == 0 {
+		return nil, fmt.Errorf("error in config %s: no listen addresses", path)
+	}
+	if err = config.UserNames.check(); err != nil {
+		return nil, fmt.Errorf("error in config %s: user_names: %w", path, err)
+	}
+	if err = config.RoomNames.check(); err != nil {
+		return nil, fmt.Errorf("error in config %s: room_names: %w", path, err)
+	}
+	if err = config.Text.check(); err != nil {
+		return nil, fmt.Errorf("error in config %s: text: %w", path, err)
+	}
+	if err = config.Retention.check(); err != nil {
+		return nil, fmt.Errorf("error in config %s: retention: %w", path, err)
+	}
+	if err = config.Rooms.check(); err != nil {
+		return nil, fmt.Errorf("error in config %s: rooms: %w", path, err)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mnxn/chat/generic"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "server.json")
+	err := os.WriteFile(path, []byte(`{
+  "name": "test",
+  "motd": "Welcome!",
+  "listen": [":6000"],
+  "limits": {"max_users": 10},
+  "default_rooms": ["general", "random"],
+  "state_file": "/var/lib/chat/state.json",
+  "history_file": "/var/lib/chat/history.jsonl"
+}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic.TestEqual(t, "LoadConfig", "name", "test", config.Name)
+	generic.TestEqual(t, "LoadConfig", "motd", "Welcome!", config.MOTD)
+	generic.TestEqual(t, "LoadConfig", "listen", []string{":6000"}, config.Listen)
+	generic.TestEqual(t, "LoadConfig", "max_users", 10, config.Limits.MaxUsers)
+	generic.TestEqual(t, "LoadConfig", "max_queued default", 100, config.Limits.MaxQueued)
+	generic.TestEqual(t, "LoadConfig", "default_rooms", []string{"general", "random"}, config.DefaultRooms)
+	generic.TestEqual(t, "LoadConfig", "state_file", "/var/lib/chat/state.json", config.StateFile)
+	generic.TestEqual(t, "LoadConfig", "history_file", "/var/lib/chat/history.jsonl", config.HistoryFile)
+
+	invalid := []string{
+		`{"listen": []}`,
+		`{"user_names": {"min_length": 10, "max_length": 5}}`,
+		`{"listen": `,
+	}
+	for _, data := range invalid {
+		err = os.WriteFile(path, []byte(data), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = LoadConfig(path)
+		generic.TestEqual(t, "LoadConfig", data, true, err != nil)
+	}
+}
@@ -1,8 +1,10 @@
 package server
 
 import (
-	"strings"
-	"sync"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/mnxn/chat/protocol"
@@ -23,32 +25,63 @@ func (cu *connectedUser) requireConnected() bool {
 
 func (cu *connectedUser) Keepalive(*protocol.KeepaliveRequest) {}
 
-func (cu *connectedUser) Connect(request *protocol.ConnectRequest) {
-	if cu.connected() {
-		cu.outgoing <- &protocol.FatalErrorResponse{
-			Error: protocol.AlreadyConnected,
-			Info:  "",
+func (cu *connectedUser) Negotiate(request *protocol.NegotiateRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	capabilities := request.Capabilities & supportedCapabilities
+	cu.capabilities.Store(uint32(capabilities))
+
+	cu.outgoing <- &protocol.CapabilitiesResponse{
+		Capabilities: capabilities,
+	}
+
+	if capabilities.Has(protocol.MessageIDs) {
+		u := cu.identity()
+		for _, roomName := range cu.server.joinedRooms(u) {
+			cu.outgoing <- cu.server.readMarker(u, roomName)
+		}
+	}
+
+	if capabilities.Has(protocol.OfflineMessages) {
+		messages, err := cu.server.store.dequeue(cu.name())
+		if err != nil {
+			cu.server.logger.Printf("error removing queued messages of %s: %s\n", cu.name(), err)
+		}
+		for _, message := range messages {
+			cu.outgoing <- &protocol.OfflineMessageResponse{
+				Time:   message.Time,
+				Sender: message.Sender,
+				Text:   message.Text,
+			}
 		}
+	}
+}
+
+func (cu *connectedUser) Connect(request *protocol.ConnectRequest) {
+	name, ok := cu.checkConnect(request.Version, request.Name)
+	if !ok {
 		return
 	}
 
-	if request.Version != 1 {
+	if cu.server.store.registered(name) {
 		cu.outgoing <- &protocol.FatalErrorResponse{
-			Error: protocol.UnsupportedVersion,
-			Info:  "expected version 1",
+			Error: protocol.ExistingUser,
+			Info:  "username is registered",
 		}
 		return
 	}
-	if strings.ContainsRune(request.Name, ' ') {
+	if other := cu.server.store.lookalike(cu.server.userNames, name); other != "" {
 		cu.outgoing <- &protocol.FatalErrorResponse{
 			Error: protocol.InvalidUser,
-			Info:  "username cannot contain spaces",
+			Info:  fmt.Sprintf("username is too similar to registered user %q", other),
 		}
 		return
 	}
 
 	cu.server.usersMutex.Lock()
-	if _, ok := cu.server.users[request.Name]; ok {
+	if _, ok := cu.server.users[name]; ok {
 		cu.outgoing <- &protocol.FatalErrorResponse{
 			Error: protocol.ExistingUser,
 			Info:  "username already exists",
@@ -56,14 +89,145 @@ func (cu *connectedUser) Connect(request *protocol.ConnectRequest) {
 		cu.server.usersMutex.Unlock()
 		return
 	}
-	cu.server.users[request.Name] = cu.user
+	if other := lookalike(cu.server.userNames, name, cu.server.users); other != "" {
+		cu.outgoing <- &protocol.FatalErrorResponse{
+			Error: protocol.InvalidUser,
+			Info:  fmt.Sprintf("username is too similar to existing user %q", other),
+		}
+		cu.server.usersMutex.Unlock()
+		return
+	}
+	if !cu.checkUserLimit() {
+		cu.server.usersMutex.Unlock()
+		return
+	}
+	cu.server.addUser(newUser(name, 0, newBlockList()), cu.session)
+	cu.server.usersMutex.Unlock()
+	cu.sendMOTD()
+}
+
+func (cu *connectedUser) Login(request *protocol.LoginRequest) {
+	name, ok := cu.checkConnect(request.Version, request.Name)
+	if !ok {
+		return
+	}
+
+	id, blocks, ok := cu.server.store.authenticate(name, request.Password)
+	if !ok {
+		cu.outgoing <- &protocol.FatalErrorResponse{
+			Error: protocol.AuthenticationFailed,
+			Info:  "wrong username or password",
+		}
+		return
+	}
+
+	cu.server.usersMutex.Lock()
+	if u, ok := cu.server.users[name]; ok {
+		u.sessionsMutex.Lock()
+		u.sessions[cu.session] = struct{}{}
+		u.sessionsMutex.Unlock()
+		cu.atomicUser.Store(u)
+		cu.server.usersMutex.Unlock()
+		cu.sendMOTD()
+		return
+	}
+	if !cu.checkUserLimit() {
+		cu.server.usersMutex.Unlock()
+		return
+	}
+	u := newUser(name, id, blocks)
+	u.readMarkers = cu.server.store.readMarkers(name)
+	cu.server.addUser(u, cu.session)
 	cu.server.usersMutex.Unlock()
+	cu.sendMOTD()
+}
+
+// checkConnect validates the version and name of a ConnectRequest or LoginRequest.
+func (cu *connectedUser) checkConnect(version uint32, requestName string) (string, bool) {
+	if cu.connected() {
+		cu.outgoing <- &protocol.FatalErrorResponse{
+			Error: protocol.AlreadyConnected,
+			Info:  "",
+		}
+		return "", false
+	}
+
+	if version < protocol.Version1 || version > protocol.Version2 {
+		cu.outgoing <- &protocol.FatalErrorResponse{
+			Error: protocol.UnsupportedVersion,
+			Info:  fmt.Sprintf("expected version %d to %d", protocol.Version1, protocol.Version2),
+		}
+		return "", false
+	}
+	name, err := cu.server.userNames.Validate(requestName)
+	if err != nil {
+		cu.outgoing <- &protocol.FatalErrorResponse{
+			Error: protocol.InvalidUser,
+			Info:  "username " + err.Error(),
+		}
+		return "", false
+	}
+
+	cu.version.Store(version)
+	return name, true
+}
+
+// checkUserLimit reports whether another user can connect. The caller must hold the users mutex.
+func (cu *connectedUser) checkUserLimit() bool {
+	if limit := cu.server.config.Limits.MaxUsers; limit > 0 && len(cu.server.users) >= limit {
+		cu.outgoing <- &protocol.FatalErrorResponse{
+			Error: protocol.LimitReached,
+			Info:  fmt.Sprintf("server is limited to %d users", limit),
+		}
+		return false
+	}
+	return true
+}
+
+func (cu *connectedUser) Register(request *protocol.RegisterRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	u := cu.identity()
+	if u.registered() {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.ExistingUser,
+			Info:  "username is already registered",
+		}
+		return
+	}
+	if request.Password == "" || len(request.Password) > maxPasswordLength {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MalformedRequest,
+			Info:  fmt.Sprintf("password must be between 1 and %d bytes", maxPasswordLength),
+		}
+		return
+	}
+
+	u.blockMutex.RLock()
+	blocks := u.blocks.clone()
+	u.blockMutex.RUnlock()
 
-	cu.atomicName.Store(&request.Name)
+	id, err := cu.server.store.register(u.name(), request.Password, blocks)
+	if errors.Is(err, errExistingAccount) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.ExistingUser,
+			Info:  "username is already registered",
+		}
+		return
+	} else if err != nil {
+		cu.server.logger.Printf("error registering %s: %s\n", u.name(), err)
+	}
+	u.account.Store(id)
+	cu.server.saveReadMarkers(u)
 
-	cu.server.general.usersMutex.Lock()
-	cu.server.general.users[request.Name] = cu.user
-	cu.server.general.usersMutex.Unlock()
+	if contains(cu.server.config.Admins, u.name()) {
+		err = cu.server.store.bindAdmin(u.name())
+		if err != nil {
+			cu.server.logger.Printf("error saving administrator %s: %s\n", u.name(), err)
+		}
+	}
 }
 
 func (cu *connectedUser) Disconnect(*protocol.DisconnectRequest) {
@@ -82,11 +246,17 @@ func (cu *connectedUser) ListRooms(request *protocol.ListRoomsRequest) {
 	cu.server.roomsMutex.RLock()
 	rooms := make([]string, 0, len(cu.server.rooms))
 	for roomName, room := range cu.server.rooms {
-		if request.User == "" || room.contains(request.User) {
+		if cu.listsRoom(room, request.User) {
 			rooms = append(rooms, roomName)
 		}
 	}
 	cu.server.roomsMutex.RUnlock()
+	sort.Strings(rooms)
+
+	if cu.uses(protocol.Version2) {
+		cu.outgoing <- cu.roomEntries(request.User, "", rooms)
+		return
+	}
 
 	cu.outgoing <- &protocol.RoomListResponse{
 		User:  request.User,
@@ -95,165 +265,1388 @@ func (cu *connectedUser) ListRooms(request *protocol.ListRoomsRequest) {
 	}
 }
 
+// listsRoom reports whether a room is listed for the rooms of a user, or for the entire server if userName is empty.
+// The rooms of other users are only listed if the client user has joined them as well.
+func (cu *connectedUser) listsRoom(room *room, userName string) bool {
+	return userName == "" || (room.contains(userName) && room.contains(cu.name()))
+}
+
 func (cu *connectedUser) ListUsers(request *protocol.ListUsersRequest) {
 	if !cu.requireConnected() {
 		return
 	}
 
-	var users []string
-	if request.Room != "" {
-		cu.server.roomsMutex.RLock()
-		room, ok := cu.server.rooms[request.Room]
-		cu.server.roomsMutex.RUnlock()
-		if !ok {
-			cu.outgoing <- &protocol.ErrorResponse{
-				Error: protocol.MissingRoom,
-				Info:  request.Room,
+	users, ok := cu.listedUsers(request.Room)
+	if !ok {
+		return
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].name() < users[j].name()
+	})
+
+	if cu.uses(protocol.Version2) {
+		cu.outgoing <- userEntries(request.Room, "", users)
+		return
+	}
+
+	if cu.has(protocol.PresenceUpdates) {
+		entries := make([]protocol.UserPresence, len(users))
+		for i, user := range users {
+			presence, message := user.status()
+			entries[i] = protocol.UserPresence{
+				Name:     user.name(),
+				Presence: presence,
+				Message:  message,
 			}
-			return
 		}
 
-		room.usersMutex.RLock()
-		users = make([]string, 0, len(room.users))
-		for user := range room.users {
-			users = append(users, user)
-		}
-		room.usersMutex.RUnlock()
-	} else {
-		cu.server.usersMutex.RLock()
-		users = make([]string, 0, len(cu.server.users))
-		for user := range cu.server.users {
-			users = append(users, user)
+		cu.outgoing <- &protocol.PresenceListResponse{
+			Room:  request.Room,
+			Count: uint32(len(entries)),
+			Users: entries,
 		}
-		cu.server.usersMutex.RUnlock()
+		return
+	}
+
+	names := make([]string, len(users))
+	for i, user := range users {
+		names[i] = user.name()
 	}
 
 	cu.outgoing <- &protocol.UserListResponse{
-		Count: uint32(len(users)),
+		Count: uint32(len(names)),
 		Room:  request.Room,
-		Users: users,
+		Users: names,
 	}
 }
 
-func (cu *connectedUser) MessageRoom(request *protocol.MessageRoomRequest) {
-	if !cu.requireConnected() {
-		return
+// listedUsers returns the users of a room that the user has joined, or of the entire server if roomName is empty.
+// It responds with an error if the room cannot be listed.
+func (cu *connectedUser) listedUsers(roomName string) ([]*user, bool) {
+	if roomName == "" {
+		cu.server.usersMutex.RLock()
+		users := make([]*user, 0, len(cu.server.users))
+		for _, user := range cu.server.users {
+			users = append(users, user)
+		}
+		cu.server.usersMutex.RUnlock()
+		return users, true
 	}
 
 	cu.server.roomsMutex.RLock()
-	room, ok := cu.server.rooms[request.Room]
+	room, ok := cu.server.rooms[roomName]
 	cu.server.roomsMutex.RUnlock()
 	if !ok {
 		cu.outgoing <- &protocol.ErrorResponse{
 			Error: protocol.MissingRoom,
-			Info:  request.Room,
+			Info:  roomName,
 		}
-		return
+		return nil, false
+	}
+	if !room.contains(cu.name()) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.NotInRoom,
+			Info:  roomName,
+		}
+		return nil, false
 	}
 
 	room.usersMutex.RLock()
+	users := make([]*user, 0, len(room.users))
 	for _, user := range room.users {
-		if user.name() != cu.name() {
-			user.outgoing <- &protocol.RoomMessageResponse{
-				Room:   request.Room,
-				Sender: cu.name(),
-				Text:   request.Text,
-			}
-		}
+		users = append(users, user)
 	}
 	room.usersMutex.RUnlock()
+	return users, true
 }
 
-func (cu *connectedUser) MessageUser(request *protocol.MessageUserRequest) {
+func (cu *connectedUser) ListRoomsPage(request *protocol.ListRoomsPageRequest) {
 	if !cu.requireConnected() {
 		return
 	}
 
-	cu.server.usersMutex.RLock()
-	user, ok := cu.server.users[request.User]
-	cu.server.usersMutex.RUnlock()
-	if !ok {
+	err := validateFilter(request.Filter)
+	if err != nil {
 		cu.outgoing <- &protocol.ErrorResponse{
-			Error: protocol.MissingUser,
-			Info:  request.User,
+			Error: protocol.InvalidFilter,
+			Info:  err.Error(),
+		}
+		return
+	}
+
+	cu.server.roomsMutex.RLock()
+	entries := make([]pageEntry[protocol.RoomInfo], 0, len(cu.server.rooms))
+	for roomName, room := range cu.server.rooms {
+		if !cu.listsRoom(room, request.User) || !matchFilter(request.Filter, roomName) {
+			continue
+		}
+		info := room.info(roomName)
+		entries = append(entries, pageEntry[protocol.RoomInfo]{
+			key:   sortKey(request.Order, roomName, int(info.Members)),
+			value: info,
+		})
+	}
+	cu.server.roomsMutex.RUnlock()
+
+	rooms, next := page(entries, request.Cursor, request.Limit)
+	if cu.uses(protocol.Version2) {
+		names := make([]string, len(rooms))
+		for i, room := range rooms {
+			names[i] = room.Name
 		}
+		cu.outgoing <- cu.roomEntries(request.User, next, names)
 		return
 	}
 
-	user.outgoing <- &protocol.UserMessageResponse{
-		Sender: cu.name(),
-		Text:   request.Text,
+	cu.outgoing <- &protocol.RoomPageResponse{
+		User:  request.User,
+		Next:  next,
+		Count: uint32(len(rooms)),
+		Rooms: rooms,
 	}
 }
 
-func (cu *connectedUser) CreateRoom(request *protocol.CreateRoomRequest) {
+func (cu *connectedUser) ListUsersPage(request *protocol.ListUsersPageRequest) {
 	if !cu.requireConnected() {
 		return
 	}
 
-	if strings.ContainsRune(request.Room, ' ') {
+	err := validateFilter(request.Filter)
+	if err != nil {
 		cu.outgoing <- &protocol.ErrorResponse{
-			Error: protocol.InvalidRoom,
-			Info:  request.Room,
+			Error: protocol.InvalidFilter,
+			Info:  err.Error(),
 		}
 		return
 	}
 
-	cu.server.roomsMutex.Lock()
-	if _, ok := cu.server.rooms[request.Room]; ok {
-		cu.outgoing <- &protocol.ErrorResponse{
-			Error: protocol.ExistingRoom,
-			Info:  request.Room,
+	users, ok := cu.listedUsers(request.Room)
+	if !ok {
+		return
+	}
+
+	entries := make([]pageEntry[*user], 0, len(users))
+	for _, listed := range users {
+		name := listed.name()
+		if !matchFilter(request.Filter, name) {
+			continue
 		}
-		cu.server.roomsMutex.Unlock()
+		size := 0
+		if request.Order == protocol.OrderBySize {
+			size = len(cu.server.joinedRooms(listed))
+		}
+		entries = append(entries, pageEntry[*user]{
+			key:   sortKey(request.Order, name, size),
+			value: listed,
+		})
+	}
+
+	users, next := page(entries, request.Cursor, request.Limit)
+	if cu.uses(protocol.Version2) {
+		cu.outgoing <- userEntries(request.Room, next, users)
 		return
 	}
-	cu.server.rooms[request.Room] = &room{
-		users:      make(map[string]*user),
-		usersMutex: sync.RWMutex{},
+
+	presences := make([]protocol.UserPresence, len(users))
+	for i, user := range users {
+		presence, message := user.status()
+		presences[i] = protocol.UserPresence{
+			Name:     user.name(),
+			Presence: presence,
+			Message:  message,
+		}
+	}
+	cu.outgoing <- &protocol.UserPageResponse{
+		Room:  request.Room,
+		Next:  next,
+		Count: uint32(len(presences)),
+		Users: presences,
 	}
-	cu.server.roomsMutex.Unlock()
 }
 
-func (cu *connectedUser) JoinRoom(request *protocol.JoinRoomRequest) {
+func (cu *connectedUser) MessageRoom(request *protocol.MessageRoomRequest) {
 	if !cu.requireConnected() {
 		return
 	}
 
+	text, err := cu.server.config.Text.validate(request.Text)
+	if err != nil {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidText,
+			Info:  "message " + err.Error(),
+		}
+		return
+	}
+
+	cu.messageRoom(request.Room, text, 0)
+}
+
+// messageRoom sends validated text to a room, optionally as a reply to another chat message.
+func (cu *connectedUser) messageRoom(roomName, text string, replyTo protocol.MessageID) {
+	room, ok := cu.postableRoom(roomName)
+	if !ok {
+		return
+	}
+
+	cu.server.relayRoomMessage(cu.identity(), roomName, room, text, replyTo)
+}
+
+// postableRoom returns the room that the client user wants to send a chat message to,
+// or responds with an error if the room does not exist or the client user cannot post to it.
+func (cu *connectedUser) postableRoom(roomName string) (*room, bool) {
 	cu.server.roomsMutex.RLock()
-	room, ok := cu.server.rooms[request.Room]
+	room, ok := cu.server.rooms[roomName]
 	cu.server.roomsMutex.RUnlock()
 	if !ok {
 		cu.outgoing <- &protocol.ErrorResponse{
 			Error: protocol.MissingRoom,
-			Info:  request.Room,
+			Info:  roomName,
 		}
-		return
+		return nil, false
+	}
+	if !room.accepts(cu.name()) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.NotInRoom,
+			Info:  roomName,
+		}
+		return nil, false
+	}
+	return room, true
+}
+
+// relayRoomMessage stores a chat message from sender and sends it to the members and subscribers of the room.
+func (s *Server) relayRoomMessage(sender *user, roomName string, room *room, text string, replyTo protocol.MessageID) {
+	m := s.storeMessage(sender, replyTo, roomName, nil, text, false)
+	full := m.response()
+	legacy := &protocol.RoomMessageResponse{
+		Room:   roomName,
+		Sender: sender.name(),
+		Text:   text,
 	}
 
-	room.usersMutex.Lock()
-	room.users[cu.name()] = cu.user
-	room.usersMutex.Unlock()
+	room.usersMutex.RLock()
+	for _, user := range room.users {
+		if user != sender {
+			user.each(chatMessage(full, legacy))
+		}
+	}
+	room.usersMutex.RUnlock()
+
+	sender.each(echoMessage(full, legacy))
+	s.notifySubscribers(roomName, room, chatMessage(full, legacy))
 }
 
-func (cu *connectedUser) LeaveRoom(request *protocol.LeaveRoomRequest) {
+// storeMessage adds a chat message from sender to the history.
+// The message is sent either to a room or to a recipient.
+func (s *Server) storeMessage(sender *user, replyTo protocol.MessageID, room string, recipient *user, text string, dropped bool) *message {
+	m := &message{
+		ID:        0,
+		Time:      time.Time{},
+		ReplyTo:   replyTo,
+		Room:      room,
+		Sender:    sender.name(),
+		Recipient: "",
+		Text:      text,
+
+		Account:          sender.account.Load(),
+		RecipientAccount: 0,
+		Dropped:          dropped,
+		Edited:           nil,
+		Deleted:          false,
+
+		author:    sender,
+		recipient: recipient,
+	}
+	if recipient != nil {
+		m.Recipient = recipient.name()
+		m.RecipientAccount = recipient.account.Load()
+	}
+
+	err := s.history.add(m)
+	if err != nil {
+		s.logger.Printf("error storing message %d: %s\n", m.ID, err)
+	}
+	return m
+}
+
+func (cu *connectedUser) MessageUser(request *protocol.MessageUserRequest) {
 	if !cu.requireConnected() {
 		return
 	}
 
-	cu.server.roomsMutex.Lock()
-	room, ok := cu.server.rooms[request.Room]
+	text, err := cu.server.config.Text.validate(request.Text)
+	if err != nil {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidText,
+			Info:  "message " + err.Error(),
+		}
+		return
+	}
 
-	if !ok {
+	cu.messageUser(request.User, text, 0)
+}
+
+// messageUser sends validated text to a user, optionally as a reply to another chat message.
+func (cu *connectedUser) messageUser(userName, text string, replyTo protocol.MessageID) {
+	cu.server.usersMutex.RLock()
+	user, online := cu.server.users[userName]
+	cu.server.usersMutex.RUnlock()
+	queueable := cu.server.config.Limits.MaxQueued > 0 && cu.server.store.registered(userName)
+	if !online && !queueable {
 		cu.outgoing <- &protocol.ErrorResponse{
-			Error: protocol.MissingRoom,
-			Info:  request.Room,
+			Error: protocol.MissingUser,
+			Info:  userName,
 		}
-		cu.server.roomsMutex.Unlock()
 		return
 	}
 
-	cu.server.removeRoomUser(request.Room, room, cu.user)
+	sender := cu.identity()
+	sender.blockMutex.Lock()
+	_, known := sender.blocks.contacts[userName]
+	sender.blocks.contacts[userName] = struct{}{}
+	sender.blockMutex.Unlock()
+	if !known {
+		cu.server.saveBlocks(sender)
+	}
+
+	legacyEcho := &protocol.UserMessageEchoResponse{
+		Recipient: userName,
+		Text:      text,
+	}
 
-	cu.server.roomsMutex.Unlock()
+	if !online {
+		if cu.queueMessage(userName, text) {
+			sender.echo(legacyEcho)
+		}
+		return
+	}
+
+	accepted := user.accepts(cu.name())
+	if !accepted && cu.server.config.BlockedError {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.BlockedUser,
+			Info:  userName,
+		}
+		return
+	}
+
+	m := cu.server.storeMessage(sender, replyTo, "", user, text, !accepted)
+	full := m.response()
+	if accepted {
+		user.each(deliver(m.ID, chatMessage(full, &protocol.UserMessageResponse{
+			Sender: cu.name(),
+			Text:   text,
+		})))
+	} else {
+		// Silently dropped messages are reported as delivered as well.
+		go cu.server.receipt(m.ID, false)
+	}
+
+	if cu.has(protocol.PresenceUpdates) {
+		if presence, message := user.status(); presence != protocol.Online {
+			cu.outgoing <- &protocol.AutoReplyResponse{
+				User:     userName,
+				Presence: presence,
+				Message:  message,
+			}
+		}
+	}
+
+	// Silently dropped messages are echoed as well so that the sender cannot tell that they were blocked.
+	sender.each(echoMessage(full, legacyEcho))
+}
+
+// queueMessage queues a direct message for an offline registered user and notifies the sender.
+// It reports whether the message should be echoed to the sender.
+func (cu *connectedUser) queueMessage(recipient, text string) bool {
+	if !cu.server.store.accepts(recipient, cu.name()) {
+		if cu.server.config.BlockedError {
+			cu.outgoing <- &protocol.ErrorResponse{
+				Error: protocol.BlockedUser,
+				Info:  recipient,
+			}
+			return false
+		}
+	} else {
+		err := cu.server.store.enqueue(recipient, queuedMessage{
+			Time:   time.Now().UTC(),
+			Sender: cu.name(),
+			Text:   text,
+		}, cu.server.config.Limits.MaxQueued)
+		if errors.Is(err, errQueueFull) {
+			cu.outgoing <- &protocol.ErrorResponse{
+				Error: protocol.LimitReached,
+				Info:  fmt.Sprintf("%s cannot receive more than %d queued messages", recipient, cu.server.config.Limits.MaxQueued),
+			}
+			return false
+		} else if err != nil {
+			cu.server.logger.Printf("error queueing message for %s: %s\n", recipient, err)
+		}
+	}
+
+	// Messages to users that block the sender are reported as queued as well.
+	if cu.has(protocol.OfflineMessages) {
+		cu.outgoing <- &protocol.MessageQueuedResponse{
+			Recipient: recipient,
+		}
+	}
+	return true
+}
+
+func (cu *connectedUser) CreateRoom(request *protocol.CreateRoomRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	roomName, err := cu.server.roomNames.Validate(request.Room)
+	if err != nil {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidRoom,
+			Info:  "room name " + err.Error(),
+		}
+		return
+	}
+
+	cu.server.roomsMutex.Lock()
+	if _, ok := cu.server.rooms[roomName]; ok {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.ExistingRoom,
+			Info:  roomName,
+		}
+		cu.server.roomsMutex.Unlock()
+		return
+	}
+	if other := lookalike(cu.server.roomNames, roomName, cu.server.rooms); other != "" {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidRoom,
+			Info:  fmt.Sprintf("room name is too similar to existing room %q", other),
+		}
+		cu.server.roomsMutex.Unlock()
+		return
+	}
+	if limit := cu.server.config.Limits.MaxRooms; limit > 0 && len(cu.server.rooms) >= limit {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.LimitReached,
+			Info:  fmt.Sprintf("server is limited to %d rooms", limit),
+		}
+		cu.server.roomsMutex.Unlock()
+		return
+	}
+	cu.server.rooms[roomName] = newRoom(false, cu.name())
+	cu.server.roomsMutex.Unlock()
+}
+
+func (cu *connectedUser) JoinRoom(request *protocol.JoinRoomRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	// The rooms mutex is held until the user has joined so that sweepRooms cannot remove the room in between.
+	cu.server.roomsMutex.RLock()
+	room, ok := cu.server.rooms[request.Room]
+	if !ok {
+		cu.server.roomsMutex.RUnlock()
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingRoom,
+			Info:  request.Room,
+		}
+		return
+	}
+
+	u := cu.identity()
+	room.usersMutex.Lock()
+	room.users[cu.name()] = u
+	room.joined = true
+	room.emptySince = time.Time{}
+	room.usersMutex.Unlock()
+	cu.server.roomsMutex.RUnlock()
+
+	u.notify(protocol.MessageIDs, cu.server.readMarker(u, request.Room))
+}
+
+func (cu *connectedUser) LeaveRoom(request *protocol.LeaveRoomRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	cu.server.roomsMutex.Lock()
+	room, ok := cu.server.rooms[request.Room]
+
+	if !ok {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingRoom,
+			Info:  request.Room,
+		}
+		cu.server.roomsMutex.Unlock()
+		return
+	}
+
+	cu.server.removeRoomUser(request.Room, room, cu.identity())
+
+	cu.server.roomsMutex.Unlock()
+}
+
+func (cu *connectedUser) Block(request *protocol.BlockRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	u := cu.identity()
+	u.blockMutex.Lock()
+	if request.User == "" {
+		u.blocks.strangers = true
+	} else {
+		u.blocks.blocked[request.User] = struct{}{}
+	}
+	u.blockMutex.Unlock()
+
+	cu.server.saveBlocks(u)
+}
+
+func (cu *connectedUser) Unblock(request *protocol.UnblockRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	u := cu.identity()
+	u.blockMutex.Lock()
+	if request.User == "" {
+		u.blocks.strangers = false
+	} else {
+		delete(u.blocks.blocked, request.User)
+	}
+	u.blockMutex.Unlock()
+
+	cu.server.saveBlocks(u)
+}
+
+func (cu *connectedUser) ListBlocks(*protocol.ListBlocksRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	u := cu.identity()
+	u.blockMutex.RLock()
+	strangers := u.blocks.strangers
+	users := sortedKeys(u.blocks.blocked)
+	u.blockMutex.RUnlock()
+
+	cu.outgoing <- &protocol.BlockListResponse{
+		Strangers: strangers,
+		Count:     uint32(len(users)),
+		Users:     users,
+	}
+}
+
+func (cu *connectedUser) SetRoomOption(request *protocol.SetRoomOptionRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	cu.server.roomsMutex.RLock()
+	room, ok := cu.server.rooms[request.Room]
+	cu.server.roomsMutex.RUnlock()
+	if !ok {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingRoom,
+			Info:  request.Room,
+		}
+		return
+	}
+	if !room.isOperator(cu.name()) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.PermissionDenied,
+			Info:  "only room operators can change room options",
+		}
+		return
+	}
+
+	switch request.Option {
+	case protocol.AllowOutsidePosts:
+		if request.Value > 1 {
+			cu.outgoing <- &protocol.ErrorResponse{
+				Error: protocol.MalformedRequest,
+				Info:  "AllowOutsidePosts must be 0 or 1",
+			}
+			return
+		}
+		room.optionsMutex.Lock()
+		room.allowOutsidePosts = request.Value == 1
+		room.optionsMutex.Unlock()
+
+	case protocol.Lifetime:
+		if request.Value > protocol.PermanentRoom {
+			cu.outgoing <- &protocol.ErrorResponse{
+				Error: protocol.MalformedRequest,
+				Info:  "Lifetime must be 0 (default), 1 (ephemeral) or 2 (permanent)",
+			}
+			return
+		}
+		if room.permanent {
+			cu.outgoing <- &protocol.ErrorResponse{
+				Error: protocol.PermissionDenied,
+				Info:  "the server always keeps this room",
+			}
+			return
+		}
+		room.optionsMutex.Lock()
+		room.lifetime = request.Value
+		room.optionsMutex.Unlock()
+
+	case protocol.GracePeriod:
+		if request.Value > maxGracePeriod {
+			cu.outgoing <- &protocol.ErrorResponse{
+				Error: protocol.LimitReached,
+				Info:  fmt.Sprintf("GracePeriod is limited to %d seconds", maxGracePeriod),
+			}
+			return
+		}
+		room.optionsMutex.Lock()
+		room.gracePeriod = time.Duration(request.Value) * time.Second
+		room.optionsMutex.Unlock()
+	}
+}
+
+func (cu *connectedUser) SetTopic(request *protocol.SetTopicRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	cu.server.roomsMutex.RLock()
+	room, ok := cu.server.rooms[request.Room]
+	cu.server.roomsMutex.RUnlock()
+	if !ok {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingRoom,
+			Info:  request.Room,
+		}
+		return
+	}
+	if !room.isOperator(cu.name()) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.PermissionDenied,
+			Info:  "only room operators can change the topic",
+		}
+		return
+	}
+
+	topic := request.Topic
+	if topic != "" {
+		var err error
+		topic, err = cu.server.config.Text.validate(topic)
+		if err != nil {
+			cu.outgoing <- &protocol.ErrorResponse{
+				Error: protocol.InvalidText,
+				Info:  "topic " + err.Error(),
+			}
+			return
+		}
+	}
+
+	room.optionsMutex.Lock()
+	room.topic = topic
+	room.optionsMutex.Unlock()
+}
+
+func (cu *connectedUser) Subscribe(request *protocol.SubscribeRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	err := validateFilter(request.Pattern)
+	if err != nil || request.Pattern == "" {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidFilter,
+			Info:  fmt.Sprintf("%q is not a valid pattern", request.Pattern),
+		}
+		return
+	}
+
+	if !cu.server.canMonitor(cu.identity(), request.Pattern) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.PermissionDenied,
+			Info:  "only administrators and the operators of a matching room can subscribe",
+		}
+		return
+	}
+
+	if !cu.server.subscribe(cu.session, request.Pattern) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.LimitReached,
+			Info:  fmt.Sprintf("a connection can have at most %d subscriptions", maxSubscriptions),
+		}
+		return
+	}
+
+	cu.outgoing <- cu.subscriptionList()
+}
+
+func (cu *connectedUser) Unsubscribe(request *protocol.UnsubscribeRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	cu.server.unsubscribe(cu.session, request.Pattern)
+	cu.outgoing <- cu.subscriptionList()
+}
+
+func (cu *connectedUser) SetPresence(request *protocol.SetPresenceRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	message := request.Message
+	if message != "" {
+		var err error
+		message, err = cu.server.config.Text.validate(message)
+		if err != nil {
+			cu.outgoing <- &protocol.ErrorResponse{
+				Error: protocol.InvalidText,
+				Info:  "status message " + err.Error(),
+			}
+			return
+		}
+	}
+
+	u := cu.identity()
+	u.presenceMutex.Lock()
+	u.presence = request.Presence
+	u.presenceMessage = message
+	u.presenceMutex.Unlock()
+
+	response := &protocol.PresenceChangeResponse{
+		User:     u.name(),
+		Presence: request.Presence,
+		Message:  message,
+	}
+	for neighbor := range cu.server.neighbors(u) {
+		neighbor.notify(protocol.PresenceUpdates, response)
+	}
+}
+
+func (cu *connectedUser) Typing(request *protocol.TypingRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	switch {
+	case request.Room != "" && request.User == "":
+		cu.server.roomsMutex.RLock()
+		room, ok := cu.server.rooms[request.Room]
+		cu.server.roomsMutex.RUnlock()
+		if !ok || !room.accepts(cu.name()) || !cu.allowTyping("#"+request.Room) {
+			return
+		}
+
+		response := &protocol.UserTypingResponse{
+			User: cu.name(),
+			Room: request.Room,
+		}
+		sender := cu.identity()
+		room.usersMutex.RLock()
+		for _, user := range room.users {
+			if user != sender {
+				user.notify(protocol.TypingNotifications, response)
+			}
+		}
+		room.usersMutex.RUnlock()
+
+	case request.User != "" && request.Room == "":
+		cu.server.usersMutex.RLock()
+		user, ok := cu.server.users[request.User]
+		cu.server.usersMutex.RUnlock()
+		if !ok || !user.accepts(cu.name()) || !cu.allowTyping("@"+request.User) {
+			return
+		}
+
+		user.notify(protocol.TypingNotifications, &protocol.UserTypingResponse{
+			User: cu.name(),
+			Room: "",
+		})
+	}
+}
+
+func (cu *connectedUser) ChangeName(request *protocol.ChangeNameRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	newName, err := cu.server.userNames.Validate(request.Name)
+	if err != nil {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidUser,
+			Info:  "username " + err.Error(),
+		}
+		return
+	}
+
+	u := cu.identity()
+	cu.server.usersMutex.Lock()
+	oldName := u.name()
+	if newName == oldName {
+		cu.server.usersMutex.Unlock()
+		return
+	}
+	if _, ok := cu.server.users[newName]; ok || cu.server.store.registered(newName) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.ExistingUser,
+			Info:  "username already exists",
+		}
+		cu.server.usersMutex.Unlock()
+		return
+	}
+	other := lookalike(cu.server.userNames, newName, cu.server.users, oldName)
+	if other == "" {
+		other = cu.server.store.lookalike(cu.server.userNames, newName, oldName)
+	}
+	if other != "" {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidUser,
+			Info:  fmt.Sprintf("username is too similar to existing user %q", other),
+		}
+		cu.server.usersMutex.Unlock()
+		return
+	}
+	err = cu.server.store.rename(oldName, newName)
+	if err != nil {
+		cu.server.logger.Printf("error renaming account %s: %s\n", oldName, err)
+	}
+	cu.server.renameUser(u, newName)
+	cu.server.usersMutex.Unlock()
+
+	cu.server.logger.Printf("user renamed: %s -> %s\n", oldName, newName)
+
+	response := &protocol.NameChangedResponse{
+		OldName: oldName,
+		NewName: newName,
+	}
+	for neighbor := range cu.server.neighbors(u) {
+		neighbor.notify(protocol.NameChanges, response)
+	}
+}
+
+func (cu *connectedUser) EditMessage(request *protocol.EditMessageRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	text, err := cu.server.config.Text.validate(request.Text)
+	if err != nil {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidText,
+			Info:  "message " + err.Error(),
+		}
+		return
+	}
+
+	m, ok := cu.server.history.get(request.ID)
+	if !ok {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingMessage,
+			Info:  strconv.FormatUint(uint64(request.ID), 10),
+		}
+		return
+	}
+	if !m.sentBy(cu.identity()) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.PermissionDenied,
+			Info:  "only the sender can edit a message",
+		}
+		return
+	}
+
+	m, err = cu.server.history.edit(request.ID, text)
+	if errors.Is(err, errMissingMessage) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingMessage,
+			Info:  strconv.FormatUint(uint64(request.ID), 10),
+		}
+		return
+	} else if err != nil {
+		cu.server.logger.Printf("error editing message %d: %s\n", request.ID, err)
+	}
+
+	cu.server.notifyMessage(m, &protocol.MessageEditedResponse{
+		ID:     m.ID,
+		Time:   *m.Edited,
+		Room:   m.Room,
+		Sender: m.Sender,
+		Text:   m.Text,
+	})
+}
+
+func (cu *connectedUser) DeleteMessage(request *protocol.DeleteMessageRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	m, ok := cu.server.history.get(request.ID)
+	if !ok {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingMessage,
+			Info:  strconv.FormatUint(uint64(request.ID), 10),
+		}
+		return
+	}
+
+	allowed := m.sentBy(cu.identity())
+	if !allowed && m.Room != "" {
+		cu.server.roomsMutex.RLock()
+		room, ok := cu.server.rooms[m.Room]
+		cu.server.roomsMutex.RUnlock()
+		allowed = ok && room.isOperator(cu.name())
+	}
+	if !allowed {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.PermissionDenied,
+			Info:  "only the sender or a room operator can delete a message",
+		}
+		return
+	}
+
+	err := cu.server.history.remove(request.ID)
+	if errors.Is(err, errMissingMessage) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingMessage,
+			Info:  strconv.FormatUint(uint64(request.ID), 10),
+		}
+		return
+	} else if err != nil {
+		cu.server.logger.Printf("error deleting message %d: %s\n", request.ID, err)
+	}
+
+	cu.server.notifyMessage(m, &protocol.MessageDeletedResponse{
+		ID:   m.ID,
+		Room: m.Room,
+		User: cu.name(),
+	})
+}
+
+func (cu *connectedUser) Reply(request *protocol.ReplyRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	text, err := cu.server.config.Text.validate(request.Text)
+	if err != nil {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidText,
+			Info:  "message " + err.Error(),
+		}
+		return
+	}
+
+	parent, ok := cu.server.history.get(request.ReplyTo)
+	if !ok || !cu.server.visible(parent, cu.identity()) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingMessage,
+			Info:  strconv.FormatUint(uint64(request.ReplyTo), 10),
+		}
+		return
+	}
+
+	switch {
+	case parent.Room != "":
+		cu.messageRoom(parent.Room, text, parent.ID)
+	case parent.sentBy(cu.identity()):
+		cu.messageUser(parent.Recipient, text, parent.ID)
+	default:
+		cu.messageUser(parent.Sender, text, parent.ID)
+	}
+}
+
+func (cu *connectedUser) ListThread(request *protocol.ListThreadRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	u := cu.identity()
+	thread, ok := cu.server.history.thread(request.Root)
+	if !ok || !cu.server.visible(thread[0], u) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingMessage,
+			Info:  strconv.FormatUint(uint64(request.Root), 10),
+		}
+		return
+	}
+
+	messages := make([]protocol.ChatMessageResponse, 0, len(thread))
+	for i := range thread {
+		if cu.server.visible(thread[i], u) {
+			messages = append(messages, *thread[i].response())
+		}
+	}
+
+	cu.outgoing <- &protocol.ThreadResponse{
+		Root:     request.Root,
+		Count:    uint32(len(messages)),
+		Messages: messages,
+	}
+}
+
+func (cu *connectedUser) SearchMessages(request *protocol.SearchMessagesRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	rooms := make(map[string]struct{})
+	for _, roomName := range cu.server.joinedRooms(cu.identity()) {
+		rooms[roomName] = struct{}{}
+	}
+	if request.Room != "" {
+		cu.server.roomsMutex.RLock()
+		_, ok := cu.server.rooms[request.Room]
+		cu.server.roomsMutex.RUnlock()
+		if !ok {
+			cu.outgoing <- &protocol.ErrorResponse{
+				Error: protocol.MissingRoom,
+				Info:  request.Room,
+			}
+			return
+		}
+		if _, ok := rooms[request.Room]; !ok {
+			cu.outgoing <- &protocol.ErrorResponse{
+				Error: protocol.NotInRoom,
+				Info:  request.Room,
+			}
+			return
+		}
+		rooms = map[string]struct{}{request.Room: {}}
+	}
+
+	limit := int(request.Limit)
+	if limit == 0 {
+		limit = defaultSearchResults
+	} else if limit > maxSearchResults {
+		limit = maxSearchResults
+	}
+
+	query := searchQuery{
+		terms:  searchTerms(request.Query),
+		rooms:  rooms,
+		sender: request.Sender,
+		after:  time.Time{},
+		before: time.Time{},
+		cursor: request.Cursor,
+		limit:  limit,
+	}
+	if request.After.UnixMilli() != 0 {
+		query.after = request.After
+	}
+	if request.Before.UnixMilli() != 0 {
+		query.before = request.Before
+	}
+
+	results, next := cu.server.history.search(query)
+	messages := make([]protocol.ChatMessageResponse, len(results))
+	for i := range results {
+		messages[i] = *results[i].response()
+	}
+
+	cu.outgoing <- &protocol.SearchResultsResponse{
+		Query:    request.Query,
+		Next:     next,
+		Count:    uint32(len(messages)),
+		Messages: messages,
+	}
+}
+
+func (cu *connectedUser) React(request *protocol.ReactRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	err := validateReaction(request.Reaction)
+	if err != nil {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidReaction,
+			Info:  "reaction " + err.Error(),
+		}
+		return
+	}
+
+	cu.react(request.ID, request.Reaction, true)
+}
+
+func (cu *connectedUser) Unreact(request *protocol.UnreactRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	cu.react(request.ID, request.Reaction, false)
+}
+
+// react adds or removes a reaction of the user and notifies the users that can see the message.
+func (cu *connectedUser) react(id protocol.MessageID, reaction string, add bool) {
+	m, ok := cu.server.history.get(id)
+	if !ok || !cu.server.visible(m, cu.identity()) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingMessage,
+			Info:  strconv.FormatUint(uint64(id), 10),
+		}
+		return
+	}
+
+	m, changed, err := cu.server.history.react(id, cu.name(), reaction, add)
+	switch {
+	case errors.Is(err, errMissingMessage):
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingMessage,
+			Info:  strconv.FormatUint(uint64(id), 10),
+		}
+		return
+	case errors.Is(err, errReactionLimit):
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.LimitReached,
+			Info:  fmt.Sprintf("a message can have at most %d different reactions", maxReactions),
+		}
+		return
+	case err != nil:
+		cu.server.logger.Printf("error storing reaction to message %d: %s\n", id, err)
+	}
+	if !changed {
+		return
+	}
+
+	reactions := m.reactions()
+	cu.server.notifyMessage(m, &protocol.ReactionListResponse{
+		ID:        m.ID,
+		Room:      m.Room,
+		User:      cu.name(),
+		Count:     uint32(len(reactions)),
+		Reactions: reactions,
+	})
+}
+
+func (cu *connectedUser) MarkRead(request *protocol.MarkReadRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	cu.server.roomsMutex.RLock()
+	room, ok := cu.server.rooms[request.Room]
+	cu.server.roomsMutex.RUnlock()
+	if !ok {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingRoom,
+			Info:  request.Room,
+		}
+		return
+	}
+	if !room.contains(cu.name()) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.NotInRoom,
+			Info:  request.Room,
+		}
+		return
+	}
+
+	m, ok := cu.server.history.get(request.ID)
+	if !ok || m.Room != request.Room {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingMessage,
+			Info:  strconv.FormatUint(uint64(request.ID), 10),
+		}
+		return
+	}
+
+	u := cu.identity()
+	if cu.server.markRead(u, request.Room, request.ID) {
+		u.notify(protocol.MessageIDs, cu.server.readMarker(u, request.Room))
+	}
+}
+
+func (cu *connectedUser) ReadReceipt(request *protocol.ReadReceiptRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	m, ok := cu.server.history.get(request.ID)
+	if !ok || !m.receivedBy(cu.identity()) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingMessage,
+			Info:  strconv.FormatUint(uint64(request.ID), 10),
+		}
+		return
+	}
+
+	cu.server.receipt(request.ID, true)
+}
+
+func (cu *connectedUser) GetMOTD(*protocol.GetMOTDRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	cu.outgoing <- &protocol.MOTDResponse{
+		Text: cu.server.config.MOTD,
+	}
+}
+
+func (cu *connectedUser) GetServerInfo(*protocol.GetServerInfoRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	cu.outgoing <- cu.server.info()
+}
+
+func (cu *connectedUser) Announce(request *protocol.AnnounceRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	sender := cu.identity()
+	if !cu.server.isAdmin(sender) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.PermissionDenied,
+			Info:  "only server admins can make announcements",
+		}
+		return
+	}
+	text, err := cu.server.config.Text.validate(request.Text)
+	if err != nil {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidText,
+			Info:  "announcement " + err.Error(),
+		}
+		return
+	}
+
+	cu.server.roomsMutex.RLock()
+	for _, roomName := range request.Rooms {
+		if _, ok := cu.server.rooms[roomName]; !ok {
+			cu.server.roomsMutex.RUnlock()
+			cu.outgoing <- &protocol.ErrorResponse{
+				Error: protocol.MissingRoom,
+				Info:  roomName,
+			}
+			return
+		}
+	}
+	cu.server.roomsMutex.RUnlock()
+
+	if request.At.UnixMilli() == 0 {
+		cu.server.announce(sender, request.Rooms, text)
+		return
+	}
+	if !cu.checkSchedule(request.At) {
+		return
+	}
+	cu.scheduleLater(scheduledItem{
+		ID:           0,
+		Account:      0,
+		At:           request.At,
+		Announcement: true,
+		Rooms:        request.Rooms,
+		Text:         text,
+	})
+}
+
+func (cu *connectedUser) ScheduleMessage(request *protocol.ScheduleMessageRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	text, err := cu.server.config.Text.validate(request.Text)
+	if err != nil {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.InvalidText,
+			Info:  "message " + err.Error(),
+		}
+		return
+	}
+	if _, ok := cu.postableRoom(request.Room); !ok || !cu.checkSchedule(request.At) {
+		return
+	}
+
+	cu.scheduleLater(scheduledItem{
+		ID:           0,
+		Account:      0,
+		At:           request.At,
+		Announcement: false,
+		Rooms:        []string{request.Room},
+		Text:         text,
+	})
+}
+
+func (cu *connectedUser) ListScheduled(*protocol.ListScheduledRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	items := cu.server.scheduledBy(cu.identity())
+	cu.outgoing <- &protocol.ScheduledListResponse{
+		Count: uint32(len(items)),
+		Items: items,
+	}
+}
+
+func (cu *connectedUser) CancelScheduled(request *protocol.CancelScheduledRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	if !cu.server.unschedule(cu.identity(), request.ID) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingScheduled,
+			Info:  strconv.FormatUint(uint64(request.ID), 10),
+		}
+		return
+	}
+
+	items := cu.server.scheduledBy(cu.identity())
+	cu.outgoing <- &protocol.ScheduledListResponse{
+		Count: uint32(len(items)),
+		Items: items,
+	}
+}
+
+func (cu *connectedUser) SetRetention(request *protocol.SetRetentionRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	cu.server.roomsMutex.RLock()
+	room, ok := cu.server.rooms[request.Room]
+	cu.server.roomsMutex.RUnlock()
+	if !ok {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingRoom,
+			Info:  request.Room,
+		}
+		return
+	}
+	if !room.isOperator(cu.name()) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.PermissionDenied,
+			Info:  "only room operators can change the retention",
+		}
+		return
+	}
+
+	room.optionsMutex.Lock()
+	room.retention = request.Retention
+	room.optionsMutex.Unlock()
+
+	cu.outgoing <- cu.roomDetails(request.Room, room)
+}
+
+func (cu *connectedUser) DescribeRoom(request *protocol.DescribeRoomRequest) {
+	if !cu.requireConnected() {
+		return
+	}
+
+	cu.server.roomsMutex.RLock()
+	room, ok := cu.server.rooms[request.Room]
+	cu.server.roomsMutex.RUnlock()
+	if !ok {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.MissingRoom,
+			Info:  request.Room,
+		}
+		return
+	}
+
+	cu.outgoing <- cu.roomDetails(request.Room, room)
 }
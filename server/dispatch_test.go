@@ -0,0 +1,2090 @@
+package server
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mnxn/chat/generic"
+	"github.com/mnxn/chat/protocol"
+)
+
+func TestMessageRoomNotJoined(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+
+	alice.createRoom("private")
+	alice.joinRoom("private")
+
+	request := &protocol.MessageRoomRequest{
+		Room: "private",
+		Text: "hello?",
+	}
+	bob.send(request)
+	generic.TestEqual(t, "MessageRoom", request,
+		protocol.ServerResponse(&protocol.ErrorResponse{
+			Error: protocol.NotInRoom,
+			Info:  "private",
+		}),
+		bob.receive(),
+	)
+
+	bob.joinRoom("private")
+	bob.send(request)
+	generic.TestEqual(t, "MessageRoom", request,
+		protocol.ServerResponse(&protocol.RoomMessageResponse{
+			Room:   "private",
+			Sender: "bob",
+			Text:   "hello?",
+		}),
+		alice.receive(),
+	)
+}
+
+func TestMessageRoomOutsidePosts(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+
+	alice.createRoom("help")
+	alice.joinRoom("help")
+	alice.send(&protocol.SetRoomOptionRequest{
+		Room:   "help",
+		Option: protocol.AllowOutsidePosts,
+		Value:  1,
+	})
+	waitFor(t, func() bool {
+		return s.findRoom("help").accepts("bob")
+	})
+
+	request := &protocol.MessageRoomRequest{
+		Room: "help",
+		Text: "can someone help me?",
+	}
+	bob.send(request)
+	generic.TestEqual(t, "MessageRoom", request,
+		protocol.ServerResponse(&protocol.RoomMessageResponse{
+			Room:   "help",
+			Sender: "bob",
+			Text:   "can someone help me?",
+		}),
+		alice.receive(),
+	)
+}
+
+func TestSetRoomOptionNotOperator(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+
+	alice.createRoom("private")
+	bob.joinRoom("private")
+
+	request := &protocol.SetRoomOptionRequest{
+		Room:   "private",
+		Option: protocol.AllowOutsidePosts,
+		Value:  1,
+	}
+	bob.send(request)
+	generic.TestEqual(t, "SetRoomOption", request,
+		protocol.ServerResponse(&protocol.ErrorResponse{
+			Error: protocol.PermissionDenied,
+			Info:  "only room operators can change room options",
+		}),
+		bob.receive(),
+	)
+}
+
+func TestListUsersNotJoined(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+
+	alice.createRoom("private")
+	alice.joinRoom("private")
+
+	request := &protocol.ListUsersRequest{
+		Room: "private",
+	}
+	bob.send(request)
+	generic.TestEqual(t, "ListUsers", request,
+		protocol.ServerResponse(&protocol.ErrorResponse{
+			Error: protocol.NotInRoom,
+			Info:  "private",
+		}),
+		bob.receive(),
+	)
+}
+
+func TestListRoomsNotJoined(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+
+	bob.createRoom("private")
+	bob.joinRoom("private")
+	bob.createRoom("shared")
+	bob.joinRoom("shared")
+	alice.joinRoom("shared")
+
+	request := &protocol.ListRoomsRequest{
+		User: "bob",
+	}
+	alice.send(request)
+	generic.TestEqual(t, "ListRooms", request,
+		protocol.ServerResponse(&protocol.RoomListResponse{
+			User:  "bob",
+			Count: 2,
+			Rooms: []string{"general", "shared"},
+		}),
+		alice.receive(),
+	)
+
+	pageRequest := &protocol.ListRoomsPageRequest{
+		User:   "bob",
+		Filter: "",
+		Order:  protocol.OrderByName,
+		Cursor: "",
+		Limit:  0,
+	}
+	alice.send(pageRequest)
+	response, ok := alice.receive().(*protocol.RoomPageResponse)
+	generic.TestEqual(t, "ListRoomsPage", "type", true, ok)
+	names := make([]string, len(response.Rooms))
+	for i, room := range response.Rooms {
+		names[i] = room.Name
+	}
+	generic.TestEqual(t, "ListRoomsPage", pageRequest, []string{"general", "shared"}, names)
+
+	// Users still see all of their own rooms.
+	request = &protocol.ListRoomsRequest{
+		User: "bob",
+	}
+	bob.send(request)
+	generic.TestEqual(t, "ListRooms", "own rooms",
+		protocol.ServerResponse(&protocol.RoomListResponse{
+			User:  "bob",
+			Count: 3,
+			Rooms: []string{"general", "private", "shared"},
+		}),
+		bob.receive(),
+	)
+}
+
+func TestBlock(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	carol := connectTestClient(t, s, "carol")
+	alice.negotiate(protocol.EchoMessages)
+
+	bob.send(&protocol.BlockRequest{
+		User: "alice",
+	})
+	waitFor(t, func() bool {
+		s.usersMutex.RLock()
+		defer s.usersMutex.RUnlock()
+
+		return !s.users["bob"].accepts("alice")
+	})
+	listRequest := &protocol.ListBlocksRequest{}
+	bob.send(listRequest)
+	generic.TestEqual(t, "ListBlocks", listRequest,
+		protocol.ServerResponse(&protocol.BlockListResponse{
+			Strangers: false,
+			Count:     1,
+			Users:     []string{"alice"},
+		}),
+		bob.receive(),
+	)
+
+	// The echo is sent after the message would have been delivered,
+	// so the next direct message that bob receives shows whether it was dropped.
+	alice.send(&protocol.MessageUserRequest{
+		User: "bob",
+		Text: "dropped",
+	})
+	alice.receive()
+	carol.send(&protocol.MessageUserRequest{
+		User: "bob",
+		Text: "delivered",
+	})
+	generic.TestEqual(t, "MessageUser", "blocked",
+		protocol.ServerResponse(&protocol.UserMessageResponse{
+			Sender: "carol",
+			Text:   "delivered",
+		}),
+		bob.receive(),
+	)
+
+	bob.send(&protocol.UnblockRequest{
+		User: "alice",
+	})
+	waitFor(t, func() bool {
+		s.usersMutex.RLock()
+		defer s.usersMutex.RUnlock()
+
+		return s.users["bob"].accepts("alice")
+	})
+	alice.send(&protocol.MessageUserRequest{
+		User: "bob",
+		Text: "unblocked",
+	})
+	generic.TestEqual(t, "MessageUser", "unblocked",
+		protocol.ServerResponse(&protocol.UserMessageResponse{
+			Sender: "alice",
+			Text:   "unblocked",
+		}),
+		bob.receive(),
+	)
+}
+
+func TestBlockedError(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.config.BlockedError = true
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+
+	bob.send(&protocol.BlockRequest{
+		User: "alice",
+	})
+	waitFor(t, func() bool {
+		s.usersMutex.RLock()
+		defer s.usersMutex.RUnlock()
+
+		return !s.users["bob"].accepts("alice")
+	})
+
+	request := &protocol.MessageUserRequest{
+		User: "bob",
+		Text: "hello?",
+	}
+	alice.send(request)
+	generic.TestEqual(t, "MessageUser", request,
+		protocol.ServerResponse(&protocol.ErrorResponse{
+			Error: protocol.BlockedUser,
+			Info:  "bob",
+		}),
+		alice.receive(),
+	)
+}
+
+func TestBlockStrangers(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.config.BlockedError = true
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	carol := connectTestClient(t, s, "carol")
+
+	bob.send(&protocol.BlockRequest{
+		User: "",
+	})
+	bob.send(&protocol.MessageUserRequest{
+		User: "carol",
+		Text: "you are a contact",
+	})
+	carol.receive()
+	waitFor(t, func() bool {
+		s.usersMutex.RLock()
+		defer s.usersMutex.RUnlock()
+
+		return !s.users["bob"].accepts("alice")
+	})
+
+	request := &protocol.MessageUserRequest{
+		User: "bob",
+		Text: "stranger",
+	}
+	alice.send(request)
+	generic.TestEqual(t, "MessageUser", request,
+		protocol.ServerResponse(&protocol.ErrorResponse{
+			Error: protocol.BlockedUser,
+			Info:  "bob",
+		}),
+		alice.receive(),
+	)
+
+	request = &protocol.MessageUserRequest{
+		User: "bob",
+		Text: "contact",
+	}
+	carol.send(request)
+	generic.TestEqual(t, "MessageUser", request,
+		protocol.ServerResponse(&protocol.UserMessageResponse{
+			Sender: "carol",
+			Text:   "contact",
+		}),
+		bob.receive(),
+	)
+}
+
+func TestNormalizedLookups(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "émile")
+	bob := connectTestClient(t, s, "bob")
+	alice.createRoom("café")
+
+	// The decomposed forms of the names find the composed names that the server stores.
+	bob.send(&protocol.JoinRoomRequest{
+		Room: "café",
+	})
+	waitFor(t, func() bool {
+		return s.findRoom("café").contains("bob")
+	})
+
+	request := &protocol.MessageUserRequest{
+		User: "émile",
+		Text: "bonjour",
+	}
+	bob.send(request)
+	generic.TestEqual(t, "MessageUser", request,
+		protocol.ServerResponse(&protocol.UserMessageResponse{
+			Sender: "bob",
+			Text:   "bonjour",
+		}),
+		alice.receive(),
+	)
+}
+
+func TestNegotiate(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+
+	request := &protocol.NegotiateRequest{
+		Capabilities: 0xFFFFFFFF,
+	}
+	alice.send(request)
+	generic.TestEqual(t, "Negotiate", request,
+		protocol.ServerResponse(&protocol.CapabilitiesResponse{
+			Capabilities: supportedCapabilities,
+		}),
+		alice.receive(),
+	)
+}
+
+func TestNegotiateAfterConnect(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	bob := connectTestClient(t, s, "bob")
+	bob.createRoom("lobby")
+	bob.joinRoom("lobby")
+	alice := dialTestClient(t, s, "alice")
+
+	// The client sends these requests without waiting for the connection to be established.
+	alice.send(&protocol.ConnectRequest{
+		Version: 1,
+		Name:    "alice",
+	})
+	alice.send(&protocol.NegotiateRequest{
+		Capabilities: protocol.EchoMessages,
+	})
+	alice.send(&protocol.JoinRoomRequest{
+		Room: "lobby",
+	})
+	generic.TestEqual(t, "Negotiate", "after Connect",
+		protocol.ServerResponse(&protocol.CapabilitiesResponse{
+			Capabilities: protocol.EchoMessages,
+		}),
+		alice.receive(),
+	)
+	waitFor(t, func() bool {
+		return s.findRoom("lobby").contains("alice")
+	})
+}
+
+func TestEchoMessages(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+
+	alice.send(&protocol.NegotiateRequest{
+		Capabilities: protocol.EchoMessages,
+	})
+	alice.receive()
+
+	roomRequest := &protocol.MessageRoomRequest{
+		Room: "general",
+		Text: "hello",
+	}
+	alice.send(roomRequest)
+	expectedRoomMessage := protocol.ServerResponse(&protocol.RoomMessageResponse{
+		Room:   "general",
+		Sender: "alice",
+		Text:   "hello",
+	})
+	generic.TestEqual(t, "MessageRoom", roomRequest, expectedRoomMessage, bob.receive())
+	generic.TestEqual(t, "MessageRoom echo", roomRequest, expectedRoomMessage, alice.receive())
+
+	userRequest := &protocol.MessageUserRequest{
+		User: "bob",
+		Text: "hi bob",
+	}
+	alice.send(userRequest)
+	generic.TestEqual(t, "MessageUser", userRequest,
+		protocol.ServerResponse(&protocol.UserMessageResponse{
+			Sender: "alice",
+			Text:   "hi bob",
+		}),
+		bob.receive(),
+	)
+	generic.TestEqual(t, "MessageUser echo", userRequest,
+		protocol.ServerResponse(&protocol.UserMessageEchoResponse{
+			Recipient: "bob",
+			Text:      "hi bob",
+		}),
+		alice.receive(),
+	)
+
+	bob.send(&protocol.MessageUserRequest{
+		User: "alice",
+		Text: "no echo",
+	})
+	alice.receive()
+	select {
+	case response := <-bob.responses:
+		t.Errorf("unexpected response without EchoMessages: %#v", response)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+
+	alice.send(&protocol.RegisterRequest{
+		Password: "secret",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("alice")
+	})
+
+	guest := dialTestClient(t, s, "alice")
+	guest.send(&protocol.ConnectRequest{
+		Version: 1,
+		Name:    "alice",
+	})
+	response, ok := guest.receive().(*protocol.FatalErrorResponse)
+	generic.TestEqual(t, "Connect", "alice", true, ok && response.Error == protocol.ExistingUser)
+
+	impostor := dialTestClient(t, s, "alice")
+	impostor.send(&protocol.LoginRequest{
+		Version:  1,
+		Name:     "alice",
+		Password: "wrong",
+	})
+	response, ok = impostor.receive().(*protocol.FatalErrorResponse)
+	generic.TestEqual(t, "Login", "wrong", true, ok && response.Error == protocol.AuthenticationFailed)
+
+	alice.send(&protocol.RegisterRequest{
+		Password: "again",
+	})
+	errorResponse, ok := alice.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "Register", "again", true, ok && errorResponse.Error == protocol.ExistingUser)
+}
+
+func TestMultipleSessions(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	laptop := connectTestClient(t, s, "alice")
+	laptop.send(&protocol.RegisterRequest{
+		Password: "secret",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("alice")
+	})
+
+	phone := loginTestClient(t, s, "alice", "secret")
+	bob := connectTestClient(t, s, "bob")
+
+	phone.send(&protocol.NegotiateRequest{
+		Capabilities: protocol.EchoMessages,
+	})
+	phone.receive()
+
+	bob.send(&protocol.MessageUserRequest{
+		User: "alice",
+		Text: "hi alice",
+	})
+	expected := protocol.ServerResponse(&protocol.UserMessageResponse{
+		Sender: "bob",
+		Text:   "hi alice",
+	})
+	generic.TestEqual(t, "MessageUser", "laptop", expected, laptop.receive())
+	generic.TestEqual(t, "MessageUser", "phone", expected, phone.receive())
+
+	laptop.send(&protocol.MessageRoomRequest{
+		Room: "general",
+		Text: "from laptop",
+	})
+	expected = &protocol.RoomMessageResponse{
+		Room:   "general",
+		Sender: "alice",
+		Text:   "from laptop",
+	}
+	generic.TestEqual(t, "MessageRoom", "bob", expected, bob.receive())
+	generic.TestEqual(t, "MessageRoom echo", "phone", expected, phone.receive())
+
+	laptop.conn.Close()
+	waitFor(t, func() bool {
+		return s.sessionCount("alice") == 1
+	})
+	generic.TestEqual(t, "general", "alice", true, s.general.contains("alice"))
+
+	phone.conn.Close()
+	waitFor(t, func() bool {
+		return s.sessionCount("alice") == 0
+	})
+	generic.TestEqual(t, "general", "alice", false, s.general.contains("alice"))
+}
+
+func TestOfflineMessages(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.config.Limits.MaxQueued = 1
+
+	alice := connectTestClient(t, s, "alice")
+	alice.send(&protocol.RegisterRequest{
+		Password: "secret",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("alice")
+	})
+	alice.conn.Close()
+	waitFor(t, func() bool {
+		return s.sessionCount("alice") == 0
+	})
+
+	bob := connectTestClient(t, s, "bob")
+	bob.send(&protocol.NegotiateRequest{
+		Capabilities: protocol.OfflineMessages,
+	})
+	bob.receive()
+
+	request := &protocol.MessageUserRequest{
+		User: "alice",
+		Text: "see you tomorrow",
+	}
+	bob.send(request)
+	generic.TestEqual(t, "MessageUser", request,
+		protocol.ServerResponse(&protocol.MessageQueuedResponse{
+			Recipient: "alice",
+		}),
+		bob.receive(),
+	)
+
+	bob.send(request)
+	response, ok := bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "MessageUser", "full queue", true, ok && response.Error == protocol.LimitReached)
+
+	bob.send(&protocol.MessageUserRequest{
+		User: "carol",
+		Text: "hello?",
+	})
+	response, ok = bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "MessageUser", "carol", true, ok && response.Error == protocol.MissingUser)
+
+	alice = loginTestClient(t, s, "alice", "secret")
+	alice.send(&protocol.NegotiateRequest{
+		Capabilities: protocol.OfflineMessages,
+	})
+	alice.receive()
+	message, ok := alice.receive().(*protocol.OfflineMessageResponse)
+	if generic.TestEqual(t, "OfflineMessage", "alice", true, ok) {
+		generic.TestEqual(t, "OfflineMessage", "sender", "bob", message.Sender)
+		generic.TestEqual(t, "OfflineMessage", "text", "see you tomorrow", message.Text)
+		generic.TestEqual(t, "OfflineMessage", "time", true, !message.Time.IsZero())
+	}
+}
+
+func TestPresence(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	for _, tc := range []*testClient{alice, bob} {
+		tc.send(&protocol.NegotiateRequest{
+			Capabilities: protocol.PresenceUpdates,
+		})
+		tc.receive()
+	}
+
+	request := &protocol.SetPresenceRequest{
+		Presence: protocol.Away,
+		Message:  "lunch",
+	}
+	alice.send(request)
+	expected := protocol.ServerResponse(&protocol.PresenceChangeResponse{
+		User:     "alice",
+		Presence: protocol.Away,
+		Message:  "lunch",
+	})
+	generic.TestEqual(t, "SetPresence", request, expected, bob.receive())
+	generic.TestEqual(t, "SetPresence", request, expected, alice.receive())
+
+	bob.send(&protocol.MessageUserRequest{
+		User: "alice",
+		Text: "are you there?",
+	})
+	alice.receive()
+	generic.TestEqual(t, "MessageUser", "away",
+		protocol.ServerResponse(&protocol.AutoReplyResponse{
+			User:     "alice",
+			Presence: protocol.Away,
+			Message:  "lunch",
+		}),
+		bob.receive(),
+	)
+
+	bob.send(&protocol.ListUsersRequest{
+		Room: "",
+	})
+	response, ok := bob.receive().(*protocol.PresenceListResponse)
+	if generic.TestEqual(t, "ListUsers", "presence", true, ok) {
+		for _, user := range response.Users {
+			if user.Name == "alice" {
+				generic.TestEqual(t, "ListUsers", "alice", protocol.Away, user.Presence)
+			}
+		}
+	}
+}
+
+func TestTyping(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	carol := connectTestClient(t, s, "carol")
+	bob.send(&protocol.NegotiateRequest{
+		Capabilities: protocol.TypingNotifications,
+	})
+	bob.receive()
+
+	request := &protocol.TypingRequest{
+		Room: "general",
+		User: "",
+	}
+	alice.send(request)
+	generic.TestEqual(t, "Typing", request,
+		protocol.ServerResponse(&protocol.UserTypingResponse{
+			User: "alice",
+			Room: "general",
+		}),
+		bob.receive(),
+	)
+
+	// The repeated notification is dropped because it is sent too soon after the first.
+	alice.send(request)
+	request = &protocol.TypingRequest{
+		Room: "",
+		User: "bob",
+	}
+	alice.send(request)
+	generic.TestEqual(t, "Typing", request,
+		protocol.ServerResponse(&protocol.UserTypingResponse{
+			User: "alice",
+			Room: "",
+		}),
+		bob.receive(),
+	)
+
+	select {
+	case response := <-carol.responses:
+		t.Errorf("unexpected response without TypingNotifications: %#v", response)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestChangeName(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	bob.send(&protocol.NegotiateRequest{
+		Capabilities: protocol.NameChanges,
+	})
+	bob.receive()
+
+	alice.createRoom("ops")
+	alice.joinRoom("ops")
+
+	request := &protocol.ChangeNameRequest{
+		Name: "alicia",
+	}
+	alice.send(request)
+	generic.TestEqual(t, "ChangeName", request,
+		protocol.ServerResponse(&protocol.NameChangedResponse{
+			OldName: "alice",
+			NewName: "alicia",
+		}),
+		bob.receive(),
+	)
+	room := s.findRoom("ops")
+	generic.TestEqual(t, "ChangeName", "member", true, room.contains("alicia") && !room.contains("alice"))
+	generic.TestEqual(t, "ChangeName", "operator", true, room.isOperator("alicia") && !room.isOperator("alice"))
+	generic.TestEqual(t, "ChangeName", "users", 0, s.sessionCount("alice"))
+
+	bob.send(request)
+	response, ok := bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "ChangeName", "existing", true, ok && response.Error == protocol.ExistingUser)
+
+	bob.send(&protocol.ChangeNameRequest{
+		Name: "Alicia",
+	})
+	response, ok = bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "ChangeName", "lookalike", true, ok && response.Error == protocol.InvalidUser)
+
+	// A user can change to a name that only looks like its own.
+	alice.send(&protocol.ChangeNameRequest{
+		Name: "Alicia",
+	})
+	generic.TestEqual(t, "ChangeName", "own lookalike",
+		protocol.ServerResponse(&protocol.NameChangedResponse{
+			OldName: "alicia",
+			NewName: "Alicia",
+		}),
+		bob.receive(),
+	)
+}
+
+func TestChangeNameBlocked(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.config.BlockedError = true
+	alice := connectTestClient(t, s, "alice")
+	mallory := connectTestClient(t, s, "mallory")
+	bob := connectTestClient(t, s, "bob")
+
+	alice.send(&protocol.RegisterRequest{
+		Password: "secret",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("alice")
+	})
+	alice.send(&protocol.BlockRequest{
+		User: "mallory",
+	})
+	alice.send(&protocol.BlockRequest{
+		User: "",
+	})
+	alice.send(&protocol.MessageUserRequest{
+		User: "bob",
+		Text: "you are a contact",
+	})
+	bob.receive()
+	waitFor(t, func() bool {
+		return !s.store.accepts("alice", "mallory") && !s.store.accepts("alice", "carol")
+	})
+
+	mallory.send(&protocol.ChangeNameRequest{
+		Name: "eve",
+	})
+	bob.send(&protocol.ChangeNameRequest{
+		Name: "robert",
+	})
+	waitFor(t, func() bool {
+		return s.sessionCount("eve") > 0 && s.sessionCount("robert") > 0
+	})
+	generic.TestEqual(t, "ChangeName", "saved block", false, s.store.accepts("alice", "eve"))
+	generic.TestEqual(t, "ChangeName", "saved contact", true, s.store.accepts("alice", "robert"))
+
+	request := &protocol.MessageUserRequest{
+		User: "alice",
+		Text: "it's me, eve",
+	}
+	mallory.send(request)
+	generic.TestEqual(t, "MessageUser", request,
+		protocol.ServerResponse(&protocol.ErrorResponse{
+			Error: protocol.BlockedUser,
+			Info:  "alice",
+		}),
+		mallory.receive(),
+	)
+
+	request = &protocol.MessageUserRequest{
+		User: "alice",
+		Text: "still a contact",
+	}
+	bob.send(request)
+	generic.TestEqual(t, "MessageUser", request,
+		protocol.ServerResponse(&protocol.UserMessageResponse{
+			Sender: "robert",
+			Text:   "still a contact",
+		}),
+		alice.receive(),
+	)
+}
+
+func TestEditDeleteMessage(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	carol := connectTestClient(t, s, "carol")
+	for _, tc := range []*testClient{alice, bob} {
+		tc.negotiate(protocol.MessageIDs)
+	}
+
+	request := &protocol.MessageRoomRequest{
+		Room: "general",
+		Text: "hello",
+	}
+	alice.send(request)
+	message, ok := bob.receive().(*protocol.ChatMessageResponse)
+	generic.TestEqual(t, "MessageRoom", "id", true, ok && message.ID != 0 && message.Text == "hello")
+	generic.TestEqual(t, "MessageRoom", request,
+		protocol.ServerResponse(&protocol.RoomMessageResponse{
+			Room:   "general",
+			Sender: "alice",
+			Text:   "hello",
+		}),
+		carol.receive(),
+	)
+
+	bob.send(&protocol.EditMessageRequest{
+		ID:   message.ID,
+		Text: "goodbye",
+	})
+	response, ok := bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "EditMessage", "not sender", true, ok && response.Error == protocol.PermissionDenied)
+
+	alice.send(&protocol.EditMessageRequest{
+		ID:   message.ID,
+		Text: "hello again",
+	})
+	edited, ok := bob.receive().(*protocol.MessageEditedResponse)
+	generic.TestEqual(t, "EditMessage", "edited", true, ok && edited.ID == message.ID && edited.Text == "hello again")
+	generic.TestEqual(t, "EditMessage", "sender", protocol.ServerResponse(edited), alice.receive())
+
+	// Operators can delete messages of other users in their rooms.
+	alice.createRoom("ops")
+	alice.joinRoom("ops")
+	bob.joinRoom("ops")
+	bob.send(&protocol.MessageRoomRequest{
+		Room: "ops",
+		Text: "oops",
+	})
+	message, ok = alice.receive().(*protocol.ChatMessageResponse)
+	generic.TestEqual(t, "MessageRoom", "ops", true, ok && message.Room == "ops")
+
+	deleteRequest := &protocol.DeleteMessageRequest{
+		ID: message.ID,
+	}
+	alice.send(deleteRequest)
+	generic.TestEqual(t, "DeleteMessage", deleteRequest,
+		protocol.ServerResponse(&protocol.MessageDeletedResponse{
+			ID:   message.ID,
+			Room: "ops",
+			User: "alice",
+		}),
+		bob.receive(),
+	)
+	alice.receive()
+
+	alice.send(deleteRequest)
+	response, ok = alice.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "DeleteMessage", "deleted", true, ok && response.Error == protocol.MissingMessage)
+
+	select {
+	case response := <-carol.responses:
+		t.Errorf("unexpected response without MessageIDs: %#v", response)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestEditDeleteMessageRenamed(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	bob.negotiate(protocol.MessageIDs)
+
+	alice.send(&protocol.RegisterRequest{
+		Password: "secret",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("alice")
+	})
+	alice.send(&protocol.MessageRoomRequest{
+		Room: "general",
+		Text: "mine",
+	})
+	message, ok := bob.receive().(*protocol.ChatMessageResponse)
+	generic.TestEqual(t, "MessageRoom", "id", true, ok && message.ID != 0)
+
+	alice.send(&protocol.ChangeNameRequest{
+		Name: "alicia",
+	})
+	waitFor(t, func() bool {
+		return s.sessionCount("alicia") > 0
+	})
+	alice.conn.Close()
+	waitFor(t, func() bool {
+		return s.sessionCount("alicia") == 0
+	})
+
+	// Registering the freed name does not give access to the messages of the renamed account.
+	impostor := connectTestClient(t, s, "alice")
+	impostor.send(&protocol.RegisterRequest{
+		Password: "forged",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("alice")
+	})
+
+	impostor.send(&protocol.EditMessageRequest{
+		ID:   message.ID,
+		Text: "forged",
+	})
+	response, ok := impostor.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "EditMessage", "impostor", true, ok && response.Error == protocol.PermissionDenied)
+
+	impostor.send(&protocol.DeleteMessageRequest{
+		ID: message.ID,
+	})
+	response, ok = impostor.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "DeleteMessage", "impostor", true, ok && response.Error == protocol.PermissionDenied)
+
+	alicia := loginTestClient(t, s, "alicia", "secret")
+	alicia.send(&protocol.EditMessageRequest{
+		ID:   message.ID,
+		Text: "still mine",
+	})
+	edited, ok := bob.receive().(*protocol.MessageEditedResponse)
+	generic.TestEqual(t, "EditMessage", "renamed", true, ok && edited.ID == message.ID && edited.Text == "still mine")
+}
+
+func TestReplyThread(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	carol := connectTestClient(t, s, "carol")
+	for _, tc := range []*testClient{alice, bob, carol} {
+		tc.negotiate(protocol.MessageIDs)
+	}
+
+	alice.send(&protocol.MessageRoomRequest{
+		Room: "general",
+		Text: "question",
+	})
+	root, ok := bob.receive().(*protocol.ChatMessageResponse)
+	generic.TestEqual(t, "MessageRoom", "root", true, ok)
+	carol.receive()
+
+	bob.send(&protocol.ReplyRequest{
+		ReplyTo: root.ID,
+		Text:    "answer",
+	})
+	reply, ok := alice.receive().(*protocol.ChatMessageResponse)
+	generic.TestEqual(t, "Reply", "room", true, ok && reply.ReplyTo == root.ID && reply.Room == "general")
+	carol.receive()
+
+	// A reply to a direct message goes to the other user of the direct message.
+	alice.send(&protocol.MessageUserRequest{
+		User: "bob",
+		Text: "secret",
+	})
+	direct, ok := bob.receive().(*protocol.ChatMessageResponse)
+	generic.TestEqual(t, "MessageUser", "direct", true, ok)
+	bob.send(&protocol.ReplyRequest{
+		ReplyTo: direct.ID,
+		Text:    "got it",
+	})
+	reply, ok = alice.receive().(*protocol.ChatMessageResponse)
+	generic.TestEqual(t, "Reply", "direct", true, ok && reply.ReplyTo == direct.ID && reply.Recipient == "alice")
+
+	carol.send(&protocol.ReplyRequest{
+		ReplyTo: direct.ID,
+		Text:    "me too",
+	})
+	response, ok := carol.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "Reply", "not visible", true, ok && response.Error == protocol.MissingMessage)
+
+	request := &protocol.ListThreadRequest{
+		Root: root.ID,
+	}
+	carol.send(request)
+	thread, ok := carol.receive().(*protocol.ThreadResponse)
+	generic.TestEqual(t, "ListThread", request, true, ok && thread.Count == 2)
+	generic.TestEqual(t, "ListThread", "texts", []string{"question", "answer"},
+		[]string{thread.Messages[0].Text, thread.Messages[1].Text})
+
+	carol.send(&protocol.ListThreadRequest{
+		Root: direct.ID,
+	})
+	response, ok = carol.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "ListThread", "not visible", true, ok && response.Error == protocol.MissingMessage)
+}
+
+func TestReactions(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	for _, tc := range []*testClient{alice, bob} {
+		tc.negotiate(protocol.MessageIDs)
+	}
+
+	alice.send(&protocol.MessageRoomRequest{
+		Room: "general",
+		Text: "lunch?",
+	})
+	message, ok := bob.receive().(*protocol.ChatMessageResponse)
+	generic.TestEqual(t, "MessageRoom", "id", true, ok)
+
+	request := &protocol.ReactRequest{
+		ID:       message.ID,
+		Reaction: "\U0001F44D",
+	}
+	bob.send(request)
+	expected := &protocol.ReactionListResponse{
+		ID:    message.ID,
+		Room:  "general",
+		User:  "bob",
+		Count: 1,
+		Reactions: []protocol.Reaction{
+			{Reaction: "\U0001F44D", Count: 1},
+		},
+	}
+	generic.TestEqual(t, "React", request, protocol.ServerResponse(expected), alice.receive())
+	generic.TestEqual(t, "React", request, protocol.ServerResponse(expected), bob.receive())
+
+	// Reacting twice with the same reaction does not change anything.
+	bob.send(request)
+	alice.send(&protocol.ReactRequest{
+		ID:       message.ID,
+		Reaction: "\U0001F44D",
+	})
+	expected.User = "alice"
+	expected.Reactions[0].Count = 2
+	generic.TestEqual(t, "React", request, protocol.ServerResponse(expected), bob.receive())
+
+	bob.send(&protocol.ReactRequest{
+		ID:       message.ID,
+		Reaction: "thumbs up",
+	})
+	response, ok := bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "React", "invalid", true, ok && response.Error == protocol.InvalidReaction)
+
+	unreact := &protocol.UnreactRequest{
+		ID:       message.ID,
+		Reaction: "\U0001F44D",
+	}
+	bob.send(unreact)
+	expected.User = "bob"
+	expected.Reactions[0].Count = 1
+	generic.TestEqual(t, "Unreact", unreact, protocol.ServerResponse(expected), bob.receive())
+}
+
+func TestReadMarkers(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	alice.send(&protocol.RegisterRequest{
+		Password: "secret",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("alice")
+	})
+	alice.negotiate(protocol.MessageIDs)
+	phone := loginTestClient(t, s, "alice", "secret")
+	phone.negotiate(protocol.MessageIDs)
+	bob := connectTestClient(t, s, "bob")
+
+	for _, text := range []string{"first", "second"} {
+		bob.send(&protocol.MessageRoomRequest{
+			Room: "general",
+			Text: text,
+		})
+	}
+	first, ok := alice.receive().(*protocol.ChatMessageResponse)
+	generic.TestEqual(t, "MessageRoom", "first", true, ok)
+	alice.receive()
+	phone.receive()
+	phone.receive()
+
+	// Both sessions of the user share the read marker.
+	request := &protocol.MarkReadRequest{
+		Room: "general",
+		ID:   first.ID,
+	}
+	alice.send(request)
+	expected := protocol.ServerResponse(&protocol.ReadMarkerResponse{
+		Room:   "general",
+		ID:     first.ID,
+		Unread: 1,
+	})
+	generic.TestEqual(t, "MarkRead", request, expected, alice.receive())
+	generic.TestEqual(t, "MarkRead", request, expected, phone.receive())
+
+	alice.send(&protocol.MarkReadRequest{
+		Room: "general",
+		ID:   1000,
+	})
+	response, ok := alice.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "MarkRead", "missing", true, ok && response.Error == protocol.MissingMessage)
+
+	// The read marker is kept while the user is offline.
+	alice.conn.Close()
+	phone.conn.Close()
+	waitFor(t, func() bool {
+		return s.sessionCount("alice") == 0
+	})
+	bob.send(&protocol.MessageRoomRequest{
+		Room: "general",
+		Text: "third",
+	})
+	waitFor(t, func() bool {
+		return s.history.last("general") > first.ID+1
+	})
+
+	alice = loginTestClient(t, s, "alice", "secret")
+	alice.send(&protocol.NegotiateRequest{
+		Capabilities: protocol.MessageIDs,
+	})
+	alice.receive()
+	generic.TestEqual(t, "Negotiate", "read marker",
+		protocol.ServerResponse(&protocol.ReadMarkerResponse{
+			Room:   "general",
+			ID:     first.ID,
+			Unread: 2,
+		}),
+		alice.receive(),
+	)
+}
+
+func TestReceipts(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	alice.negotiate(protocol.MessageIDs | protocol.Receipts)
+	bob.negotiate(protocol.MessageIDs)
+
+	alice.send(&protocol.MessageUserRequest{
+		User: "bob",
+		Text: "did you get this?",
+	})
+	message, ok := bob.receive().(*protocol.ChatMessageResponse)
+	generic.TestEqual(t, "MessageUser", "direct", true, ok)
+	generic.TestEqual(t, "MessageUser", "delivered",
+		protocol.ServerResponse(&protocol.ReceiptResponse{
+			ID:   message.ID,
+			User: "bob",
+			Read: false,
+		}),
+		alice.receive(),
+	)
+
+	request := &protocol.ReadReceiptRequest{
+		ID: message.ID,
+	}
+	bob.send(request)
+	generic.TestEqual(t, "ReadReceipt", request,
+		protocol.ServerResponse(&protocol.ReceiptResponse{
+			ID:   message.ID,
+			User: "bob",
+			Read: true,
+		}),
+		alice.receive(),
+	)
+
+	// Only the recipient can send a read receipt.
+	alice.send(request)
+	response, ok := alice.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "ReadReceipt", "sender", true, ok && response.Error == protocol.MissingMessage)
+
+	// Blocked direct messages are reported as delivered.
+	bob.send(&protocol.BlockRequest{
+		User: "alice",
+	})
+	waitFor(t, func() bool {
+		s.usersMutex.RLock()
+		defer s.usersMutex.RUnlock()
+
+		return !s.users["bob"].accepts("alice")
+	})
+	alice.send(&protocol.MessageUserRequest{
+		User: "bob",
+		Text: "hello?",
+	})
+	receipt, ok := alice.receive().(*protocol.ReceiptResponse)
+	generic.TestEqual(t, "MessageUser", "blocked", true, ok && !receipt.Read && receipt.ID > message.ID)
+}
+
+func TestSearchMessages(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	carol := connectTestClient(t, s, "carol")
+	for _, tc := range []*testClient{alice, bob, carol} {
+		tc.negotiate(protocol.MessageIDs)
+	}
+
+	var ids []protocol.MessageID
+	for _, text := range []string{"Lunch at noon?", "dinner later", "lunch moved to one"} {
+		alice.send(&protocol.MessageRoomRequest{
+			Room: "general",
+			Text: text,
+		})
+		message, ok := bob.receive().(*protocol.ChatMessageResponse)
+		generic.TestEqual(t, "MessageRoom", text, true, ok)
+		carol.receive()
+		ids = append(ids, message.ID)
+	}
+
+	alice.createRoom("secret")
+	alice.joinRoom("secret")
+	alice.send(&protocol.MessageRoomRequest{
+		Room: "secret",
+		Text: "lunch is on me",
+	})
+
+	request := &protocol.SearchMessagesRequest{
+		Query:  "LUNCH",
+		Room:   "",
+		Sender: "",
+		After:  time.UnixMilli(0),
+		Before: time.UnixMilli(0),
+		Cursor: 0,
+		Limit:  1,
+	}
+	bob.send(request)
+	results, ok := bob.receive().(*protocol.SearchResultsResponse)
+	generic.TestEqual(t, "SearchMessages", request, true, ok && results.Count == 1 && results.Next == ids[2])
+	generic.TestEqual(t, "SearchMessages", "newest", ids[2], results.Messages[0].ID)
+
+	request.Cursor = results.Next
+	bob.send(request)
+	results, ok = bob.receive().(*protocol.SearchResultsResponse)
+	generic.TestEqual(t, "SearchMessages", "next page", true, ok && results.Count == 1 && results.Next == 0)
+	generic.TestEqual(t, "SearchMessages", "oldest", ids[0], results.Messages[0].ID)
+
+	// Edits and deletions update the index.
+	alice.send(&protocol.EditMessageRequest{
+		ID:   ids[1],
+		Text: "lunch instead",
+	})
+	bob.receive()
+	carol.receive()
+	alice.receive()
+	alice.send(&protocol.DeleteMessageRequest{
+		ID: ids[2],
+	})
+	bob.receive()
+	carol.receive()
+	alice.receive()
+
+	request.Cursor = 0
+	request.Limit = 0
+	bob.send(request)
+	results, ok = bob.receive().(*protocol.SearchResultsResponse)
+	generic.TestEqual(t, "SearchMessages", "edited", true, ok && results.Count == 2)
+	generic.TestEqual(t, "SearchMessages", "edited", []protocol.MessageID{ids[1], ids[0]},
+		[]protocol.MessageID{results.Messages[0].ID, results.Messages[1].ID})
+
+	request.Query = ""
+	request.Sender = "bob"
+	bob.send(request)
+	results, ok = bob.receive().(*protocol.SearchResultsResponse)
+	generic.TestEqual(t, "SearchMessages", "sender", true, ok && results.Count == 0)
+
+	request.Sender = ""
+	request.Room = "secret"
+	bob.send(request)
+	response, ok := bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "SearchMessages", "not joined", true, ok && response.Error == protocol.NotInRoom)
+}
+
+func TestRemovedRoomHistory(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	bob.negotiate(protocol.MessageIDs)
+
+	alice.createRoom("secret")
+	alice.joinRoom("secret")
+	alice.send(&protocol.MessageRoomRequest{
+		Room: "secret",
+		Text: "password hunter2",
+	})
+	waitFor(t, func() bool {
+		return s.history.last("secret") != 0
+	})
+	id := s.history.last("secret")
+
+	alice.send(&protocol.LeaveRoomRequest{
+		Room: "secret",
+	})
+	waitFor(t, func() bool {
+		return s.findRoom("secret") == nil
+	})
+
+	// A new room with the same name does not inherit the messages of the removed room.
+	bob.createRoom("secret")
+	bob.joinRoom("secret")
+	request := &protocol.SearchMessagesRequest{
+		Query:  "hunter2",
+		Room:   "secret",
+		Sender: "",
+		After:  time.UnixMilli(0),
+		Before: time.UnixMilli(0),
+		Cursor: 0,
+		Limit:  0,
+	}
+	bob.send(request)
+	results, ok := bob.receive().(*protocol.SearchResultsResponse)
+	generic.TestEqual(t, "SearchMessages", request, true, ok && results.Count == 0)
+
+	bob.send(&protocol.DeleteMessageRequest{
+		ID: id,
+	})
+	response, ok := bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "DeleteMessage", id, true, ok && response.Error == protocol.MissingMessage)
+
+	// The rooms that users created are gone after a restart, and so are their messages.
+	config := DefaultConfig()
+	config.HistoryFile = filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := openHistory(config.HistoryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, roomName := range []string{"general", "secret"} {
+		err = h.add(testMessage(roomName, "alice", "hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	restarted, err := NewServer(config, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic.TestEqual(t, "NewServer", "general", protocol.MessageID(1), restarted.history.last("general"))
+	generic.TestEqual(t, "NewServer", "secret", protocol.MessageID(0), restarted.history.last("secret"))
+}
+
+func TestListPages(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	for _, roomName := range []string{"alpha", "beta", "bravo"} {
+		alice.createRoom(roomName)
+		alice.joinRoom(roomName)
+	}
+	bob.joinRoom("bravo")
+
+	bob.send(&protocol.SetTopicRequest{
+		Room:  "bravo",
+		Topic: "mine now",
+	})
+	response, ok := bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "SetTopic", "not operator", true, ok && response.Error == protocol.PermissionDenied)
+
+	alice.send(&protocol.SetTopicRequest{
+		Room:  "bravo",
+		Topic: "all things b",
+	})
+	waitFor(t, func() bool {
+		return s.findRoom("bravo").info("bravo").Topic == "all things b"
+	})
+
+	request := &protocol.ListRoomsPageRequest{
+		User:   "",
+		Filter: "B",
+		Order:  protocol.OrderByName,
+		Cursor: "",
+		Limit:  1,
+	}
+	alice.send(request)
+	generic.TestEqual(t, "ListRoomsPage", request,
+		protocol.ServerResponse(&protocol.RoomPageResponse{
+			User:  "",
+			Next:  "beta",
+			Count: 1,
+			Rooms: []protocol.RoomInfo{{Name: "beta", Members: 1, Topic: ""}},
+		}),
+		alice.receive(),
+	)
+
+	request.Cursor = "beta"
+	alice.send(request)
+	generic.TestEqual(t, "ListRoomsPage", request,
+		protocol.ServerResponse(&protocol.RoomPageResponse{
+			User:  "",
+			Next:  "",
+			Count: 1,
+			Rooms: []protocol.RoomInfo{{Name: "bravo", Members: 2, Topic: "all things b"}},
+		}),
+		alice.receive(),
+	)
+
+	request.Filter = "*a*"
+	request.Order = protocol.OrderBySize
+	request.Cursor = ""
+	request.Limit = 0
+	alice.send(request)
+	rooms, ok := alice.receive().(*protocol.RoomPageResponse)
+	generic.TestEqual(t, "ListRoomsPage", "by size", true, ok && rooms.Count == 4 && rooms.Next == "")
+	generic.TestEqual(t, "ListRoomsPage", "by size", []string{"bravo", "general", "alpha", "beta"},
+		[]string{rooms.Rooms[0].Name, rooms.Rooms[1].Name, rooms.Rooms[2].Name, rooms.Rooms[3].Name})
+
+	request.Filter = "["
+	alice.send(request)
+	response, ok = alice.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "ListRoomsPage", "invalid filter", true, ok && response.Error == protocol.InvalidFilter)
+
+	usersRequest := &protocol.ListUsersPageRequest{
+		Room:   "bravo",
+		Filter: "",
+		Order:  protocol.OrderBySize,
+		Cursor: "",
+		Limit:  0,
+	}
+	bob.send(usersRequest)
+	generic.TestEqual(t, "ListUsersPage", usersRequest,
+		protocol.ServerResponse(&protocol.UserPageResponse{
+			Room:  "bravo",
+			Next:  "",
+			Count: 2,
+			Users: []protocol.UserPresence{
+				{Name: "alice", Presence: protocol.Online, Message: ""},
+				{Name: "bob", Presence: protocol.Online, Message: ""},
+			},
+		}),
+		bob.receive(),
+	)
+
+	usersRequest.Room = "alpha"
+	bob.send(usersRequest)
+	response, ok = bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "ListUsersPage", "not joined", true, ok && response.Error == protocol.NotInRoom)
+}
+
+func TestVersion2Lists(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	alice.createRoom("ops")
+	alice.joinRoom("ops")
+
+	carol := dialTestClient(t, s, "carol")
+	carol.send(&protocol.ConnectRequest{
+		Version: protocol.Version2,
+		Name:    "carol",
+	})
+	waitFor(t, func() bool {
+		return s.sessionCount("carol") > 0
+	})
+
+	request := &protocol.ListRoomsRequest{
+		User: "",
+	}
+	carol.send(request)
+	generic.TestEqual(t, "ListRooms", request,
+		protocol.ServerResponse(&protocol.RoomEntryListResponse{
+			User:  "",
+			Next:  "",
+			Count: 2,
+			Rooms: []protocol.RoomEntry{
+				{Name: "general", Members: 2, Topic: "", Flags: protocol.RoomJoined | protocol.RoomPermanent},
+				{Name: "ops", Members: 1, Topic: "", Flags: 0},
+			},
+		}),
+		carol.receive(),
+	)
+
+	alice.send(&protocol.ListRoomsPageRequest{
+		User:   "",
+		Filter: "o",
+		Order:  protocol.OrderByName,
+		Cursor: "",
+		Limit:  0,
+	})
+	_, ok := alice.receive().(*protocol.RoomPageResponse)
+	generic.TestEqual(t, "ListRoomsPage", "version 1", true, ok)
+
+	carol.send(&protocol.ListUsersRequest{
+		Room: "general",
+	})
+	users, ok := carol.receive().(*protocol.UserEntryListResponse)
+	generic.TestEqual(t, "ListUsers", "entries", true, ok && users.Count == 2)
+	generic.TestEqual(t, "ListUsers", "names", []string{"alice", "carol"},
+		[]string{users.Users[0].Name, users.Users[1].Name})
+	generic.TestEqual(t, "ListUsers", "idle", true, users.Users[0].Idle < 60)
+
+	dave := dialTestClient(t, s, "dave")
+	connect := &protocol.ConnectRequest{
+		Version: protocol.Version2 + 1,
+		Name:    "dave",
+	}
+	dave.send(connect)
+	response, ok := dave.receive().(*protocol.FatalErrorResponse)
+	generic.TestEqual(t, "Connect", connect, true, ok && response.Error == protocol.UnsupportedVersion)
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.config.Admins = []string{"root"}
+	root := connectTestClient(t, s, "root")
+	root.send(&protocol.RegisterRequest{
+		Password: "secret",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("root")
+	})
+	alice := connectTestClient(t, s, "alice")
+	carol := connectTestClient(t, s, "carol")
+	alice.createRoom("ops-1")
+	alice.joinRoom("ops-1")
+
+	// Patterns without glob characters match name prefixes, ignoring case, as list filters do.
+	request := &protocol.SubscribeRequest{
+		Pattern: "OPS",
+	}
+	root.send(request)
+	generic.TestEqual(t, "Subscribe", request,
+		protocol.ServerResponse(&protocol.SubscriptionListResponse{
+			Count:    1,
+			Patterns: []string{"OPS"},
+		}),
+		root.receive(),
+	)
+
+	// Users that cannot monitor any matching room are refused instead of receiving nothing.
+	request = &protocol.SubscribeRequest{
+		Pattern: "ops-*",
+	}
+	carol.send(request)
+	response, ok := carol.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "Subscribe", "not operator", true, ok && response.Error == protocol.PermissionDenied)
+	alice.send(request)
+	generic.TestEqual(t, "Subscribe", "operator",
+		protocol.ServerResponse(&protocol.SubscriptionListResponse{
+			Count:    1,
+			Patterns: []string{"ops-*"},
+		}),
+		alice.receive(),
+	)
+
+	message := &protocol.MessageRoomRequest{
+		Room: "ops-1",
+		Text: "deploying",
+	}
+	alice.send(message)
+	generic.TestEqual(t, "MessageRoom", message,
+		protocol.ServerResponse(&protocol.RoomMessageResponse{
+			Room:   "ops-1",
+			Sender: "alice",
+			Text:   "deploying",
+		}),
+		root.receive(),
+	)
+
+	select {
+	case response := <-carol.responses:
+		t.Errorf("unexpected response without permission: %#v", response)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	alice.send(&protocol.ListUsersRequest{
+		Room: "ops-1",
+	})
+	generic.TestEqual(t, "ListUsers", "ops-1",
+		protocol.ServerResponse(&protocol.UserListResponse{
+			Room:  "ops-1",
+			Count: 1,
+			Users: []string{"alice"},
+		}),
+		alice.receive(),
+	)
+
+	root.send(&protocol.SubscribeRequest{
+		Pattern: "[",
+	})
+	response, ok = root.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "Subscribe", "invalid", true, ok && response.Error == protocol.InvalidFilter)
+
+	root.send(&protocol.UnsubscribeRequest{
+		Pattern: "OPS",
+	})
+	generic.TestEqual(t, "Unsubscribe", "OPS",
+		protocol.ServerResponse(&protocol.SubscriptionListResponse{
+			Count:    0,
+			Patterns: []string{},
+		}),
+		root.receive(),
+	)
+}
+
+func TestAdminRenamed(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.config.Admins = []string{"root"}
+	root := connectTestClient(t, s, "root")
+	root.send(&protocol.RegisterRequest{
+		Password: "secret",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("root")
+	})
+	root.send(&protocol.ChangeNameRequest{
+		Name: "groot",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("groot")
+	})
+
+	// Another user that registers the administrator name after the administrator renamed does not become an administrator.
+	mallory := connectTestClient(t, s, "root")
+	mallory.send(&protocol.RegisterRequest{
+		Password: "hunter2",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("root")
+	})
+
+	request := &protocol.SubscribeRequest{
+		Pattern: "*",
+	}
+	mallory.send(request)
+	response, ok := mallory.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "Subscribe", "new account", true, ok && response.Error == protocol.PermissionDenied)
+
+	root.send(request)
+	generic.TestEqual(t, "Subscribe", "renamed administrator",
+		protocol.ServerResponse(&protocol.SubscriptionListResponse{
+			Count:    1,
+			Patterns: []string{"*"},
+		}),
+		root.receive(),
+	)
+}
+
+func TestServerInfo(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.config.MOTD = "welcome"
+	s.config.Limits.MaxUsers = 10
+
+	// Version 1 clients do not expect the message of the day.
+	alice := connectTestClient(t, s, "alice")
+	alice.createRoom("ops")
+
+	carol := dialTestClient(t, s, "carol")
+	carol.send(&protocol.ConnectRequest{
+		Version: protocol.Version2,
+		Name:    "carol",
+	})
+	generic.TestEqual(t, "Connect", "carol",
+		protocol.ServerResponse(&protocol.MOTDResponse{
+			Text: "welcome",
+		}),
+		carol.receive(),
+	)
+
+	alice.send(&protocol.GetMOTDRequest{})
+	generic.TestEqual(t, "GetMOTD", "alice",
+		protocol.ServerResponse(&protocol.MOTDResponse{
+			Text: "welcome",
+		}),
+		alice.receive(),
+	)
+
+	waitFor(t, func() bool {
+		s.roomsMutex.RLock()
+		defer s.roomsMutex.RUnlock()
+		return len(s.rooms) == 2
+	})
+	alice.send(&protocol.GetServerInfoRequest{})
+	response, ok := alice.receive().(*protocol.ServerInfoResponse)
+	if !ok {
+		t.Fatal("expected ServerInfoResponse")
+	}
+	response.Version, response.Uptime = "", 0
+	generic.TestEqual(t, "GetServerInfo", "alice",
+		&protocol.ServerInfoResponse{
+			Name:       "chat",
+			Version:    "",
+			Uptime:     0,
+			MinVersion: protocol.Version1,
+			MaxVersion: protocol.Version2,
+			MaxUsers:   10,
+			MaxRooms:   0,
+			MaxQueued:  100,
+			MaxText:    uint32(s.config.Text.MaxLength),
+			Users:      2,
+			Rooms:      2,
+		},
+		response,
+	)
+}
+
+func TestAnnounce(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.config.Admins = []string{"root"}
+	root := connectTestClient(t, s, "root")
+	root.send(&protocol.RegisterRequest{
+		Password: "secret",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("root")
+	})
+	alice := connectTestClient(t, s, "alice")
+	carol := dialTestClient(t, s, "carol")
+	carol.send(&protocol.ConnectRequest{
+		Version: protocol.Version2,
+		Name:    "carol",
+	})
+	waitFor(t, func() bool {
+		return s.sessionCount("carol") > 0
+	})
+
+	request := &protocol.AnnounceRequest{
+		Count: 0,
+		Rooms: []string{},
+		Text:  "restarting soon",
+		At:    time.UnixMilli(0),
+	}
+	alice.send(request)
+	response, ok := alice.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "Announce", "alice", true, ok && response.Error == protocol.PermissionDenied)
+
+	root.send(request)
+	for _, tc := range []*testClient{root, alice} {
+		generic.TestEqual(t, "Announce", tc.name,
+			protocol.ServerResponse(&protocol.UserMessageResponse{
+				Sender: "root",
+				Text:   "restarting soon",
+			}),
+			tc.receive(),
+		)
+	}
+	announcement, ok := carol.receive().(*protocol.AnnouncementResponse)
+	if !ok {
+		t.Fatal("expected AnnouncementResponse")
+	}
+	announcement.Time = time.Time{}
+	generic.TestEqual(t, "Announce", "carol",
+		&protocol.AnnouncementResponse{
+			Sender: "root",
+			Room:   "",
+			Text:   "restarting soon",
+			Time:   time.Time{},
+		},
+		announcement,
+	)
+
+	root.send(&protocol.AnnounceRequest{
+		Count: 1,
+		Rooms: []string{"missing"},
+		Text:  "hello",
+		At:    time.UnixMilli(0),
+	})
+	response, ok = root.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "Announce", "missing", true, ok && response.Error == protocol.MissingRoom)
+}
+
+func TestScheduleMessage(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	alice.createRoom("ops")
+	alice.joinRoom("ops")
+	bob.joinRoom("ops")
+
+	at := time.Now().Add(50 * time.Millisecond)
+	request := &protocol.ScheduleMessageRequest{
+		Room: "ops",
+		Text: "later",
+		At:   at,
+	}
+	alice.send(request)
+	scheduled, ok := alice.receive().(*protocol.ScheduledResponse)
+	generic.TestEqual(t, "ScheduleMessage", request, true, ok && scheduled.At.UnixMilli() == at.UnixMilli())
+	generic.TestEqual(t, "ScheduleMessage", request,
+		protocol.ServerResponse(&protocol.RoomMessageResponse{
+			Room:   "ops",
+			Sender: "alice",
+			Text:   "later",
+		}),
+		bob.receive(),
+	)
+
+	alice.send(&protocol.ScheduleMessageRequest{
+		Room: "ops",
+		Text: "next year",
+		At:   time.Now().AddDate(1, 0, 0),
+	})
+	response, ok := alice.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "ScheduleMessage", "next year", true, ok && response.Error == protocol.LimitReached)
+
+	alice.send(&protocol.ScheduleMessageRequest{
+		Room: "ops",
+		Text: "tomorrow",
+		At:   time.Now().Add(24 * time.Hour),
+	})
+	_, ok = alice.receive().(*protocol.ScheduledResponse)
+	generic.TestEqual(t, "ScheduleMessage", "tomorrow", true, ok)
+
+	// The scheduled messages of a guest are canceled when the guest disconnects.
+	alice.conn.Close()
+	waitFor(t, func() bool {
+		s.scheduleMutex.Lock()
+		defer s.scheduleMutex.Unlock()
+		return len(s.scheduled) == 0
+	})
+}
+
+func TestScheduledAccount(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig()
+	config.StateFile = filepath.Join(t.TempDir(), "state.json")
+	s, err := NewServer(config, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.store.cost = bcrypt.MinCost
+	alice := connectTestClient(t, s, "alice")
+	alice.send(&protocol.RegisterRequest{
+		Password: "secret",
+	})
+	waitFor(t, func() bool {
+		return s.store.registered("alice")
+	})
+	bob := connectTestClient(t, s, "bob")
+	alice.createRoom("ops")
+	alice.joinRoom("ops")
+	bob.joinRoom("ops")
+
+	var ids []uint32
+	for _, request := range []*protocol.ScheduleMessageRequest{
+		{Room: "general", Text: "tomorrow", At: time.Now().Add(24 * time.Hour)},
+		{Room: "ops", Text: "soon", At: time.Now().Add(time.Hour)},
+		{Room: "ops", Text: "later", At: time.Now().Add(100 * time.Millisecond)},
+	} {
+		alice.send(request)
+		scheduled, ok := alice.receive().(*protocol.ScheduledResponse)
+		generic.TestEqual(t, "ScheduleMessage", request, true, ok)
+		ids = append(ids, scheduled.ID)
+	}
+
+	alice.send(&protocol.CancelScheduledRequest{
+		ID: ids[1],
+	})
+	list, ok := alice.receive().(*protocol.ScheduledListResponse)
+	generic.TestEqual(t, "CancelScheduled", ids[1], true, ok && list.Count == 2)
+	generic.TestEqual(t, "CancelScheduled", "order", []uint32{ids[2], ids[0]}, []uint32{list.Items[0].ID, list.Items[1].ID})
+	generic.TestEqual(t, "CancelScheduled", "item", []string{"ops"}, list.Items[0].Rooms)
+
+	// Users can only see and cancel their own scheduled messages.
+	bob.send(&protocol.ListScheduledRequest{})
+	list, ok = bob.receive().(*protocol.ScheduledListResponse)
+	generic.TestEqual(t, "ListScheduled", "bob", true, ok && list.Count == 0)
+	bob.send(&protocol.CancelScheduledRequest{
+		ID: ids[0],
+	})
+	response, ok := bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "CancelScheduled", "bob", true, ok && response.Error == protocol.MissingScheduled)
+
+	// The scheduled messages of an account are still sent after its user disconnects.
+	alice.conn.Close()
+	waitFor(t, func() bool {
+		return s.sessionCount("alice") == 0
+	})
+	generic.TestEqual(t, "ScheduleMessage", "disconnected",
+		protocol.ServerResponse(&protocol.RoomMessageResponse{
+			Room:   "ops",
+			Sender: "alice",
+			Text:   "later",
+		}),
+		bob.receive(),
+	)
+
+	// They are also kept across restarts.
+	restarted, err := NewServer(config, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice = loginTestClient(t, restarted, "alice", "secret")
+	alice.send(&protocol.ListScheduledRequest{})
+	list, ok = alice.receive().(*protocol.ScheduledListResponse)
+	generic.TestEqual(t, "ListScheduled", "restarted", true, ok && list.Count == 1 && list.Items[0].ID == ids[0])
+	alice.send(&protocol.CancelScheduledRequest{
+		ID: ids[0],
+	})
+	list, ok = alice.receive().(*protocol.ScheduledListResponse)
+	generic.TestEqual(t, "CancelScheduled", "restarted", true, ok && list.Count == 0)
+}
+
+func TestSetRetention(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.config.Retention.MaxAgeDays = 30
+	alice := connectTestClient(t, s, "alice")
+	bob := connectTestClient(t, s, "bob")
+	alice.createRoom("ops")
+	alice.joinRoom("ops")
+	for _, text := range []string{"one", "two", "three"} {
+		alice.send(&protocol.MessageRoomRequest{
+			Room: "ops",
+			Text: text,
+		})
+	}
+
+	request := &protocol.SetRetentionRequest{
+		Room: "ops",
+		Retention: protocol.Retention{
+			MaxAge:      0,
+			MaxMessages: 2,
+			MaxBytes:    0,
+		},
+	}
+	bob.send(request)
+	response, ok := bob.receive().(*protocol.ErrorResponse)
+	generic.TestEqual(t, "SetRetention", "bob", true, ok && response.Error == protocol.PermissionDenied)
+
+	alice.send(request)
+	generic.TestEqual(t, "SetRetention", request,
+		protocol.ServerResponse(&protocol.RoomDetailsResponse{
+			Name:      "ops",
+			Members:   1,
+			Topic:     "",
+			Flags:     protocol.RoomJoined | protocol.RoomOperator,
+			Retention: request.Retention,
+			Effective: protocol.Retention{
+				MaxAge:      30 * 24 * 60 * 60,
+				MaxMessages: 2,
+				MaxBytes:    0,
+			},
+		}),
+		alice.receive(),
+	)
+
+	bob.send(&protocol.DescribeRoomRequest{
+		Room: "ops",
+	})
+	details, ok := bob.receive().(*protocol.RoomDetailsResponse)
+	generic.TestEqual(t, "DescribeRoom", "bob", true, ok && details.Flags == 0 && details.Retention == request.Retention)
+
+	waitFor(t, func() bool {
+		return s.history.last("ops") == 3
+	})
+	s.compactHistory()
+	s.history.mutex.RLock()
+	kept := len(s.history.rooms["ops"])
+	s.history.mutex.RUnlock()
+	generic.TestEqual(t, "compactHistory", "ops", 2, kept)
+}
+
+func TestRoomLifetime(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.config.Rooms.GraceSeconds = 60
+	alice := connectTestClient(t, s, "alice")
+	alice.createRoom("temp")
+	alice.createRoom("keep")
+	alice.createRoom("unused")
+
+	alice.send(&protocol.SetRoomOptionRequest{
+		Room:   "keep",
+		Option: protocol.Lifetime,
+		Value:  protocol.PermanentRoom,
+	})
+	waitFor(t, func() bool {
+		lifetime, _ := s.findRoom("keep").effectiveLifetime(s.config.Rooms)
+		return lifetime == protocol.PermanentRoom
+	})
+
+	for _, roomName := range []string{"temp", "keep"} {
+		alice.joinRoom(roomName)
+		alice.send(&protocol.LeaveRoomRequest{
+			Room: roomName,
+		})
+		waitFor(t, func() bool {
+			return !s.findRoom(roomName).contains("alice")
+		})
+	}
+
+	exists := func(now time.Time, roomNames ...string) {
+		t.Helper()
+
+		s.sweepRooms(now)
+		for _, roomName := range roomNames {
+			generic.TestEqual(t, "sweepRooms", roomName, true, s.findRoom(roomName) != nil)
+		}
+	}
+	exists(time.Now(), "temp", "keep", "unused")
+	exists(time.Now().Add(2*time.Minute), "keep", "unused")
+	generic.TestEqual(t, "sweepRooms", "temp", true, s.findRoom("temp") == nil)
+	exists(time.Now().Add(2*time.Hour), "keep", "general")
+	generic.TestEqual(t, "sweepRooms", "unused", true, s.findRoom("unused") == nil)
+
+	for _, request := range []*protocol.SetRoomOptionRequest{
+		{Room: "general", Option: protocol.Lifetime, Value: protocol.EphemeralRoom},
+		{Room: "keep", Option: protocol.Lifetime, Value: 3},
+	} {
+		alice.send(request)
+		_, ok := alice.receive().(*protocol.ErrorResponse)
+		generic.TestEqual(t, "SetRoomOption", request, true, ok)
+	}
+}
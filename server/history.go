@@ -0,0 +1,578 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+var (
+	errMissingMessage = errors.New("message not found")
+	errReactionLimit  = errors.New("too many reactions")
+)
+
+// The maximum number of different reactions to a message.
+const maxReactions = 20
+
+// history keeps the chat messages relayed by the server so that they can be referred to by ID.
+// Changes are appended to a log file that is replayed on startup unless the path is empty.
+type history struct {
+	file  *os.File
+	mutex sync.RWMutex
+
+	lastID   protocol.MessageID
+	messages map[protocol.MessageID]*message
+	rooms    map[string][]*message                      // The messages of each room in the order they were sent.
+	replies  map[protocol.MessageID][]*message          // The replies to each message in the order they were sent.
+	terms    map[string]map[protocol.MessageID]struct{} // The IDs of the room messages that contain each search term.
+}
+
+type message struct {
+	ID        protocol.MessageID `json:"id"`
+	Time      time.Time          `json:"time"`
+	ReplyTo   protocol.MessageID `json:"reply_to,omitempty"`
+	Room      string             `json:"room,omitempty"`
+	Sender    string             `json:"sender"`
+	Recipient string             `json:"recipient,omitempty"`
+	Text      string             `json:"text"`
+
+	Account          uint64     `json:"account,omitempty"`           // The account ID of the sender, or zero for a guest.
+	RecipientAccount uint64     `json:"recipient_account,omitempty"` // The account ID of the recipient, or zero for a guest.
+	Dropped          bool       `json:"dropped,omitempty"`           // Whether the recipient blocked the direct message.
+	Edited           *time.Time `json:"edited,omitempty"`
+	Deleted          bool       `json:"deleted,omitempty"`
+	Reactions        []reaction `json:"reactions,omitempty"` // In the order they were first added.
+	Delivered        bool       `json:"delivered,omitempty"` // Whether the direct message was written to a client of the recipient.
+	Read             bool       `json:"read,omitempty"`      // Whether the recipient read the direct message.
+
+	author    *user // The user that sent the message, if it is still connected.
+	recipient *user // The user that the direct message was sent to, if it is still connected.
+}
+
+// A reaction is a reaction to a message with the names of the users that reacted with it.
+// Reactions are replaced instead of modified so that copies of a message stay unchanged.
+type reaction struct {
+	Reaction string   `json:"reaction"`
+	Users    []string `json:"users"`
+}
+
+// A historyEntry is a line of the history log.
+type historyEntry struct {
+	Message  *message           `json:"message,omitempty"`
+	Edit     protocol.MessageID `json:"edit,omitempty"`
+	Delete   protocol.MessageID `json:"delete,omitempty"`
+	React    protocol.MessageID `json:"react,omitempty"`
+	Unreact  protocol.MessageID `json:"unreact,omitempty"`
+	Deliver  protocol.MessageID `json:"deliver,omitempty"`
+	Read     protocol.MessageID `json:"read,omitempty"`
+	LastID   protocol.MessageID `json:"last_id,omitempty"` // Keeps IDs unique after the messages with the highest IDs are removed.
+	Time     *time.Time         `json:"time,omitempty"`
+	Text     string             `json:"text,omitempty"`
+	User     string             `json:"user,omitempty"`
+	Reaction string             `json:"reaction,omitempty"`
+	Purge    string             `json:"purge,omitempty"` // The room whose messages are removed.
+}
+
+func openHistory(path string) (*history, error) {
+	h := &history{
+		file:  nil,
+		mutex: sync.RWMutex{},
+
+		lastID:   0,
+		messages: make(map[protocol.MessageID]*message),
+		rooms:    make(map[string][]*message),
+		replies:  make(map[protocol.MessageID][]*message),
+		terms:    make(map[string]map[protocol.MessageID]struct{}),
+	}
+	if path == "" {
+		return h, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	} else if err == nil {
+		err = h.replay(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading history %s: %w", path, err)
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating history directory: %w", err)
+	}
+
+	h.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening history: %w", err)
+	}
+
+	return h, nil
+}
+
+func (h *history) replay(file *os.File) error {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var entry historyEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		h.apply(entry)
+	}
+	return scanner.Err()
+}
+
+// apply changes the messages according to an entry. The caller must hold the mutex.
+func (h *history) apply(entry historyEntry) {
+	switch {
+	case entry.Message != nil:
+		m := entry.Message
+		h.messages[m.ID] = m
+		if m.Room != "" {
+			h.rooms[m.Room] = append(h.rooms[m.Room], m)
+		}
+		if m.ReplyTo != 0 {
+			h.replies[m.ReplyTo] = append(h.replies[m.ReplyTo], m)
+		}
+		h.index(m)
+		if m.ID > h.lastID {
+			h.lastID = m.ID
+		}
+
+	case entry.Edit != 0:
+		if m, ok := h.messages[entry.Edit]; ok {
+			h.unindex(m)
+			m.Text = entry.Text
+			m.Edited = entry.Time
+			h.index(m)
+		}
+
+	case entry.Delete != 0:
+		if m, ok := h.messages[entry.Delete]; ok {
+			h.unindex(m)
+			m.Text = ""
+			m.Deleted = true
+			m.Reactions = nil
+		}
+
+	case entry.React != 0:
+		if m, ok := h.messages[entry.React]; ok {
+			m.Reactions = m.react(entry.Reaction, entry.User, true)
+		}
+
+	case entry.Unreact != 0:
+		if m, ok := h.messages[entry.Unreact]; ok {
+			m.Reactions = m.react(entry.Reaction, entry.User, false)
+		}
+
+	case entry.Deliver != 0:
+		if m, ok := h.messages[entry.Deliver]; ok {
+			m.Delivered = true
+		}
+
+	case entry.Read != 0:
+		if m, ok := h.messages[entry.Read]; ok {
+			m.Delivered = true
+			m.Read = true
+		}
+
+	case entry.Purge != "":
+		for _, m := range h.rooms[entry.Purge] {
+			h.prune(m)
+		}
+		delete(h.rooms, entry.Purge)
+
+	case entry.LastID != 0:
+		if entry.LastID > h.lastID {
+			h.lastID = entry.LastID
+		}
+	}
+}
+
+// record applies an entry and appends it to the log. The caller must hold the mutex.
+func (h *history) record(entry historyEntry) error {
+	h.apply(entry)
+	if h.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding history: %w", err)
+	}
+
+	_, err = h.file.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("error writing history: %w", err)
+	}
+
+	return nil
+}
+
+// add assigns an ID and time to the message and stores it.
+// The message is stored even if the returned error is from writing the log.
+func (h *history) add(m *message) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.lastID++
+	m.ID = h.lastID
+	m.Time = time.Now().UTC()
+
+	return h.record(historyEntry{
+		Message:  m,
+		Edit:     0,
+		Delete:   0,
+		React:    0,
+		Unreact:  0,
+		Deliver:  0,
+		Read:     0,
+		LastID:   0,
+		Time:     nil,
+		Text:     "",
+		User:     "",
+		Reaction: "",
+		Purge:    "",
+	})
+}
+
+// get returns a copy of the message with the ID.
+func (h *history) get(id protocol.MessageID) (message, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	m, ok := h.messages[id]
+	if !ok || m.Deleted {
+		return message{}, false
+	}
+	return *m, true
+}
+
+// edit replaces the text of a message and returns the edited message.
+func (h *history) edit(id protocol.MessageID, text string) (message, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	m, ok := h.messages[id]
+	if !ok || m.Deleted {
+		return message{}, errMissingMessage
+	}
+
+	now := time.Now().UTC()
+	err := h.record(historyEntry{
+		Message:  nil,
+		Edit:     id,
+		Delete:   0,
+		React:    0,
+		Unreact:  0,
+		Deliver:  0,
+		Read:     0,
+		LastID:   0,
+		Time:     &now,
+		Text:     text,
+		User:     "",
+		Reaction: "",
+		Purge:    "",
+	})
+	return *m, err
+}
+
+// remove retracts the text of a message. The message ID stays reserved.
+func (h *history) remove(id protocol.MessageID) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	m, ok := h.messages[id]
+	if !ok || m.Deleted {
+		return errMissingMessage
+	}
+
+	return h.record(historyEntry{
+		Message:  nil,
+		Edit:     0,
+		Delete:   id,
+		React:    0,
+		Unreact:  0,
+		Deliver:  0,
+		Read:     0,
+		LastID:   0,
+		Time:     nil,
+		Text:     "",
+		User:     "",
+		Reaction: "",
+		Purge:    "",
+	})
+}
+
+// purge removes the messages of a room that no longer exists, so that a new room
+// with the same name cannot see or moderate them. The message IDs stay reserved.
+func (h *history) purge(room string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.rooms[room]) == 0 {
+		return nil
+	}
+
+	return h.record(historyEntry{
+		Message:  nil,
+		Edit:     0,
+		Delete:   0,
+		React:    0,
+		Unreact:  0,
+		Deliver:  0,
+		Read:     0,
+		LastID:   0,
+		Time:     nil,
+		Text:     "",
+		User:     "",
+		Reaction: "",
+		Purge:    room,
+	})
+}
+
+// react adds or removes the reaction of a user to a message and returns the message.
+// It reports whether the reactions changed.
+func (h *history) react(id protocol.MessageID, userName, reaction string, add bool) (message, bool, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	m, ok := h.messages[id]
+	if !ok || m.Deleted {
+		return message{}, false, errMissingMessage
+	}
+
+	i := m.reaction(reaction)
+	if add && i < 0 && len(m.Reactions) >= maxReactions {
+		return *m, false, errReactionLimit
+	}
+	if add == (i >= 0 && contains(m.Reactions[i].Users, userName)) {
+		return *m, false, nil
+	}
+
+	entry := historyEntry{
+		Message:  nil,
+		Edit:     0,
+		Delete:   0,
+		React:    0,
+		Unreact:  0,
+		Deliver:  0,
+		Read:     0,
+		LastID:   0,
+		Time:     nil,
+		Text:     "",
+		User:     userName,
+		Reaction: reaction,
+		Purge:    "",
+	}
+	if add {
+		entry.React = id
+	} else {
+		entry.Unreact = id
+	}
+	err := h.record(entry)
+	return *m, true, err
+}
+
+// last returns the ID of the last message sent to a room, or zero.
+func (h *history) last(room string) protocol.MessageID {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	messages := h.rooms[room]
+	if len(messages) == 0 {
+		return 0
+	}
+	return messages[len(messages)-1].ID
+}
+
+// unread returns the number of messages sent to a room after the message with the ID,
+// leaving out deleted messages and messages from the user.
+func (h *history) unread(room string, after protocol.MessageID, userName string) uint32 {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	messages := h.rooms[room]
+	i := sort.Search(len(messages), func(i int) bool {
+		return messages[i].ID > after
+	})
+
+	var count uint32
+	for _, m := range messages[i:] {
+		if !m.Deleted && m.Sender != userName {
+			count++
+		}
+	}
+	return count
+}
+
+// thread returns copies of the message with the ID and of all of its direct and indirect replies
+// in the order they were sent. Deleted replies are left out.
+func (h *history) thread(root protocol.MessageID) ([]message, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	m, ok := h.messages[root]
+	if !ok || m.Deleted {
+		return nil, false
+	}
+
+	var thread []message
+	pending := []*message{m}
+	for len(pending) > 0 {
+		m := pending[0]
+		pending = append(pending[1:], h.replies[m.ID]...)
+		if !m.Deleted {
+			thread = append(thread, *m)
+		}
+	}
+
+	sort.Slice(thread, func(i, j int) bool {
+		return thread[i].ID < thread[j].ID
+	})
+	return thread, true
+}
+
+// receipt marks a direct message as delivered or as read and returns the message.
+// It reports whether the state of the message changed.
+func (h *history) receipt(id protocol.MessageID, read bool) (message, bool, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	m, ok := h.messages[id]
+	if !ok || m.Recipient == "" {
+		return message{}, false, errMissingMessage
+	}
+	if m.Read || (m.Delivered && !read) {
+		return *m, false, nil
+	}
+
+	entry := historyEntry{
+		Message:  nil,
+		Edit:     0,
+		Delete:   0,
+		React:    0,
+		Unreact:  0,
+		Deliver:  0,
+		Read:     0,
+		LastID:   0,
+		Time:     nil,
+		Text:     "",
+		User:     "",
+		Reaction: "",
+		Purge:    "",
+	}
+	if read {
+		entry.Read = id
+	} else {
+		entry.Deliver = id
+	}
+	err := h.record(entry)
+	return *m, true, err
+}
+
+// sentBy reports whether u can modify the message as its sender.
+// A registered user can modify its messages from any session and under any name, while a guest can only modify
+// messages sent under its current connection so that a later user with the same name cannot.
+func (m *message) sentBy(u *user) bool {
+	if m.author == u {
+		return true
+	}
+	return m.Account != 0 && m.Account == u.account.Load()
+}
+
+// reaction returns the index of the reaction in the reactions to the message, or -1.
+func (m *message) reaction(name string) int {
+	for i := range m.Reactions {
+		if m.Reactions[i].Reaction == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// react returns a copy of the reactions to the message with the reaction of a user added or removed.
+// A reaction without users is removed.
+func (m *message) react(name, userName string, add bool) []reaction {
+	reactions := make([]reaction, 0, len(m.Reactions)+1)
+	found := false
+	for _, r := range m.Reactions {
+		if r.Reaction != name {
+			reactions = append(reactions, r)
+			continue
+		}
+
+		found = true
+		users := make([]string, 0, len(r.Users)+1)
+		for _, user := range r.Users {
+			if user != userName {
+				users = append(users, user)
+			}
+		}
+		if add {
+			users = append(users, userName)
+		}
+		if len(users) > 0 {
+			reactions = append(reactions, reaction{
+				Reaction: r.Reaction,
+				Users:    users,
+			})
+		}
+	}
+	if add && !found {
+		reactions = append(reactions, reaction{
+			Reaction: name,
+			Users:    []string{userName},
+		})
+	}
+	return reactions
+}
+
+// reactions returns the number of users for each reaction to the message.
+func (m *message) reactions() []protocol.Reaction {
+	reactions := make([]protocol.Reaction, len(m.Reactions))
+	for i, r := range m.Reactions {
+		reactions[i] = protocol.Reaction{
+			Reaction: r.Reaction,
+			Count:    uint32(len(r.Users)),
+		}
+	}
+	return reactions
+}
+
+// receivedBy reports whether u is the recipient of the direct message.
+// The same rules apply as for sentBy.
+func (m *message) receivedBy(u *user) bool {
+	if m.Recipient == "" || m.Dropped {
+		return false
+	}
+	if m.recipient == u {
+		return true
+	}
+	return m.RecipientAccount != 0 && m.RecipientAccount == u.account.Load()
+}
+
+func (m *message) response() *protocol.ChatMessageResponse {
+	return &protocol.ChatMessageResponse{
+		ID:        m.ID,
+		Time:      m.Time,
+		ReplyTo:   m.ReplyTo,
+		Room:      m.Room,
+		Sender:    m.Sender,
+		Recipient: m.Recipient,
+		Text:      m.Text,
+	}
+}
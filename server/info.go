@@ -0,0 +1,54 @@
+package server
+
+import (
+	"runtime/debug"
+	"time"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+// version returns the module version that the server was built from.
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(devel)"
+	}
+	return info.Main.Version
+}
+
+// info returns a response that describes the server and its current load.
+func (s *Server) info() *protocol.ServerInfoResponse {
+	s.usersMutex.RLock()
+	users := len(s.users)
+	s.usersMutex.RUnlock()
+
+	s.roomsMutex.RLock()
+	rooms := len(s.rooms)
+	s.roomsMutex.RUnlock()
+
+	return &protocol.ServerInfoResponse{
+		Name:       s.config.Name,
+		Version:    version(),
+		Uptime:     uint32(time.Since(s.started) / time.Second),
+		MinVersion: protocol.Version1,
+		MaxVersion: protocol.Version2,
+		MaxUsers:   uint32(s.config.Limits.MaxUsers),
+		MaxRooms:   uint32(s.config.Limits.MaxRooms),
+		MaxQueued:  uint32(s.config.Limits.MaxQueued),
+		MaxText:    uint32(s.config.Text.MaxLength),
+		Users:      uint32(users),
+		Rooms:      uint32(rooms),
+	}
+}
+
+// sendMOTD sends the message of the day to a client that just connected, if the server has one
+// and the client uses a protocol version that expects it.
+func (cu *connectedUser) sendMOTD() {
+	if cu.server.config.MOTD == "" || !cu.uses(protocol.Version2) {
+		return
+	}
+
+	cu.outgoing <- &protocol.MOTDResponse{
+		Text: cu.server.config.MOTD,
+	}
+}
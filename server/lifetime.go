@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+const (
+	sweepInterval  = 10 * time.Second // How often rooms are checked for removal.
+	maxGracePeriod = 7 * 24 * 60 * 60 // The longest grace period in seconds that operators can give a room.
+)
+
+// Lifetime decides when the rooms that users create are removed.
+// Rooms from DefaultRooms and the general room are always kept.
+type Lifetime struct {
+	Permanent       bool `json:"permanent"`        // Keep empty rooms unless their operators make them ephemeral.
+	GraceSeconds    int  `json:"grace_seconds"`    // How long an ephemeral room is kept after its last member leaves.
+	UnjoinedSeconds int  `json:"unjoined_seconds"` // How long a room that nobody has joined is kept, unless it was made permanent. Zero keeps it.
+}
+
+func (l Lifetime) check() error {
+	if l.GraceSeconds < 0 || l.UnjoinedSeconds < 0 {
+		return errors.New("durations cannot be negative")
+	}
+	return nil
+}
+
+// effectiveLifetime returns whether the room is ephemeral or permanent, and its grace period.
+func (r *room) effectiveLifetime(defaults Lifetime) (uint32, time.Duration) {
+	r.optionsMutex.RLock()
+	lifetime, grace := r.lifetime, r.gracePeriod
+	r.optionsMutex.RUnlock()
+
+	switch {
+	case r.permanent:
+		lifetime = protocol.PermanentRoom
+	case lifetime == protocol.DefaultLifetime && defaults.Permanent:
+		lifetime = protocol.PermanentRoom
+	case lifetime == protocol.DefaultLifetime:
+		lifetime = protocol.EphemeralRoom
+	}
+	if grace == 0 {
+		grace = time.Duration(defaults.GraceSeconds) * time.Second
+	}
+	return lifetime, grace
+}
+
+// expired reports whether the room should be removed: either nobody joined it in time
+// and its operators did not make it permanent, or it is ephemeral and has been empty for longer than its grace period.
+func (r *room) expired(now time.Time, defaults Lifetime) bool {
+	if r.permanent {
+		return false
+	}
+	lifetime, grace := r.effectiveLifetime(defaults)
+	r.optionsMutex.RLock()
+	madePermanent := r.lifetime == protocol.PermanentRoom
+	r.optionsMutex.RUnlock()
+
+	r.usersMutex.RLock()
+	defer r.usersMutex.RUnlock()
+
+	switch {
+	case len(r.users) > 0:
+		return false
+	case !r.joined:
+		unjoined := time.Duration(defaults.UnjoinedSeconds) * time.Second
+		return !madePermanent && unjoined > 0 && now.Sub(r.created) >= unjoined
+	default:
+		return lifetime == protocol.EphemeralRoom && now.Sub(r.emptySince) >= grace
+	}
+}
+
+// sweepPeriodically removes expired rooms every sweepInterval.
+func (s *Server) sweepPeriodically() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.sweepRooms(now)
+	}
+}
+
+// sweepRooms removes the rooms that have expired at the given time.
+func (s *Server) sweepRooms(now time.Time) {
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	for roomName, room := range s.rooms {
+		if room.expired(now, s.config.Rooms) {
+			s.removeRoom(roomName)
+		}
+	}
+}
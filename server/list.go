@@ -0,0 +1,174 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+const (
+	defaultPageSize = 50 // The number of list entries when the client does not set a limit.
+	maxPageSize     = 200
+)
+
+// validateFilter checks that a list filter is a valid glob pattern.
+func validateFilter(filter string) error {
+	_, err := path.Match(filter, "")
+	if err != nil {
+		return fmt.Errorf("%q is not a valid pattern", filter)
+	}
+	return nil
+}
+
+// matchFilter reports whether a name matches a list filter, ignoring case.
+// A filter without glob metacharacters matches names that start with it.
+func matchFilter(filter, name string) bool {
+	filter = strings.ToLower(filter)
+	name = strings.ToLower(name)
+	if !strings.ContainsAny(filter, `*?[\`) {
+		return strings.HasPrefix(name, filter)
+	}
+	matched, _ := path.Match(filter, name)
+	return matched
+}
+
+// A pageEntry is an entry of a list with the key that orders it.
+type pageEntry[T any] struct {
+	key   string
+	value T
+}
+
+// sortKey returns the key that orders an entry of a list with the name and size.
+// The keys are also the cursors of the pages, so they must be unique and only depend on the entry.
+func sortKey(order protocol.ListOrder, name string, size int) string {
+	if order == protocol.OrderBySize {
+		return fmt.Sprintf("%010d %s", math.MaxUint32-uint32(size), name)
+	}
+	return name
+}
+
+// page sorts the entries and returns the values of up to limit entries after the cursor,
+// and the cursor for the next page, or an empty string if there are no more entries.
+func page[T any](entries []pageEntry[T], cursor string, limit uint32) ([]T, string) {
+	if limit == 0 {
+		limit = defaultPageSize
+	} else if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].key > cursor
+	})
+	entries = entries[i:]
+
+	next := ""
+	if len(entries) > int(limit) {
+		entries = entries[:limit]
+		next = entries[limit-1].key
+	}
+
+	values := make([]T, len(entries))
+	for i, entry := range entries {
+		values[i] = entry.value
+	}
+	return values, next
+}
+
+// roomEntries returns a response with the entries of the rooms for a client that uses Version2.
+// Rooms that were removed in the meantime are left out.
+func (cu *connectedUser) roomEntries(userName, next string, roomNames []string) *protocol.RoomEntryListResponse {
+	u := cu.identity()
+	entries := make([]protocol.RoomEntry, 0, len(roomNames))
+
+	cu.server.roomsMutex.RLock()
+	for _, roomName := range roomNames {
+		room, ok := cu.server.rooms[roomName]
+		if !ok {
+			continue
+		}
+		info := room.info(roomName)
+
+		entries = append(entries, protocol.RoomEntry{
+			Name:    info.Name,
+			Members: info.Members,
+			Topic:   info.Topic,
+			Flags:   room.flags(u, cu.server.config.Rooms),
+		})
+	}
+	cu.server.roomsMutex.RUnlock()
+
+	return &protocol.RoomEntryListResponse{
+		User:  userName,
+		Next:  next,
+		Count: uint32(len(entries)),
+		Rooms: entries,
+	}
+}
+
+// roomDetails returns a response with the details of a room for the client user.
+func (cu *connectedUser) roomDetails(roomName string, room *room) *protocol.RoomDetailsResponse {
+	info := room.info(roomName)
+
+	room.optionsMutex.RLock()
+	retention := room.retention
+	room.optionsMutex.RUnlock()
+
+	return &protocol.RoomDetailsResponse{
+		Name:      info.Name,
+		Members:   info.Members,
+		Topic:     info.Topic,
+		Flags:     room.flags(cu.identity(), cu.server.config.Rooms),
+		Retention: retention,
+		Effective: stricter(retention, cu.server.config.Retention.limits()),
+	}
+}
+
+// flags returns the flags of the room for u.
+func (r *room) flags(u *user, defaults Lifetime) protocol.RoomFlags {
+	var flags protocol.RoomFlags
+	r.usersMutex.RLock()
+	if r.users[u.name()] == u {
+		flags |= protocol.RoomJoined
+	}
+	r.usersMutex.RUnlock()
+	r.optionsMutex.RLock()
+	if _, ok := r.operators[u.name()]; ok {
+		flags |= protocol.RoomOperator
+	}
+	if r.allowOutsidePosts {
+		flags |= protocol.RoomOutsidePosts
+	}
+	r.optionsMutex.RUnlock()
+	if lifetime, _ := r.effectiveLifetime(defaults); lifetime == protocol.PermanentRoom {
+		flags |= protocol.RoomPermanent
+	}
+	return flags
+}
+
+// userEntries returns a response with the entries of the users for a client that uses Version2.
+func userEntries(roomName, next string, users []*user) *protocol.UserEntryListResponse {
+	entries := make([]protocol.UserEntry, len(users))
+	for i, user := range users {
+		presence, message := user.status()
+		entries[i] = protocol.UserEntry{
+			Name:     user.name(),
+			Presence: presence,
+			Message:  message,
+			Idle:     user.idle(),
+		}
+	}
+
+	return &protocol.UserEntryListResponse{
+		Room:  roomName,
+		Next:  next,
+		Count: uint32(len(entries)),
+		Users: entries,
+	}
+}
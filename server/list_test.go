@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/mnxn/chat/generic"
+)
+
+var matchFilterTests = []struct {
+	filter  string
+	name    string
+	matched bool
+}{
+	{"", "general", true},
+	{"gen", "general", true},
+	{"GEN", "General", true},
+	{"eral", "general", false},
+	{"*eral", "general", true},
+	{"g?neral", "general", true},
+	{"[a-f]*", "general", false},
+	{"[a-h]*", "general", true},
+}
+
+func TestMatchFilter(t *testing.T) {
+	t.Parallel()
+
+	for i := range matchFilterTests {
+		test := matchFilterTests[i]
+		t.Run("matchFilter", func(t *testing.T) {
+			t.Parallel()
+
+			actual := matchFilter(test.filter, test.name)
+			generic.TestEqual(t, "matchFilter", test.filter+" "+test.name, test.matched, actual)
+		})
+	}
+}
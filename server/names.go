@@ -0,0 +1,244 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+// A NamePolicy decides which user or room names are accepted by the server.
+type NamePolicy interface {
+	// Validate returns the name that the server should use for the requested name,
+	// or an error that explains the naming requirements to the client.
+	Validate(name string) (string, error)
+
+	// Skeleton returns a canonical form of the name that is shared by names that look alike.
+	//   - An empty skeleton disables look-alike detection for the name.
+	Skeleton(name string) string
+}
+
+// NameRules is the configurable NamePolicy.
+type NameRules struct {
+	MinLength   int      `json:"min_length"`  // The minimum number of characters in a name.
+	MaxLength   int      `json:"max_length"`  // The maximum number of characters in a name. Zero means unlimited.
+	Classes     []string `json:"classes"`     // Allowed character classes: letter, mark, digit, number, punct, symbol, space.
+	Forbidden   string   `json:"forbidden"`   // Characters that cannot appear in a name even if their class is allowed.
+	Reserved    []string `json:"reserved"`    // Names, and names that look like them, that cannot be used.
+	Normalize   bool     `json:"normalize"`   // Whether names are converted to Unicode normalization form C.
+	Confusables bool     `json:"confusables"` // Whether names that look like an existing name are rejected.
+}
+
+var characterClasses = map[string]*unicode.RangeTable{
+	"letter": unicode.L,
+	"mark":   unicode.M,
+	"digit":  unicode.Nd,
+	"number": unicode.N,
+	"punct":  unicode.P,
+	"symbol": unicode.S,
+	"space":  unicode.Zs,
+}
+
+// DefaultNameRules returns the rules used for names when the config does not specify any.
+func DefaultNameRules() NameRules {
+	return NameRules{
+		MinLength:   1,
+		MaxLength:   32,
+		Classes:     []string{"letter", "mark", "digit", "punct", "symbol"},
+		Forbidden:   "",
+		Reserved:    []string{},
+		Normalize:   true,
+		Confusables: true,
+	}
+}
+
+func (n NameRules) check() error {
+	if n.MinLength < 0 || n.MaxLength < 0 {
+		return errors.New("name lengths cannot be negative")
+	}
+	if n.MaxLength > 0 && n.MinLength > n.MaxLength {
+		return errors.New("min_length cannot be greater than max_length")
+	}
+	for _, class := range n.Classes {
+		if _, ok := characterClasses[class]; !ok {
+			return fmt.Errorf("unknown character class %q", class)
+		}
+	}
+	return nil
+}
+
+func (n NameRules) Validate(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", errors.New("must be valid UTF-8")
+	}
+	if n.Normalize {
+		name = norm.NFC.String(name)
+	}
+
+	length := utf8.RuneCountInString(name)
+	if length < n.MinLength {
+		return "", fmt.Errorf("must be at least %d characters", n.MinLength)
+	}
+	if n.MaxLength > 0 && length > n.MaxLength {
+		return "", fmt.Errorf("must be at most %d characters", n.MaxLength)
+	}
+
+	for _, r := range name {
+		if strings.ContainsRune(n.Forbidden, r) {
+			return "", fmt.Errorf("cannot contain %q", r)
+		}
+		if !n.allowed(r) {
+			return "", fmt.Errorf("cannot contain %q: allowed characters are %s", r, strings.Join(n.Classes, ", "))
+		}
+	}
+
+	skeleton := n.Skeleton(name)
+	for _, reserved := range n.Reserved {
+		if name == reserved || (skeleton != "" && skeleton == n.Skeleton(reserved)) {
+			return "", fmt.Errorf("%q is reserved", reserved)
+		}
+	}
+
+	return name, nil
+}
+
+func (n NameRules) allowed(r rune) bool {
+	for _, class := range n.Classes {
+		if unicode.Is(characterClasses[class], r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n NameRules) Skeleton(name string) string {
+	if !n.Confusables {
+		return ""
+	}
+	return skeleton(name)
+}
+
+// confusables maps characters to the ASCII character they are commonly mistaken for.
+var confusables = map[rune]rune{
+	'0': 'o', '1': 'l', 'i': 'l', '|': 'l', '5': 's', '$': 's',
+
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'l', 'ј': 'j',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'һ': 'h',
+
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'l', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+}
+
+// skeleton folds case and compatibility forms, removes combining marks,
+// and replaces confusable characters so that names that look alike compare equal.
+func skeleton(name string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFKD.String(name) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		sb.WriteRune(r)
+	}
+
+	folded := sb.String()
+	folded = strings.ReplaceAll(folded, "rn", "m")
+	folded = strings.ReplaceAll(folded, "vv", "w")
+	return folded
+}
+
+// canonical returns the form of name that the policy stores it in so that lookups match any equivalent form.
+// Names that the policy rejects are returned unchanged and can only match exactly.
+func canonical(policy NamePolicy, name string) string {
+	if validated, err := policy.Validate(name); err == nil {
+		return validated
+	}
+	return name
+}
+
+// normalizeNames replaces the names of existing users and rooms in a request with their canonical forms.
+// Requests that create a name validate it themselves.
+func (s *Server) normalizeNames(request protocol.ClientRequest) {
+	user := func(name *string) { *name = canonical(s.userNames, *name) }
+	room := func(name *string) { *name = canonical(s.roomNames, *name) }
+
+	switch r := request.(type) {
+	case *protocol.JoinRoomRequest:
+		room(&r.Room)
+	case *protocol.LeaveRoomRequest:
+		room(&r.Room)
+	case *protocol.ListRoomsRequest:
+		user(&r.User)
+	case *protocol.ListUsersRequest:
+		room(&r.Room)
+	case *protocol.MessageRoomRequest:
+		room(&r.Room)
+	case *protocol.MessageUserRequest:
+		user(&r.User)
+	case *protocol.BlockRequest:
+		user(&r.User)
+	case *protocol.UnblockRequest:
+		user(&r.User)
+	case *protocol.SetRoomOptionRequest:
+		room(&r.Room)
+	case *protocol.TypingRequest:
+		room(&r.Room)
+		user(&r.User)
+	case *protocol.MarkReadRequest:
+		room(&r.Room)
+	case *protocol.SearchMessagesRequest:
+		room(&r.Room)
+	case *protocol.SetTopicRequest:
+		room(&r.Room)
+	case *protocol.ListRoomsPageRequest:
+		user(&r.User)
+	case *protocol.ListUsersPageRequest:
+		room(&r.Room)
+	case *protocol.AnnounceRequest:
+		for i := range r.Rooms {
+			room(&r.Rooms[i])
+		}
+	case *protocol.ScheduleMessageRequest:
+		room(&r.Room)
+	case *protocol.SetRetentionRequest:
+		room(&r.Room)
+	case *protocol.DescribeRoomRequest:
+		room(&r.Room)
+	}
+}
+
+// lookalike returns an existing name that the policy considers confusable with name, or the empty string.
+// The ignored name, such as the current name of a user that is changing name, is never returned.
+func lookalike[T any](policy NamePolicy, name string, existing map[string]T, ignored ...string) string {
+	skeleton := policy.Skeleton(name)
+	if skeleton == "" {
+		return ""
+	}
+
+	for other := range existing {
+		if other != name && !contains(ignored, other) && policy.Skeleton(other) == skeleton {
+			return other
+		}
+	}
+	return ""
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/mnxn/chat/generic"
+)
+
+var nameRulesTests = []struct {
+	name     string
+	expected string
+	valid    bool
+}{
+	{"alice", "alice", true},
+	{"\u00c5lice", "\u00c5lice", true},
+	{"A\u030alice", "\u00c5lice", true}, // combining ring above is normalized
+	{"", "", false},
+	{"with space", "", false},
+	{"new\nline", "", false},
+	{"zero\u200bwidth", "", false},
+	{"esc\x1b[31m", "", false},
+	{"abcdefghijklmnopqrstuvwxyz0123456789", "", false},
+	{"admin", "", false},
+	{"AdMin", "", false},
+	{"\u0430dmin", "", false}, // Cyrillic a
+}
+
+func TestNameRulesValidate(t *testing.T) {
+	t.Parallel()
+
+	rules := DefaultNameRules()
+	rules.Reserved = []string{"admin"}
+
+	for i := range nameRulesTests {
+		test := nameRulesTests[i]
+		t.Run("Validate", func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := rules.Validate(test.name)
+			generic.TestEqual(t, "valid", test.name, test.valid, err == nil)
+			generic.TestEqual(t, "validate", test.name, test.expected, actual)
+		})
+	}
+}
+
+var skeletonTests = []struct {
+	a, b  string
+	equal bool
+}{
+	{"alice", "ALICE", true},
+	{"alice", "\u0430lice", true}, // Cyrillic a
+	{"bob", "b0b", true},
+	{"bill", "bi1l", true},
+	{"modern", "modem", true},
+	{"caf\u00e9", "cafe", true},
+	{"alice", "bob", false},
+	{"ann", "anna", false},
+}
+
+func TestSkeleton(t *testing.T) {
+	t.Parallel()
+
+	for i := range skeletonTests {
+		test := skeletonTests[i]
+		t.Run("skeleton", func(t *testing.T) {
+			t.Parallel()
+
+			actual := skeleton(test.a) == skeleton(test.b)
+			generic.TestEqual(t, "skeleton", [2]string{test.a, test.b}, test.equal, actual)
+		})
+	}
+}
+
+func TestLookalike(t *testing.T) {
+	t.Parallel()
+
+	existing := map[string]struct{}{"alice": {}, "bob": {}}
+	rules := DefaultNameRules()
+
+	generic.TestEqual(t, "lookalike", "ALICE", "alice", lookalike[struct{}](rules, "ALICE", existing))
+	generic.TestEqual(t, "lookalike", "carol", "", lookalike[struct{}](rules, "carol", existing))
+
+	rules.Confusables = false
+	generic.TestEqual(t, "lookalike", "ALICE", "", lookalike[struct{}](rules, "ALICE", existing))
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+// How often the history is compacted.
+const compactInterval = time.Minute
+
+// Retention limits the messages of each room and direct conversation that the history keeps. Zero means unlimited.
+type Retention struct {
+	MaxAgeDays  int `json:"max_age_days"` // The number of days that messages are kept.
+	MaxMessages int `json:"max_messages"` // The number of the latest messages of each room or conversation that are kept.
+	MaxBytes    int `json:"max_bytes"`    // The number of bytes of text of the latest messages of each room or conversation that are kept.
+}
+
+func (r Retention) check() error {
+	if r.MaxAgeDays < 0 || r.MaxMessages < 0 || r.MaxBytes < 0 {
+		return errors.New("limits cannot be negative")
+	}
+	if r.MaxAgeDays > math.MaxUint32/(24*60*60) || r.MaxMessages > math.MaxUint32 || r.MaxBytes > math.MaxUint32 {
+		return errors.New("limits are too large")
+	}
+	return nil
+}
+
+// limits returns the retention in the units of the protocol.
+func (r Retention) limits() protocol.Retention {
+	return protocol.Retention{
+		MaxAge:      uint32(r.MaxAgeDays) * 24 * 60 * 60,
+		MaxMessages: uint32(r.MaxMessages),
+		MaxBytes:    uint32(r.MaxBytes),
+	}
+}
+
+// stricter returns the smaller of each pair of limits, where zero is unlimited.
+func stricter(a, b protocol.Retention) protocol.Retention {
+	smaller := func(x, y uint32) uint32 {
+		if x == 0 || (y != 0 && y < x) {
+			return y
+		}
+		return x
+	}
+	return protocol.Retention{
+		MaxAge:      smaller(a.MaxAge, b.MaxAge),
+		MaxMessages: smaller(a.MaxMessages, b.MaxMessages),
+		MaxBytes:    smaller(a.MaxBytes, b.MaxBytes),
+	}
+}
+
+// retention returns the retention that the server enforces for a room.
+// Rooms that no longer exist only have the server-wide retention.
+func (s *Server) retention(roomName string) protocol.Retention {
+	limits := s.config.Retention.limits()
+
+	s.roomsMutex.RLock()
+	room, ok := s.rooms[roomName]
+	s.roomsMutex.RUnlock()
+	if !ok {
+		return limits
+	}
+
+	room.optionsMutex.RLock()
+	defer room.optionsMutex.RUnlock()
+	return stricter(room.retention, limits)
+}
+
+// compactPeriodically compacts the history every compactInterval.
+func (s *Server) compactPeriodically() {
+	ticker := time.NewTicker(compactInterval)
+	defer ticker.Stop()
+
+	for {
+		s.compactHistory()
+		<-ticker.C
+	}
+}
+
+// compactHistory deletes the room messages that exceed the retention of their rooms
+// and the direct messages that exceed the server-wide retention.
+func (s *Server) compactHistory() {
+	// The retention is looked up before locking the history because the history mutex is always locked last.
+	rooms := s.history.roomNames()
+	retention := make(map[string]protocol.Retention, len(rooms))
+	for _, roomName := range rooms {
+		retention[roomName] = s.retention(roomName)
+	}
+
+	removed, err := s.history.compact(time.Now(), retention, s.config.Retention.limits())
+	if err != nil {
+		s.logger.Printf("error compacting history: %s\n", err)
+	}
+	if removed > 0 {
+		s.logger.Printf("history compacted: %d messages removed\n", removed)
+	}
+}
+
+// roomNames returns the names of the rooms that have messages in the history.
+func (h *history) roomNames() []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return sortedKeys(h.rooms)
+}
+
+// compact deletes the room messages that exceed the retention of their room and the direct messages
+// that exceed the direct retention in their conversation, and rewrites the log without them.
+// Rooms without a retention are unlimited. It returns the number of deleted messages.
+func (h *history) compact(now time.Time, retention map[string]protocol.Retention, direct protocol.Retention) (int, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	removed := 0
+	if direct != (protocol.Retention{MaxAge: 0, MaxMessages: 0, MaxBytes: 0}) {
+		for _, messages := range h.conversations() {
+			n := expired(messages, direct, now)
+			for _, m := range messages[:n] {
+				h.prune(m)
+			}
+			removed += n
+		}
+	}
+
+	for room, messages := range h.rooms {
+		n := expired(messages, retention[room], now)
+		if n == 0 {
+			continue
+		}
+
+		for _, m := range messages[:n] {
+			h.prune(m)
+		}
+		if n == len(messages) {
+			delete(h.rooms, room)
+		} else {
+			h.rooms[room] = append([]*message(nil), messages[n:]...)
+		}
+		removed += n
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, h.rewrite()
+}
+
+// conversations returns the direct messages between each pair of users in the order they were sent.
+// The caller must hold the mutex.
+func (h *history) conversations() map[string][]*message {
+	conversations := make(map[string][]*message)
+	for _, m := range h.messages {
+		if m.Room != "" {
+			continue
+		}
+		key := m.Sender + "\x00" + m.Recipient
+		if m.Recipient < m.Sender {
+			key = m.Recipient + "\x00" + m.Sender
+		}
+		conversations[key] = append(conversations[key], m)
+	}
+
+	for _, messages := range conversations {
+		sort.Slice(messages, func(i, j int) bool {
+			return messages[i].ID < messages[j].ID
+		})
+	}
+	return conversations
+}
+
+// expired returns the number of messages at the start of a room's or conversation's messages that exceed the retention.
+func expired(messages []*message, retention protocol.Retention, now time.Time) int {
+	n := 0
+	if limit := int(retention.MaxMessages); limit > 0 && len(messages) > limit {
+		n = len(messages) - limit
+	}
+	if retention.MaxAge > 0 {
+		cutoff := now.Add(-time.Duration(retention.MaxAge) * time.Second)
+		i := sort.Search(len(messages), func(i int) bool {
+			return messages[i].Time.After(cutoff)
+		})
+		if i > n {
+			n = i
+		}
+	}
+	if limit := int(retention.MaxBytes); limit > 0 {
+		bytes := 0
+		for i := len(messages) - 1; i >= n; i-- {
+			bytes += len(messages[i].Text)
+			if bytes > limit {
+				n = i + 1
+				break
+			}
+		}
+	}
+	return n
+}
+
+// prune removes a message from the maps of the history. The caller must hold the mutex
+// and remove a room message from the messages of its room.
+func (h *history) prune(m *message) {
+	h.unindex(m)
+	delete(h.messages, m.ID)
+	delete(h.replies, m.ID)
+
+	if m.ReplyTo == 0 {
+		return
+	}
+	siblings := h.replies[m.ReplyTo][:0]
+	for _, reply := range h.replies[m.ReplyTo] {
+		if reply != m {
+			siblings = append(siblings, reply)
+		}
+	}
+	if len(siblings) == 0 {
+		delete(h.replies, m.ReplyTo)
+	} else {
+		h.replies[m.ReplyTo] = siblings
+	}
+}
+
+// rewrite replaces the log with an entry for the last ID and an entry for each message,
+// so that edits and removed messages no longer take up space. The caller must hold the mutex.
+func (h *history) rewrite() error {
+	if h.file == nil {
+		return nil
+	}
+	path := h.file.Name()
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating history: %w", err)
+	}
+
+	ids := make([]protocol.MessageID, 0, len(h.messages))
+	for id := range h.messages {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	writer := bufio.NewWriter(temp)
+	encoder := json.NewEncoder(writer)
+	err = encoder.Encode(historyEntry{
+		Message:  nil,
+		Edit:     0,
+		Delete:   0,
+		React:    0,
+		Unreact:  0,
+		Deliver:  0,
+		Read:     0,
+		LastID:   h.lastID,
+		Time:     nil,
+		Text:     "",
+		User:     "",
+		Reaction: "",
+		Purge:    "",
+	})
+	for i := 0; err == nil && i < len(ids); i++ {
+		err = encoder.Encode(historyEntry{
+			Message:  h.messages[ids[i]],
+			Edit:     0,
+			Delete:   0,
+			React:    0,
+			Unreact:  0,
+			Deliver:  0,
+			Read:     0,
+			LastID:   0,
+			Time:     nil,
+			Text:     "",
+			User:     "",
+			Reaction: "",
+			Purge:    "",
+		})
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return fmt.Errorf("error writing history: %w", err)
+	}
+
+	// The new file is appended to from now on. Nothing else writes to it, so it does not need O_APPEND.
+	h.file.Close()
+	h.file = temp
+	return nil
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mnxn/chat/generic"
+	"github.com/mnxn/chat/protocol"
+)
+
+// testMessage returns a room message that has not been added to a history.
+func testMessage(room, sender, text string) *message {
+	return &message{
+		ID:        0,
+		Time:      time.Time{},
+		ReplyTo:   0,
+		Room:      room,
+		Sender:    sender,
+		Recipient: "",
+		Text:      text,
+
+		Account:          0,
+		RecipientAccount: 0,
+		Dropped:          false,
+		Edited:           nil,
+		Deleted:          false,
+		Reactions:        nil,
+		Delivered:        false,
+		Read:             false,
+
+		author:    nil,
+		recipient: nil,
+	}
+}
+
+func TestExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	messages := make([]*message, 5)
+	for i := range messages {
+		messages[i] = testMessage("general", "alice", "abcd")
+		messages[i].ID = protocol.MessageID(i + 1)
+		messages[i].Time = now.Add(time.Duration(i-len(messages)) * time.Hour)
+	}
+
+	tests := []struct {
+		retention protocol.Retention
+		expired   int
+	}{
+		{protocol.Retention{MaxAge: 0, MaxMessages: 0, MaxBytes: 0}, 0},
+		{protocol.Retention{MaxAge: 0, MaxMessages: 3, MaxBytes: 0}, 2},
+		{protocol.Retention{MaxAge: 0, MaxMessages: 10, MaxBytes: 0}, 0},
+		{protocol.Retention{MaxAge: 150 * 60, MaxMessages: 0, MaxBytes: 0}, 3},
+		{protocol.Retention{MaxAge: 0, MaxMessages: 0, MaxBytes: 10}, 3},
+		{protocol.Retention{MaxAge: 0, MaxMessages: 4, MaxBytes: 12}, 2},
+		{protocol.Retention{MaxAge: 60, MaxMessages: 0, MaxBytes: 0}, 5},
+	}
+	for i := range tests {
+		test := tests[i]
+		t.Run("expired", func(t *testing.T) {
+			t.Parallel()
+
+			generic.TestEqual(t, "expired", test.retention, test.expired, expired(messages, test.retention, now))
+		})
+	}
+}
+
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := openHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		err = h.add(testMessage("general", "alice", fmt.Sprintf("message %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = h.edit(4, "edited")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := h.compact(time.Now(), map[string]protocol.Retention{
+		"general": {MaxAge: 0, MaxMessages: 2, MaxBytes: 0},
+	}, protocol.Retention{MaxAge: 0, MaxMessages: 0, MaxBytes: 0})
+	generic.TestEqual(t, "compact", path, nil, err)
+	generic.TestEqual(t, "compact", path, 3, removed)
+
+	// Messages that are added after compacting are appended to the new log.
+	err = h.add(testMessage("random", "bob", "hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.file.Close()
+
+	reopened, err := openHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.file.Close()
+
+	_, ok := reopened.get(3)
+	generic.TestEqual(t, "get", 3, false, ok)
+	m, _ := reopened.get(4)
+	generic.TestEqual(t, "get", 4, "edited", m.Text)
+	generic.TestEqual(t, "lastID", path, protocol.MessageID(6), reopened.lastID)
+	generic.TestEqual(t, "search", "message", map[protocol.MessageID]struct{}{5: {}}, reopened.terms["message"])
+
+	// The last ID is kept even if every message is removed.
+	_, err = reopened.compact(time.Now().Add(time.Minute), map[string]protocol.Retention{
+		"general": {MaxAge: 1, MaxMessages: 0, MaxBytes: 0},
+		"random":  {MaxAge: 1, MaxMessages: 0, MaxBytes: 0},
+	}, protocol.Retention{MaxAge: 0, MaxMessages: 0, MaxBytes: 0})
+	generic.TestEqual(t, "compact", path, nil, err)
+	reopened.file.Close()
+
+	empty, err := openHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.file.Close()
+	generic.TestEqual(t, "lastID", path, protocol.MessageID(6), empty.lastID)
+	generic.TestEqual(t, "messages", path, 0, len(empty.messages))
+}
+
+func TestCompactDirect(t *testing.T) {
+	t.Parallel()
+
+	h, err := openHistory("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	direct := func(sender, recipient string) *message {
+		m := testMessage("", sender, "hi")
+		m.Recipient = recipient
+		return m
+	}
+	for _, m := range []*message{
+		direct("alice", "bob"),
+		direct("bob", "alice"),
+		testMessage("general", "alice", "hello"),
+		direct("alice", "carol"),
+		direct("alice", "bob"),
+		direct("carol", "alice"),
+	} {
+		err = h.add(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The server-wide retention applies to each conversation, and rooms without a retention are unlimited.
+	removed, err := h.compact(time.Now(), map[string]protocol.Retention{},
+		protocol.Retention{MaxAge: 0, MaxMessages: 2, MaxBytes: 0})
+	generic.TestEqual(t, "compact", "direct", nil, err)
+	generic.TestEqual(t, "compact", "direct", 1, removed)
+
+	for id := protocol.MessageID(1); id <= 6; id++ {
+		_, ok := h.get(id)
+		generic.TestEqual(t, "get", id, id != 1, ok)
+	}
+}
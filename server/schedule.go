@@ -0,0 +1,340 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+const (
+	maxScheduled     = 20                 // The number of chat messages and announcements that a user can schedule at once.
+	maxScheduleDelay = 7 * 24 * time.Hour // How far ahead a chat message or announcement can be scheduled.
+)
+
+// scheduled is a chat message or announcement that the server sends later on behalf of a user.
+type scheduled struct {
+	item  scheduledItem
+	guest *user // The guest that scheduled the item, or nil if an account scheduled it.
+	timer *time.Timer
+}
+
+// A scheduledItem is what the server needs to send a scheduled chat message or announcement.
+// The items of accounts are kept in the store so that they are sent after the user disconnects or the server restarts.
+type scheduledItem struct {
+	ID           uint32    `json:"id"`
+	Account      uint64    `json:"account,omitempty"` // The account that scheduled the item, or zero for a guest.
+	At           time.Time `json:"at"`
+	Announcement bool      `json:"announcement,omitempty"`
+	Rooms        []string  `json:"rooms"` // The room of a chat message, or the rooms of an announcement.
+	Text         string    `json:"text"`
+}
+
+// ownedBy reports whether u scheduled the item.
+func (item *scheduled) ownedBy(u *user) bool {
+	if item.guest != nil {
+		return item.guest == u
+	}
+	return item.item.Account == u.account.Load()
+}
+
+// schedule sends the item at its time on behalf of owner and returns the ID of the item.
+// It reports false if the owner already has the maximum number of scheduled items.
+func (s *Server) schedule(owner *user, item scheduledItem) (uint32, bool) {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	count := 0
+	for _, other := range s.scheduled {
+		if other.ownedBy(owner) {
+			count++
+		}
+	}
+	if count >= maxScheduled {
+		return 0, false
+	}
+
+	item.ID = s.store.nextScheduledID()
+	item.Account = owner.account.Load()
+	var guest *user
+	if item.Account == 0 {
+		guest = owner
+	} else {
+		err := s.store.addScheduled(item)
+		if err != nil {
+			s.logger.Printf("error saving scheduled item %d: %s\n", item.ID, err)
+		}
+	}
+	s.startScheduled(item, guest)
+	return item.ID, true
+}
+
+// startScheduled starts the timer of an item. The caller must hold the schedule mutex.
+func (s *Server) startScheduled(item scheduledItem, guest *user) {
+	entry := &scheduled{
+		item:  item,
+		guest: guest,
+		timer: nil,
+	}
+	// The timer cannot remove the item before it is added because the mutex is held.
+	entry.timer = time.AfterFunc(time.Until(item.At), func() {
+		s.scheduleMutex.Lock()
+		_, ok := s.scheduled[item.ID]
+		delete(s.scheduled, item.ID)
+		s.scheduleMutex.Unlock()
+
+		if ok {
+			s.forgetScheduled(item)
+			s.sendScheduled(item, guest)
+		}
+	})
+	s.scheduled[item.ID] = entry
+}
+
+// resumeScheduled starts the items that accounts scheduled before the server restarted.
+// Chat messages to rooms that did not outlive the restart are dropped.
+func (s *Server) resumeScheduled() {
+	for _, item := range s.store.scheduled() {
+		if !item.Announcement {
+			s.roomsMutex.RLock()
+			_, ok := s.rooms[item.Rooms[0]]
+			s.roomsMutex.RUnlock()
+			if !ok {
+				s.forgetScheduled(item)
+				continue
+			}
+		}
+
+		s.scheduleMutex.Lock()
+		s.startScheduled(item, nil)
+		s.scheduleMutex.Unlock()
+	}
+}
+
+// forgetScheduled removes an item of an account from the store.
+func (s *Server) forgetScheduled(item scheduledItem) {
+	if item.Account == 0 {
+		return
+	}
+	err := s.store.removeScheduled(item.ID)
+	if err != nil {
+		s.logger.Printf("error saving scheduled item %d: %s\n", item.ID, err)
+	}
+}
+
+// sendScheduled sends an item on behalf of the user that scheduled it, who may be offline if it is an account.
+func (s *Server) sendScheduled(item scheduledItem, guest *user) {
+	sender, online := guest, true
+	if sender == nil {
+		sender, online = s.accountUser(item.Account)
+	}
+	if sender == nil {
+		s.logger.Printf("dropped scheduled item %d of a missing account\n", item.ID)
+		return
+	}
+
+	if !item.Announcement {
+		s.postScheduled(sender, online, item.Rooms[0], item.Text)
+		return
+	}
+	if !s.isAdmin(sender) {
+		s.logger.Printf("dropped scheduled announcement from %s\n", sender.name())
+		return
+	}
+	s.announce(sender, item.Rooms, item.Text)
+}
+
+// accountUser returns the connected user of an account, or a user that stands in for the account while it is offline.
+// It reports whether the user is connected.
+func (s *Server) accountUser(id uint64) (*user, bool) {
+	s.usersMutex.RLock()
+	for _, u := range s.users {
+		if u.account.Load() == id {
+			s.usersMutex.RUnlock()
+			return u, true
+		}
+	}
+	s.usersMutex.RUnlock()
+
+	name, ok := s.store.accountName(id)
+	if !ok {
+		return nil, false
+	}
+	return newUser(name, id, newBlockList()), false
+}
+
+// cancelScheduled stops every scheduled item of a guest.
+// The items of accounts are still sent after their users disconnect.
+func (s *Server) cancelScheduled(guest *user) {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	for id, item := range s.scheduled {
+		if item.guest == guest {
+			item.timer.Stop()
+			delete(s.scheduled, id)
+		}
+	}
+}
+
+// cancelRoomScheduled stops the scheduled chat messages to a room that was removed,
+// so that they are not sent to a new room with the same name.
+func (s *Server) cancelRoomScheduled(roomName string) {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	for id, item := range s.scheduled {
+		if !item.item.Announcement && item.item.Rooms[0] == roomName {
+			item.timer.Stop()
+			delete(s.scheduled, id)
+			s.forgetScheduled(item.item)
+		}
+	}
+}
+
+// scheduledBy returns the items that u scheduled in the order they are sent.
+func (s *Server) scheduledBy(u *user) []protocol.ScheduledItem {
+	s.scheduleMutex.Lock()
+	items := make([]protocol.ScheduledItem, 0, maxScheduled)
+	for _, item := range s.scheduled {
+		if item.ownedBy(u) {
+			items = append(items, protocol.ScheduledItem{
+				ID:           item.item.ID,
+				At:           item.item.At,
+				Announcement: item.item.Announcement,
+				Count:        uint32(len(item.item.Rooms)),
+				Rooms:        item.item.Rooms,
+				Text:         item.item.Text,
+			})
+		}
+	}
+	s.scheduleMutex.Unlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].At.Equal(items[j].At) {
+			return items[i].At.Before(items[j].At)
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items
+}
+
+// unschedule stops an item that u scheduled. It reports false if u has no item with the ID.
+func (s *Server) unschedule(u *user, id uint32) bool {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+
+	item, ok := s.scheduled[id]
+	if !ok || !item.ownedBy(u) {
+		return false
+	}
+	item.timer.Stop()
+	delete(s.scheduled, id)
+	s.forgetScheduled(item.item)
+	return true
+}
+
+// checkSchedule responds with an error if a chat message or announcement cannot be scheduled at the given time.
+func (cu *connectedUser) checkSchedule(at time.Time) bool {
+	if at.After(time.Now().Add(maxScheduleDelay)) {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.LimitReached,
+			Info:  "messages can be scheduled at most 7 days ahead",
+		}
+		return false
+	}
+	return true
+}
+
+// scheduleLater schedules an item for the client user and responds with a ScheduledResponse.
+func (cu *connectedUser) scheduleLater(item scheduledItem) {
+	id, ok := cu.server.schedule(cu.identity(), item)
+	if !ok {
+		cu.outgoing <- &protocol.ErrorResponse{
+			Error: protocol.LimitReached,
+			Info:  "too many scheduled messages",
+		}
+		return
+	}
+
+	cu.outgoing <- &protocol.ScheduledResponse{
+		ID: id,
+		At: item.At,
+	}
+}
+
+// postScheduled sends a scheduled chat message if the room still exists and a connected sender can still post to it.
+// An offline sender is no longer a member of the room, so only the room is checked.
+func (s *Server) postScheduled(sender *user, online bool, roomName, text string) {
+	s.roomsMutex.RLock()
+	room, ok := s.rooms[roomName]
+	s.roomsMutex.RUnlock()
+	if !ok || (online && !room.accepts(sender.name())) {
+		s.logger.Printf("dropped scheduled message from %s to %s\n", sender.name(), roomName)
+		return
+	}
+
+	s.relayRoomMessage(sender, roomName, room, text, 0)
+}
+
+// announce sends an announcement from sender to the members of the rooms, or to every connected user.
+func (s *Server) announce(sender *user, roomNames []string, text string) {
+	now := time.Now()
+
+	if len(roomNames) == 0 {
+		full := &protocol.AnnouncementResponse{
+			Sender: sender.name(),
+			Room:   "",
+			Text:   text,
+			Time:   now,
+		}
+		legacy := &protocol.UserMessageResponse{
+			Sender: sender.name(),
+			Text:   text,
+		}
+
+		s.usersMutex.RLock()
+		for _, u := range s.users {
+			u.each(announcement(full, legacy))
+		}
+		s.usersMutex.RUnlock()
+		return
+	}
+
+	for _, roomName := range roomNames {
+		s.roomsMutex.RLock()
+		room, ok := s.rooms[roomName]
+		s.roomsMutex.RUnlock()
+		if !ok {
+			continue
+		}
+
+		full := &protocol.AnnouncementResponse{
+			Sender: sender.name(),
+			Room:   roomName,
+			Text:   text,
+			Time:   now,
+		}
+		legacy := &protocol.RoomMessageResponse{
+			Room:   roomName,
+			Sender: sender.name(),
+			Text:   text,
+		}
+
+		room.usersMutex.RLock()
+		for _, u := range room.users {
+			u.each(announcement(full, legacy))
+		}
+		room.usersMutex.RUnlock()
+	}
+}
+
+// announcement chooses the AnnouncementResponse for sessions that use Version2 and the legacy response for other sessions.
+func announcement(full *protocol.AnnouncementResponse, legacy protocol.ServerResponse) func(*session) protocol.ServerResponse {
+	return func(s *session) protocol.ServerResponse {
+		if s.uses(protocol.Version2) {
+			return full
+		}
+		return legacy
+	}
+}
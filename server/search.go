@@ -0,0 +1,135 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+const (
+	defaultSearchResults = 20 // The number of search results when the client does not set a limit.
+	maxSearchResults     = 100
+)
+
+// searchQuery selects the room messages returned by history.search.
+type searchQuery struct {
+	terms  []string            // Every term must appear in a matching message.
+	rooms  map[string]struct{} // The rooms to search in.
+	sender string              // Empty to match every sender.
+	after  time.Time           // The zero time for no lower bound.
+	before time.Time           // The zero time for no upper bound.
+	cursor protocol.MessageID  // Only messages with a lower ID match. Zero to start at the newest message.
+	limit  int
+}
+
+// searchTerms splits text into lower case words for the search index.
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	terms := words[:0]
+	seen := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		if _, ok := seen[word]; !ok {
+			seen[word] = struct{}{}
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// index adds a room message to the search index. The caller must hold the mutex.
+func (h *history) index(m *message) {
+	if m.Room == "" || m.Deleted {
+		return
+	}
+
+	for _, term := range searchTerms(m.Text) {
+		ids, ok := h.terms[term]
+		if !ok {
+			ids = make(map[protocol.MessageID]struct{})
+			h.terms[term] = ids
+		}
+		ids[m.ID] = struct{}{}
+	}
+}
+
+// unindex removes a room message from the search index. The caller must hold the mutex.
+func (h *history) unindex(m *message) {
+	if m.Room == "" {
+		return
+	}
+
+	for _, term := range searchTerms(m.Text) {
+		ids := h.terms[term]
+		delete(ids, m.ID)
+		if len(ids) == 0 {
+			delete(h.terms, term)
+		}
+	}
+}
+
+// search returns copies of the room messages that match the query from newest to oldest,
+// and the cursor for the next page of results, or zero if there are no more results.
+func (h *history) search(query searchQuery) ([]message, protocol.MessageID) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	var candidates []*message
+	if len(query.terms) > 0 {
+		// Check the IDs of the least common term against the other terms.
+		sort.Slice(query.terms, func(i, j int) bool {
+			return len(h.terms[query.terms[i]]) < len(h.terms[query.terms[j]])
+		})
+	outer:
+		for id := range h.terms[query.terms[0]] {
+			for _, term := range query.terms[1:] {
+				if _, ok := h.terms[term][id]; !ok {
+					continue outer
+				}
+			}
+			candidates = append(candidates, h.messages[id])
+		}
+	} else {
+		for room := range query.rooms {
+			candidates = append(candidates, h.rooms[room]...)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ID > candidates[j].ID
+	})
+
+	var results []message
+	for _, m := range candidates {
+		if !query.matches(m) {
+			continue
+		}
+		if len(results) == query.limit {
+			return results, results[len(results)-1].ID
+		}
+		results = append(results, *m)
+	}
+	return results, 0
+}
+
+// matches reports whether a message satisfies the filters of the query other than its terms.
+func (query *searchQuery) matches(m *message) bool {
+	if _, ok := query.rooms[m.Room]; !ok || m.Deleted {
+		return false
+	}
+	if query.sender != "" && m.Sender != query.sender {
+		return false
+	}
+	if query.cursor != 0 && m.ID >= query.cursor {
+		return false
+	}
+	if !query.after.IsZero() && !m.Time.After(query.after) {
+		return false
+	}
+	return query.before.IsZero() || m.Time.Before(query.before)
+}
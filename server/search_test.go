@@ -0,0 +1,32 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/mnxn/chat/generic"
+)
+
+var searchTermsTests = []struct {
+	text  string
+	terms []string
+}{
+	{"hello", []string{"hello"}},
+	{"Hello, hello WORLD!", []string{"hello", "world"}},
+	{"lunch @ 12:30", []string{"lunch", "12", "30"}},
+	{"crème brûlée", []string{"crème", "brûlée"}},
+	{"", []string{}},
+	{"?!", []string{}},
+}
+
+func TestSearchTerms(t *testing.T) {
+	t.Parallel()
+
+	for i := range searchTermsTests {
+		test := searchTermsTests[i]
+		t.Run("searchTerms", func(t *testing.T) {
+			t.Parallel()
+
+			generic.TestEqual(t, "searchTerms", test.text, test.terms, searchTerms(test.text))
+		})
+	}
+}
@@ -6,28 +6,84 @@ import (
 	"log"
 	"net"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/mnxn/chat/protocol"
 )
 
 type Server struct {
-	port int
+	config  *Config
+	store   *store
+	history *history
+
+	userNames NamePolicy
+	roomNames NamePolicy
 
 	general *room
 
 	rooms      map[string]*room
 	roomsMutex sync.RWMutex
 
+	subscribers      map[*session]struct{} // The sessions with at least one subscription.
+	subscribersMutex sync.RWMutex
+
+	scheduled     map[uint32]*scheduled // The chat messages and announcements that are sent later, by ID.
+	scheduleMutex sync.Mutex
+
+	started time.Time // When the server was created, for its uptime.
+
 	room
 
 	logger *log.Logger
 }
 
 type room struct {
+	permanent bool      // Whether the server always keeps the room, whatever its lifetime option.
+	created   time.Time // When the room was created.
+
 	users      map[string]*user
 	usersMutex sync.RWMutex
+	joined     bool      // Whether a user has ever joined the room.
+	emptySince time.Time // When the last member left, or the zero time while the room has members.
+
+	operators         map[string]struct{}
+	allowOutsidePosts bool
+	topic             string
+	retention         protocol.Retention // The retention set by the operators, which the server-wide retention can tighten.
+	lifetime          uint32             // One of the values of the Lifetime room option.
+	gracePeriod       time.Duration      // Zero for the server's default grace period.
+	optionsMutex      sync.RWMutex
+}
+
+func newRoom(permanent bool, operators ...string) *room {
+	r := &room{
+		permanent: permanent,
+		created:   time.Now(),
+
+		users:      make(map[string]*user),
+		usersMutex: sync.RWMutex{},
+		joined:     false,
+		emptySince: time.Time{},
+
+		operators:         make(map[string]struct{}),
+		allowOutsidePosts: false,
+		topic:             "",
+		retention: protocol.Retention{
+			MaxAge:      0,
+			MaxMessages: 0,
+			MaxBytes:    0,
+		},
+		lifetime:     protocol.DefaultLifetime,
+		gracePeriod:  0,
+		optionsMutex: sync.RWMutex{},
+	}
+	for _, operator := range operators {
+		r.operators[operator] = struct{}{}
+	}
+	return r
 }
 
 func (r *room) contains(userName string) bool {
@@ -37,40 +93,368 @@ func (r *room) contains(userName string) bool {
 	return ok
 }
 
+func (r *room) isOperator(userName string) bool {
+	r.optionsMutex.RLock()
+	_, ok := r.operators[userName]
+	r.optionsMutex.RUnlock()
+	return ok
+}
+
+// info returns the name, number of members and topic of the room.
+func (r *room) info(roomName string) protocol.RoomInfo {
+	r.usersMutex.RLock()
+	members := len(r.users)
+	r.usersMutex.RUnlock()
+
+	r.optionsMutex.RLock()
+	topic := r.topic
+	r.optionsMutex.RUnlock()
+
+	return protocol.RoomInfo{
+		Name:    roomName,
+		Members: uint32(members),
+		Topic:   topic,
+	}
+}
+
+// accepts reports whether the user can send chat messages to the room.
+func (r *room) accepts(userName string) bool {
+	r.optionsMutex.RLock()
+	allowOutsidePosts := r.allowOutsidePosts
+	r.optionsMutex.RUnlock()
+	return allowOutsidePosts || r.contains(userName)
+}
+
+// The capabilities that the server can enable for a connection.
+const supportedCapabilities = protocol.EchoMessages | protocol.OfflineMessages | protocol.PresenceUpdates |
+	protocol.TypingNotifications | protocol.NameChanges | protocol.MessageIDs | protocol.Receipts
+
+// The minimum time between two typing notifications from a session for the same room or user.
+const typingInterval = 2 * time.Second
+
+// A user is a name on the server with one or more connected sessions.
+// Only registered users can have more than one session.
 type user struct {
 	atomicName atomic.Pointer[string]
-	incoming   chan protocol.ClientRequest
-	outgoing   chan protocol.ServerResponse
+	account    atomic.Uint64 // The ID of the user's account, or zero for a guest.
+
+	sessions      map[*session]struct{}
+	sessionsMutex sync.RWMutex
+
+	blocks     blockList
+	blockMutex sync.RWMutex
+
+	presence        protocol.Presence
+	presenceMessage string
+	presenceMutex   sync.RWMutex
+
+	readMarkers map[string]protocol.MessageID // The last message that the user read in each room.
+	readMutex   sync.Mutex
+
+	lastActive atomic.Int64 // When a session of the user last sent a request other than a keepalive, in Unix nanoseconds.
+}
+
+func newUser(name string, account uint64, blocks blockList) *user {
+	u := &user{
+		atomicName: atomic.Pointer[string]{},
+		account:    atomic.Uint64{},
+
+		sessions:      make(map[*session]struct{}),
+		sessionsMutex: sync.RWMutex{},
+
+		blocks:     blocks,
+		blockMutex: sync.RWMutex{},
+
+		presence:        protocol.Online,
+		presenceMessage: "",
+		presenceMutex:   sync.RWMutex{},
+
+		readMarkers: make(map[string]protocol.MessageID),
+		readMutex:   sync.Mutex{},
+
+		lastActive: atomic.Int64{},
+	}
+	u.atomicName.Store(&name)
+	u.account.Store(account)
+	u.touch()
+	return u
+}
+
+// registered reports whether the user has an account.
+func (u *user) registered() bool {
+	return u.account.Load() != 0
+}
+
+// touch records that the user is active.
+func (u *user) touch() {
+	u.lastActive.Store(time.Now().UnixNano())
+}
+
+// idle returns the number of seconds since the user was last active.
+func (u *user) idle() uint32 {
+	return uint32(time.Since(time.Unix(0, u.lastActive.Load())) / time.Second)
 }
 
 func (u *user) name() string {
 	return *u.atomicName.Load()
 }
 
-func (u *user) connected() bool {
-	return u.name() != ""
+// send delivers the response to every session of the user.
+func (u *user) send(response protocol.ServerResponse) {
+	u.sessionsMutex.RLock()
+	for session := range u.sessions {
+		session.send(response)
+	}
+	u.sessionsMutex.RUnlock()
+}
+
+// echo delivers the response to every session of the user that negotiated EchoMessages.
+func (u *user) echo(response protocol.ServerResponse) {
+	u.notify(protocol.EchoMessages, response)
+}
+
+// notify delivers the response to every session of the user that negotiated the capability.
+func (u *user) notify(capability protocol.Capability, response protocol.ServerResponse) {
+	u.sessionsMutex.RLock()
+	for session := range u.sessions {
+		if session.has(capability) {
+			session.send(response)
+		}
+	}
+	u.sessionsMutex.RUnlock()
+}
+
+// each sends the response that choose returns for each session of the user, unless it is nil.
+func (u *user) each(choose func(*session) protocol.ServerResponse) {
+	u.sessionsMutex.RLock()
+	for session := range u.sessions {
+		if response := choose(session); response != nil {
+			session.send(response)
+		}
+	}
+	u.sessionsMutex.RUnlock()
+}
+
+// chatMessage chooses the ChatMessageResponse for sessions that negotiated MessageIDs
+// and the legacy response for other sessions.
+func chatMessage(full *protocol.ChatMessageResponse, legacy protocol.ServerResponse) func(*session) protocol.ServerResponse {
+	return func(s *session) protocol.ServerResponse {
+		if s.has(protocol.MessageIDs) {
+			return full
+		}
+		return legacy
+	}
+}
+
+// echoMessage is like chatMessage but only chooses a response for sessions that negotiated EchoMessages.
+func echoMessage(full *protocol.ChatMessageResponse, legacy protocol.ServerResponse) func(*session) protocol.ServerResponse {
+	return func(s *session) protocol.ServerResponse {
+		if !s.has(protocol.EchoMessages) {
+			return nil
+		}
+		return chatMessage(full, legacy)(s)
+	}
+}
+
+// status returns the presence and status message of the user.
+func (u *user) status() (protocol.Presence, string) {
+	u.presenceMutex.RLock()
+	defer u.presenceMutex.RUnlock()
+
+	return u.presence, u.presenceMessage
+}
+
+// accepts reports whether the user's block list allows direct messages from sender.
+func (u *user) accepts(sender string) bool {
+	u.blockMutex.RLock()
+	defer u.blockMutex.RUnlock()
+
+	return u.blocks.accepts(sender)
+}
+
+type blockList struct {
+	blocked   map[string]struct{}
+	strangers bool
+	contacts  map[string]struct{}
+}
+
+func newBlockList() blockList {
+	return blockList{
+		blocked:   make(map[string]struct{}),
+		strangers: false,
+		contacts:  make(map[string]struct{}),
+	}
+}
+
+func (b blockList) clone() blockList {
+	c := newBlockList()
+	for user := range b.blocked {
+		c.blocked[user] = struct{}{}
+	}
+	c.strangers = b.strangers
+	for user := range b.contacts {
+		c.contacts[user] = struct{}{}
+	}
+	return c
+}
+
+// rename moves the block and contact entries of a user that changed name.
+func (b blockList) rename(oldName, newName string) {
+	if _, ok := b.blocked[oldName]; ok {
+		delete(b.blocked, oldName)
+		b.blocked[newName] = struct{}{}
+	}
+	if _, ok := b.contacts[oldName]; ok {
+		delete(b.contacts, oldName)
+		b.contacts[newName] = struct{}{}
+	}
+}
+
+func (b blockList) accepts(sender string) bool {
+	if _, ok := b.blocked[sender]; ok {
+		return false
+	}
+	if _, ok := b.contacts[sender]; !ok && b.strangers {
+		return false
+	}
+	return true
+}
+
+// A session is a single client connection.
+type session struct {
+	atomicUser   atomic.Pointer[user]
+	version      atomic.Uint32 // The protocol version from the ConnectRequest or LoginRequest.
+	capabilities atomic.Uint32
+	incoming     chan protocol.ClientRequest
+	outgoing     chan protocol.ServerResponse
+	done         chan struct{}
+
+	typing      map[string]time.Time // The last relayed typing notification for each target.
+	typingMutex sync.Mutex
+
+	subscriptions      []string // The room name patterns that the session subscribed to.
+	subscriptionsMutex sync.RWMutex
+}
+
+// identity returns the user that the session is connected as, or nil before connecting.
+func (s *session) identity() *user {
+	return s.atomicUser.Load()
+}
+
+func (s *session) name() string {
+	if u := s.identity(); u != nil {
+		return u.name()
+	}
+	return ""
+}
+
+func (s *session) connected() bool {
+	return s.identity() != nil
+}
+
+// uses reports whether the session uses at least the protocol version.
+func (s *session) uses(version uint32) bool {
+	return s.version.Load() >= version
+}
+
+func (s *session) has(capability protocol.Capability) bool {
+	return protocol.Capability(s.capabilities.Load()).Has(capability)
+}
+
+// send delivers the response unless the session has already ended.
+func (s *session) send(response protocol.ServerResponse) {
+	select {
+	case s.outgoing <- response:
+	case <-s.done:
+	}
+}
+
+// allowTyping reports whether a typing notification for target can be relayed
+// and records the time if it can.
+func (s *session) allowTyping(target string) bool {
+	s.typingMutex.Lock()
+	defer s.typingMutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.typing[target]) < typingInterval {
+		return false
+	}
+	s.typing[target] = now
+	return true
 }
 
 type connectedUser struct {
-	*user
+	*session
 	server *Server
 	conn   net.Conn
 }
 
-func NewServer(port int, logger *log.Logger) *Server {
-	general := &room{
-		users:      make(map[string]*user),
-		usersMutex: sync.RWMutex{},
+func NewServer(config *Config, logger *log.Logger) (*Server, error) {
+	store, err := openStore(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	history, err := openHistory(config.HistoryFile)
+	if err != nil {
+		return nil, err
+	}
+
+	general := newRoom(true)
+
+	rooms := map[string]*room{"general": general}
+	for _, roomName := range config.DefaultRooms {
+		if _, ok := rooms[roomName]; ok {
+			continue
+		}
+		rooms[roomName] = newRoom(true)
+	}
+
+	for _, name := range config.Admins {
+		err = store.bindAdmin(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The rooms that users created are not kept across restarts, so neither are their messages.
+	for _, roomName := range history.roomNames() {
+		if _, ok := rooms[roomName]; !ok {
+			err = history.purge(roomName)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	userNames, roomNames := config.UserPolicy, config.RoomPolicy
+	if userNames == nil {
+		userNames = config.UserNames
 	}
+	if roomNames == nil {
+		roomNames = config.RoomNames
+	}
+
+	s := &Server{
+		config:  config,
+		store:   store,
+		history: history,
 
-	return &Server{
-		port: port,
+		userNames: userNames,
+		roomNames: roomNames,
 
 		general: general,
 
-		rooms:      map[string]*room{"general": general},
+		rooms:      rooms,
 		roomsMutex: sync.RWMutex{},
 
+		subscribers:      make(map[*session]struct{}),
+		subscribersMutex: sync.RWMutex{},
+
+		scheduled:     make(map[uint32]*scheduled),
+		scheduleMutex: sync.Mutex{},
+
+		started: time.Now(),
+
 		room: room{
 			users:      make(map[string]*user),
 			usersMutex: sync.RWMutex{},
@@ -78,20 +462,45 @@ func NewServer(port int, logger *log.Logger) *Server {
 
 		logger: logger,
 	}
+	s.resumeScheduled()
+	return s, nil
 }
 
 func (s *Server) Run() error {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
-	if err != nil {
-		return fmt.Errorf("error starting tcp server: %w", err)
+	listeners := make([]net.Listener, 0, len(s.config.Listen))
+	for _, address := range s.config.Listen {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return fmt.Errorf("error starting tcp server: %w", err)
+		}
+		defer listener.Close()
+
+		s.logger.Printf("listening on %s\n", listener.Addr())
+		listeners = append(listeners, listener)
 	}
-	defer listener.Close()
 
+	go s.compactPeriodically()
+	go s.sweepPeriodically()
+	go s.flushPeriodically()
+
+	done := make(chan struct{}, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			s.accept(listener)
+			done <- struct{}{}
+		}(listener)
+	}
+	<-done
+
+	return nil
+}
+
+func (s *Server) accept(listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			s.logger.Printf("error accepting connection: %s", err.Error())
-			return nil
+			return
 		}
 
 		go s.handle(conn)
@@ -102,40 +511,41 @@ func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
 
 	cu := &connectedUser{
-		user: &user{
-			atomicName: atomic.Pointer[string]{},
-			incoming:   make(chan protocol.ClientRequest),
-			outgoing:   make(chan protocol.ServerResponse),
+		session: &session{
+			atomicUser:   atomic.Pointer[user]{},
+			version:      atomic.Uint32{},
+			capabilities: atomic.Uint32{},
+			incoming:     make(chan protocol.ClientRequest),
+			outgoing:     make(chan protocol.ServerResponse),
+			done:         make(chan struct{}),
+
+			typing:      make(map[string]time.Time),
+			typingMutex: sync.Mutex{},
+
+			subscriptions:      []string{},
+			subscriptionsMutex: sync.RWMutex{},
 		},
 		server: s,
 		conn:   conn,
 	}
-	cu.atomicName.Store(new(string))
 
-	defer func() {
-		if !cu.connected() {
-			return
-		}
-
-		s.usersMutex.Lock()
-		delete(s.users, cu.name())
-		s.usersMutex.Unlock()
-
-		s.roomsMutex.RLock()
-		for roomName, room := range s.rooms {
-			s.removeRoomUser(roomName, room, cu.user)
-		}
-		s.roomsMutex.RUnlock()
-
-		s.logger.Printf("user removed: %s\n", cu.name())
-	}()
+	defer s.removeSession(cu.session)
+	defer close(cu.done)
 
 	decodeErr := make(chan error)
 	go func() {
-		response, err := protocol.DecodeClientRequest(conn)
+		request, err := protocol.DecodeClientRequest(conn)
 		for err == nil {
-			cu.incoming <- response
-			response, err = protocol.DecodeClientRequest(conn)
+			s.normalizeNames(request)
+			if cu.connected() {
+				cu.incoming <- request
+			} else {
+				// Requests are handled in order until the user is connected
+				// so that requests sent right after a ConnectRequest or LoginRequest are not rejected.
+				s.logger.Printf("received request: %#v\n", request)
+				request.Accept(cu)
+			}
+			request, err = protocol.DecodeClientRequest(conn)
 		}
 		decodeErr <- err
 	}()
@@ -149,9 +559,17 @@ func (s *Server) handle(conn net.Conn) {
 				s.logger.Printf("encode response error: %s\n", err)
 				return
 			}
+			if d, ok := response.(*delivery); ok {
+				// The receipt is sent from another goroutine because the sender's
+				// connection may be waiting to write to this connection as well.
+				go s.receipt(d.id, false)
+			}
 
 		case request := <-cu.incoming:
 			s.logger.Printf("received request from %s: %#v\n", cu.name(), request)
+			if _, ok := request.(*protocol.KeepaliveRequest); !ok {
+				cu.identity().touch()
+			}
 			go request.Accept(cu)
 
 		case err := <-decodeErr:
@@ -163,14 +581,328 @@ func (s *Server) handle(conn net.Conn) {
 	}
 }
 
+// removeRoomUser removes a user from a room. An ephemeral room without a grace period is removed
+// when its last member leaves, and other rooms are left for sweepRooms. The caller must hold the rooms mutex.
 func (s *Server) removeRoomUser(roomName string, room *room, user *user) {
+	lifetime, grace := room.effectiveLifetime(s.config.Rooms)
+
 	room.usersMutex.Lock()
-	_, inRoom := room.users[user.name()]
-	if inRoom && len(room.users) == 1 && room != s.general {
-		delete(s.rooms, roomName)
-		s.logger.Printf("removed room: %s\n", roomName)
-	} else {
+	if room.users[user.name()] == user {
 		delete(room.users, user.name())
+		if len(room.users) == 0 {
+			room.emptySince = time.Now()
+			if lifetime == protocol.EphemeralRoom && grace == 0 {
+				s.removeRoom(roomName)
+			}
+		}
 	}
 	room.usersMutex.Unlock()
 }
+
+// removeRoom removes a room, its messages and the chat messages scheduled for it. The caller must hold
+// the rooms mutex so that the room cannot be created again before they are gone.
+func (s *Server) removeRoom(roomName string) {
+	delete(s.rooms, roomName)
+	s.cancelRoomScheduled(roomName)
+	err := s.history.purge(roomName)
+	if err != nil {
+		s.logger.Printf("error removing messages of room %s: %s\n", roomName, err)
+	}
+	s.logger.Printf("removed room: %s\n", roomName)
+}
+
+// renameUser re-keys the user in the server, in the block lists of connected users
+// and in every room that it has joined or operates.
+// The caller must hold the users mutex.
+func (s *Server) renameUser(u *user, newName string) {
+	oldName := u.name()
+	delete(s.users, oldName)
+	s.users[newName] = u
+	u.atomicName.Store(&newName)
+
+	for _, other := range s.users {
+		other.blockMutex.Lock()
+		other.blocks.rename(oldName, newName)
+		other.blockMutex.Unlock()
+	}
+
+	s.roomsMutex.RLock()
+	for _, room := range s.rooms {
+		room.usersMutex.Lock()
+		if room.users[oldName] == u {
+			delete(room.users, oldName)
+			room.users[newName] = u
+		}
+		room.usersMutex.Unlock()
+
+		room.optionsMutex.Lock()
+		if _, ok := room.operators[oldName]; ok {
+			delete(room.operators, oldName)
+			room.operators[newName] = struct{}{}
+		}
+		room.optionsMutex.Unlock()
+	}
+	s.roomsMutex.RUnlock()
+}
+
+// notifyMessage sends a response about a stored chat message to the sessions that negotiated MessageIDs
+// of its sender and of the room members or the recipient.
+func (s *Server) notifyMessage(m message, response protocol.ServerResponse) {
+	recipients := make(map[*user]struct{})
+
+	s.usersMutex.RLock()
+	if m.author != nil {
+		recipients[m.author] = struct{}{}
+	} else if sender, ok := s.users[m.Sender]; ok {
+		recipients[sender] = struct{}{}
+	}
+	if m.recipient != nil && !m.Dropped {
+		recipients[m.recipient] = struct{}{}
+	} else if recipient, ok := s.users[m.Recipient]; ok && m.Recipient != "" && !m.Dropped {
+		recipients[recipient] = struct{}{}
+	}
+	s.usersMutex.RUnlock()
+
+	if m.Room != "" {
+		s.roomsMutex.RLock()
+		room, ok := s.rooms[m.Room]
+		s.roomsMutex.RUnlock()
+		if ok {
+			room.usersMutex.RLock()
+			for _, user := range room.users {
+				recipients[user] = struct{}{}
+			}
+			room.usersMutex.RUnlock()
+		}
+	}
+
+	for recipient := range recipients {
+		recipient.notify(protocol.MessageIDs, response)
+	}
+}
+
+// A delivery is a direct message to the recipient.
+// The sender receives a receipt once the response has been written to a connection of the recipient.
+type delivery struct {
+	protocol.ServerResponse
+	id protocol.MessageID
+}
+
+// deliver wraps the responses of choose in deliveries of the message with the ID.
+func deliver(id protocol.MessageID, choose func(*session) protocol.ServerResponse) func(*session) protocol.ServerResponse {
+	return func(s *session) protocol.ServerResponse {
+		return &delivery{
+			ServerResponse: choose(s),
+			id:             id,
+		}
+	}
+}
+
+// receipt marks a direct message as delivered or read and tells the sender if its state changed.
+func (s *Server) receipt(id protocol.MessageID, read bool) {
+	m, changed, err := s.history.receipt(id, read)
+	if err != nil {
+		s.logger.Printf("error storing receipt of message %d: %s\n", id, err)
+	}
+	if !changed {
+		return
+	}
+
+	sender := m.author
+	if sender == nil {
+		s.usersMutex.RLock()
+		sender = s.users[m.Sender]
+		s.usersMutex.RUnlock()
+	}
+	if sender != nil && m.sentBy(sender) {
+		sender.notify(protocol.Receipts, &protocol.ReceiptResponse{
+			ID:   m.ID,
+			User: m.Recipient,
+			Read: read,
+		})
+	}
+}
+
+// visible reports whether u can see a stored chat message.
+// Room messages are visible to the members of the room, and direct messages to their sender and recipient.
+func (s *Server) visible(m message, u *user) bool {
+	if m.Room == "" {
+		return m.sentBy(u) || m.receivedBy(u)
+	}
+
+	s.roomsMutex.RLock()
+	room, ok := s.rooms[m.Room]
+	s.roomsMutex.RUnlock()
+	if !ok {
+		return false
+	}
+
+	room.usersMutex.RLock()
+	defer room.usersMutex.RUnlock()
+	return room.users[u.name()] == u
+}
+
+// neighbors returns the users that share a room with u, including u itself.
+func (s *Server) neighbors(u *user) map[*user]struct{} {
+	neighbors := map[*user]struct{}{u: {}}
+
+	s.roomsMutex.RLock()
+	for _, room := range s.rooms {
+		room.usersMutex.RLock()
+		if room.users[u.name()] == u {
+			for _, other := range room.users {
+				neighbors[other] = struct{}{}
+			}
+		}
+		room.usersMutex.RUnlock()
+	}
+	s.roomsMutex.RUnlock()
+
+	return neighbors
+}
+
+// addUser adds a new user with its first session to the server and the general room.
+// The caller must hold the users mutex.
+func (s *Server) addUser(u *user, session *session) {
+	u.sessions[session] = struct{}{}
+	s.users[u.name()] = u
+	session.atomicUser.Store(u)
+
+	s.general.usersMutex.Lock()
+	s.general.users[u.name()] = u
+	s.general.usersMutex.Unlock()
+}
+
+// flushPeriodically writes unwritten changes of the state every flushInterval.
+func (s *Server) flushPeriodically() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := s.store.flush()
+		if err != nil {
+			s.logger.Printf("error saving state: %s\n", err)
+		}
+	}
+}
+
+// Close writes the changes of the state that flushPeriodically has not written yet.
+// It should be called before the program exits.
+func (s *Server) Close() error {
+	return s.store.flush()
+}
+
+// saveBlocks persists the block list of a registered user.
+func (s *Server) saveBlocks(u *user) {
+	if !u.registered() {
+		return
+	}
+
+	u.blockMutex.RLock()
+	blocks := u.blocks.clone()
+	u.blockMutex.RUnlock()
+
+	s.store.setBlocks(u.name(), blocks)
+}
+
+// readMarker returns the read marker of a user for a room.
+// A room without a read marker is considered read up to its last message.
+func (s *Server) readMarker(u *user, roomName string) *protocol.ReadMarkerResponse {
+	u.readMutex.Lock()
+	id, ok := u.readMarkers[roomName]
+	if !ok {
+		id = s.history.last(roomName)
+		u.readMarkers[roomName] = id
+	}
+	u.readMutex.Unlock()
+	if !ok {
+		s.saveReadMarkers(u)
+	}
+
+	return &protocol.ReadMarkerResponse{
+		Room:   roomName,
+		ID:     id,
+		Unread: s.history.unread(roomName, id, u.name()),
+	}
+}
+
+// markRead moves the read marker of a user for a room forward to the message with the ID.
+// It reports whether the read marker moved.
+func (s *Server) markRead(u *user, roomName string, id protocol.MessageID) bool {
+	u.readMutex.Lock()
+	moved := id > u.readMarkers[roomName]
+	if moved {
+		u.readMarkers[roomName] = id
+	}
+	u.readMutex.Unlock()
+
+	if moved {
+		s.saveReadMarkers(u)
+	}
+	return moved
+}
+
+// saveReadMarkers persists the read markers of a registered user.
+func (s *Server) saveReadMarkers(u *user) {
+	if !u.registered() {
+		return
+	}
+
+	u.readMutex.Lock()
+	markers := make(map[string]protocol.MessageID, len(u.readMarkers))
+	for room, id := range u.readMarkers {
+		markers[room] = id
+	}
+	u.readMutex.Unlock()
+
+	s.store.setReadMarkers(u.name(), markers)
+}
+
+// joinedRooms returns the sorted names of the rooms that u has joined.
+func (s *Server) joinedRooms(u *user) []string {
+	var rooms []string
+
+	s.roomsMutex.RLock()
+	for roomName, room := range s.rooms {
+		room.usersMutex.RLock()
+		if room.users[u.name()] == u {
+			rooms = append(rooms, roomName)
+		}
+		room.usersMutex.RUnlock()
+	}
+	s.roomsMutex.RUnlock()
+
+	sort.Strings(rooms)
+	return rooms
+}
+
+// removeSession detaches the session from its user.
+// The user is removed from the server and its rooms when its last session ends.
+func (s *Server) removeSession(session *session) {
+	u := session.identity()
+	if u == nil {
+		return
+	}
+	s.unsubscribe(session, "")
+
+	s.usersMutex.Lock()
+	u.sessionsMutex.Lock()
+	delete(u.sessions, session)
+	remaining := len(u.sessions)
+	u.sessionsMutex.Unlock()
+	if remaining > 0 {
+		s.usersMutex.Unlock()
+		return
+	}
+	delete(s.users, u.name())
+	s.usersMutex.Unlock()
+	s.cancelScheduled(u)
+
+	s.roomsMutex.Lock()
+	for roomName, room := range s.rooms {
+		s.removeRoomUser(roomName, room, u)
+	}
+	s.roomsMutex.Unlock()
+
+	s.logger.Printf("user removed: %s\n", u.name())
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+const testTimeout = time.Second
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	s, err := NewServer(DefaultConfig(), log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.store.cost = bcrypt.MinCost
+	return s
+}
+
+// waitFor polls condition until it is true because the server handles requests concurrently
+// and does not acknowledge every request.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type testClient struct {
+	t            *testing.T
+	name         string
+	server       *Server
+	conn         net.Conn
+	responses    chan protocol.ServerResponse
+	capabilities protocol.Capability
+}
+
+func dialTestClient(t *testing.T, s *Server, name string) *testClient {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+	go s.handle(serverConn)
+	t.Cleanup(func() { clientConn.Close() })
+
+	tc := &testClient{
+		t:            t,
+		name:         name,
+		server:       s,
+		conn:         clientConn,
+		responses:    make(chan protocol.ServerResponse, 16),
+		capabilities: 0,
+	}
+	go func() {
+		defer close(tc.responses)
+		for {
+			response, err := protocol.DecodeServerResponse(clientConn)
+			if err != nil {
+				return
+			}
+			tc.responses <- response
+		}
+	}()
+
+	return tc
+}
+
+func connectTestClient(t *testing.T, s *Server, name string) *testClient {
+	t.Helper()
+
+	tc := dialTestClient(t, s, name)
+	tc.send(&protocol.ConnectRequest{
+		Version: 1,
+		Name:    name,
+	})
+	waitFor(t, func() bool {
+		return s.sessionCount(name) > 0
+	})
+
+	return tc
+}
+
+func loginTestClient(t *testing.T, s *Server, name, password string) *testClient {
+	t.Helper()
+
+	sessions := s.sessionCount(name)
+	tc := dialTestClient(t, s, name)
+	tc.send(&protocol.LoginRequest{
+		Version:  1,
+		Name:     name,
+		Password: password,
+	})
+	waitFor(t, func() bool {
+		return s.sessionCount(name) > sessions
+	})
+
+	return tc
+}
+
+func (tc *testClient) send(request protocol.ClientRequest) {
+	tc.t.Helper()
+
+	err := protocol.EncodeClientRequest(tc.conn, request)
+	if err != nil {
+		tc.t.Fatalf("send %#v: %s", request, err)
+	}
+}
+
+func (tc *testClient) receive() protocol.ServerResponse {
+	tc.t.Helper()
+
+	select {
+	case response, ok := <-tc.responses:
+		if !ok {
+			tc.t.Fatal("connection closed")
+		}
+		return response
+	case <-time.After(testTimeout):
+		tc.t.Fatal("timed out waiting for response")
+		return nil
+	}
+}
+
+// negotiate enables the capabilities and skips the responses to the NegotiateRequest.
+func (tc *testClient) negotiate(capabilities protocol.Capability) {
+	tc.t.Helper()
+
+	tc.send(&protocol.NegotiateRequest{
+		Capabilities: capabilities,
+	})
+	response, ok := tc.receive().(*protocol.CapabilitiesResponse)
+	if !ok {
+		tc.t.Fatalf("expected CapabilitiesResponse, got %#v", response)
+	}
+	tc.capabilities = response.Capabilities
+
+	if tc.capabilities.Has(protocol.MessageIDs) {
+		tc.server.usersMutex.RLock()
+		u := tc.server.users[tc.name]
+		tc.server.usersMutex.RUnlock()
+		for range tc.server.joinedRooms(u) {
+			tc.receive()
+		}
+	}
+}
+
+func (tc *testClient) createRoom(roomName string) {
+	tc.t.Helper()
+
+	tc.send(&protocol.CreateRoomRequest{
+		Room: roomName,
+	})
+	waitFor(tc.t, func() bool {
+		return tc.server.findRoom(roomName) != nil
+	})
+}
+
+func (tc *testClient) joinRoom(roomName string) {
+	tc.t.Helper()
+
+	tc.send(&protocol.JoinRoomRequest{
+		Room: roomName,
+	})
+	waitFor(tc.t, func() bool {
+		room := tc.server.findRoom(roomName)
+		return room != nil && room.contains(tc.name)
+	})
+	if tc.capabilities.Has(protocol.MessageIDs) {
+		tc.receive()
+	}
+}
+
+func (s *Server) findRoom(roomName string) *room {
+	s.roomsMutex.RLock()
+	defer s.roomsMutex.RUnlock()
+
+	return s.rooms[roomName]
+}
+
+func (s *Server) sessionCount(name string) int {
+	s.usersMutex.RLock()
+	u, ok := s.users[name]
+	s.usersMutex.RUnlock()
+	if !ok {
+		return 0
+	}
+
+	u.sessionsMutex.RLock()
+	defer u.sessionsMutex.RUnlock()
+
+	return len(u.sessions)
+}
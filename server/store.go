@@ -0,0 +1,477 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+// bcrypt only uses the first 72 bytes of a password.
+const maxPasswordLength = 72
+
+// How often changes to block lists and read markers are written to the state file.
+const flushInterval = 5 * time.Second
+
+var (
+	errExistingAccount = errors.New("name is already registered")
+	errMissingAccount  = errors.New("name is not registered")
+	errQueueFull       = errors.New("message queue is full")
+)
+
+// store keeps the server state that outlives connections.
+// The state is written to a JSON file unless the path is empty. Accounts and queued messages are written
+// after every change, while frequent changes to block lists and read markers are written by flush.
+type store struct {
+	path  string
+	cost  int // The bcrypt cost of new password hashes.
+	mutex sync.Mutex
+	state storeState
+	dirty bool // Whether the state has changes that have not been written yet.
+}
+
+type storeState struct {
+	Accounts      map[string]*account `json:"accounts"`
+	LastAccountID uint64              `json:"last_account_id"`
+
+	// The ID of the first account registered under each administrator name of the config.
+	// Administrator rights stay with that account when it is renamed, and do not pass to a later account with the name.
+	Admins map[string]uint64 `json:"admins,omitempty"`
+
+	Scheduled       []scheduledItem `json:"scheduled,omitempty"` // The chat messages and announcements that accounts scheduled.
+	LastScheduledID uint32          `json:"last_scheduled_id"`
+}
+
+type account struct {
+	ID             uint64   `json:"id"` // Identifies the account across name changes. IDs are never reused.
+	PasswordHash   []byte   `json:"password_hash"`
+	Blocked        []string `json:"blocked"`
+	BlockStrangers bool     `json:"block_strangers"`
+	Contacts       []string `json:"contacts"`
+
+	Queue []queuedMessage `json:"queue"` // Direct messages received while the user was offline.
+
+	ReadMarkers map[string]protocol.MessageID `json:"read_markers,omitempty"` // The last message read in each room.
+}
+
+type queuedMessage struct {
+	Time   time.Time `json:"time"`
+	Sender string    `json:"sender"`
+	Text   string    `json:"text"`
+}
+
+func openStore(path string) (*store, error) {
+	s := &store{
+		path:  path,
+		cost:  bcrypt.DefaultCost,
+		mutex: sync.Mutex{},
+		state: storeState{
+			Accounts:      make(map[string]*account),
+			LastAccountID: 0,
+
+			Admins: make(map[string]uint64),
+
+			Scheduled:       nil,
+			LastScheduledID: 0,
+		},
+		dirty: false,
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading state: %w", err)
+	}
+
+	err = json.Unmarshal(data, &s.state)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing state %s: %w", path, err)
+	}
+	if s.state.Accounts == nil {
+		s.state.Accounts = make(map[string]*account)
+	}
+	if s.state.Admins == nil {
+		s.state.Admins = make(map[string]uint64)
+	}
+
+	// Accounts from before account IDs are numbered in name order so that they get the same IDs until the next save.
+	for _, name := range sortedKeys(s.state.Accounts) {
+		if a := s.state.Accounts[name]; a.ID == 0 {
+			s.state.LastAccountID++
+			a.ID = s.state.LastAccountID
+		}
+	}
+
+	return s, nil
+}
+
+// save writes the state to the store's file. The caller must hold the mutex.
+func (s *store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(&s.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0o755)
+	if err != nil {
+		return fmt.Errorf("error creating state directory: %w", err)
+	}
+
+	temp := s.path + ".tmp"
+	err = os.WriteFile(temp, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("error writing state: %w", err)
+	}
+
+	err = os.Rename(temp, s.path)
+	if err != nil {
+		return fmt.Errorf("error replacing state: %w", err)
+	}
+
+	s.dirty = false
+	return nil
+}
+
+// flush writes the state to the store's file if it has unwritten changes.
+func (s *store) flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+func (s *store) registered(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.state.Accounts[name]
+	return ok
+}
+
+// lookalike returns a registered name that the policy considers confusable with name, or the empty string.
+func (s *store) lookalike(policy NamePolicy, name string, ignored ...string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return lookalike(policy, name, s.state.Accounts, ignored...)
+}
+
+// rename moves the account of a registered user, if there is one, and the block lists of accounts to a new name.
+func (s *store) rename(oldName, newName string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a, ok := s.state.Accounts[oldName]
+	if ok {
+		if _, ok := s.state.Accounts[newName]; ok {
+			return errExistingAccount
+		}
+		delete(s.state.Accounts, oldName)
+		s.state.Accounts[newName] = a
+	}
+
+	// The blocks and contacts of other accounts follow the user to the new name.
+	changed := ok
+	for _, other := range s.state.Accounts {
+		blocked := renameIn(other.Blocked, oldName, newName)
+		contact := renameIn(other.Contacts, oldName, newName)
+		changed = changed || blocked || contact
+	}
+	if !changed {
+		return nil
+	}
+
+	return s.save()
+}
+
+// renameIn replaces oldName with newName in names and reports whether it was found.
+func renameIn(names []string, oldName, newName string) bool {
+	found := false
+	for i, name := range names {
+		if name == oldName {
+			names[i] = newName
+			found = true
+		}
+	}
+	return found
+}
+
+// register creates an account for name that keeps the user's current block list and returns its ID.
+// The account exists even if the returned error is from saving the state.
+func (s *store) register(name, password string, blocks blockList) (uint64, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return 0, fmt.Errorf("error hashing password: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.state.Accounts[name]; ok {
+		return 0, errExistingAccount
+	}
+
+	s.state.LastAccountID++
+	a := &account{
+		ID:             s.state.LastAccountID,
+		PasswordHash:   hash,
+		Blocked:        sortedKeys(blocks.blocked),
+		BlockStrangers: blocks.strangers,
+		Contacts:       sortedKeys(blocks.contacts),
+		Queue:          nil,
+		ReadMarkers:    nil,
+	}
+	s.state.Accounts[name] = a
+
+	return a.ID, s.save()
+}
+
+// bindAdmin records the account registered under an administrator name as the administrator account
+// for that name if the name has none yet.
+func (s *store) bindAdmin(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.state.Admins[name]; ok {
+		return nil
+	}
+	a, ok := s.state.Accounts[name]
+	if !ok {
+		return nil
+	}
+	s.state.Admins[name] = a.ID
+
+	return s.save()
+}
+
+// isAdmin reports whether the account with the ID is the administrator account of one of the names.
+func (s *store) isAdmin(names []string, id uint64) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, name := range names {
+		if admin, ok := s.state.Admins[name]; ok && admin == id {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate returns the ID and block list of the account if the password matches.
+func (s *store) authenticate(name, password string) (uint64, blockList, bool) {
+	s.mutex.Lock()
+	a, ok := s.state.Accounts[name]
+	var id uint64
+	var hash []byte
+	var blocks blockList
+	if ok {
+		id = a.ID
+		hash = a.PasswordHash
+		blocks = a.blocks()
+	}
+	s.mutex.Unlock()
+
+	if !ok {
+		// Compare against a dummy hash so that unknown names take as long as wrong passwords.
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return 0, blockList{}, false
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return 0, blockList{}, false
+	}
+	return id, blocks, true
+}
+
+var (
+	dummyHashOnce  sync.Once
+	dummyHashValue []byte
+)
+
+// dummyHash returns the hash that passwords for unknown names are compared against.
+// It is computed on first use so that importing the package does not run bcrypt.
+func dummyHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHashValue, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	})
+	return dummyHashValue
+}
+
+// setBlocks replaces the block list of an account. It is written to the state file by the next flush.
+func (s *store) setBlocks(name string, blocks blockList) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if a, ok := s.state.Accounts[name]; ok {
+		a.setBlocks(blocks)
+		s.dirty = true
+	}
+}
+
+// accepts reports whether the block list of the account allows direct messages from sender.
+func (s *store) accepts(name, sender string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a, ok := s.state.Accounts[name]
+	return !ok || a.blocks().accepts(sender)
+}
+
+// enqueue adds a direct message to the queue of an account, which can hold at most limit messages.
+func (s *store) enqueue(name string, message queuedMessage, limit int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a, ok := s.state.Accounts[name]
+	if !ok {
+		return errMissingAccount
+	}
+	if len(a.Queue) >= limit {
+		return errQueueFull
+	}
+	a.Queue = append(a.Queue, message)
+
+	return s.save()
+}
+
+// dequeue removes and returns the queued direct messages of an account.
+func (s *store) dequeue(name string) ([]queuedMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a, ok := s.state.Accounts[name]
+	if !ok || len(a.Queue) == 0 {
+		return nil, nil
+	}
+	queue := a.Queue
+	a.Queue = nil
+
+	return queue, s.save()
+}
+
+// readMarkers returns a copy of the read markers of an account.
+func (s *store) readMarkers(name string) map[string]protocol.MessageID {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	markers := make(map[string]protocol.MessageID)
+	if a, ok := s.state.Accounts[name]; ok {
+		for room, id := range a.ReadMarkers {
+			markers[room] = id
+		}
+	}
+	return markers
+}
+
+// setReadMarkers replaces the read markers of an account. They are written to the state file by the next flush.
+func (s *store) setReadMarkers(name string, markers map[string]protocol.MessageID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if a, ok := s.state.Accounts[name]; ok {
+		a.ReadMarkers = markers
+		s.dirty = true
+	}
+}
+
+// accountName returns the current name of the account with the ID.
+func (s *store) accountName(id uint64) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for name, a := range s.state.Accounts {
+		if a.ID == id {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// nextScheduledID returns a new ID for a scheduled chat message or announcement.
+// The last ID is written to the state file by the next save or flush.
+func (s *store) nextScheduledID() uint32 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.state.LastScheduledID++
+	s.dirty = true
+	return s.state.LastScheduledID
+}
+
+// scheduled returns the chat messages and announcements that accounts scheduled.
+func (s *store) scheduled() []scheduledItem {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]scheduledItem(nil), s.state.Scheduled...)
+}
+
+// addScheduled keeps a chat message or announcement that an account scheduled until removeScheduled is called.
+func (s *store) addScheduled(item scheduledItem) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.state.Scheduled = append(s.state.Scheduled, item)
+	return s.save()
+}
+
+// removeScheduled removes the scheduled chat message or announcement with the ID after it was sent or canceled.
+func (s *store) removeScheduled(id uint32) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, item := range s.state.Scheduled {
+		if item.ID == id {
+			s.state.Scheduled = append(s.state.Scheduled[:i], s.state.Scheduled[i+1:]...)
+			return s.save()
+		}
+	}
+	return nil
+}
+
+func (a *account) blocks() blockList {
+	blocks := newBlockList()
+	for _, user := range a.Blocked {
+		blocks.blocked[user] = struct{}{}
+	}
+	blocks.strangers = a.BlockStrangers
+	for _, user := range a.Contacts {
+		blocks.contacts[user] = struct{}{}
+	}
+	return blocks
+}
+
+func (a *account) setBlocks(blocks blockList) {
+	a.Blocked = sortedKeys(blocks.blocked)
+	a.BlockStrangers = blocks.strangers
+	a.Contacts = sortedKeys(blocks.contacts)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
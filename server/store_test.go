@@ -0,0 +1,81 @@
+package server
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mnxn/chat/generic"
+	"github.com/mnxn/chat/protocol"
+)
+
+func TestStoreFlush(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := openStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cost = bcrypt.MinCost
+
+	_, err = s.register("alice", "secret", newBlockList())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.setReadMarkers("alice", map[string]protocol.MessageID{"general": 7})
+
+	// Accounts are written right away, but read markers only when the store is flushed.
+	reopened, err := openStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic.TestEqual(t, "register", "alice", true, reopened.registered("alice"))
+	generic.TestEqual(t, "setReadMarkers", "before flush", map[string]protocol.MessageID{}, reopened.readMarkers("alice"))
+
+	err = s.flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err = openStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic.TestEqual(t, "setReadMarkers", "after flush", map[string]protocol.MessageID{"general": 7}, reopened.readMarkers("alice"))
+}
+
+func TestClose(t *testing.T) {
+	t.Parallel()
+
+	config := DefaultConfig()
+	config.StateFile = filepath.Join(t.TempDir(), "state.json")
+	s, err := NewServer(config, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.store.cost = bcrypt.MinCost
+
+	blocks := newBlockList()
+	_, err = s.store.register("alice", "secret", blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks.blocked["bob"] = struct{}{}
+	s.store.setBlocks("alice", blocks)
+	s.store.setReadMarkers("alice", map[string]protocol.MessageID{"general": 7})
+
+	// Closing the server writes the changes that are still waiting for the next flush.
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := openStore(config.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic.TestEqual(t, "Close", "blocks", false, reopened.accepts("alice", "bob"))
+	generic.TestEqual(t, "Close", "read markers", map[string]protocol.MessageID{"general": 7}, reopened.readMarkers("alice"))
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"github.com/mnxn/chat/protocol"
+)
+
+// The number of subscriptions that a session can have at once.
+const maxSubscriptions = 20
+
+// isAdmin reports whether u is an administrator of the server.
+// Administrator rights belong to the account that first registered an administrator name,
+// so that a guest or another account cannot gain them by taking the name.
+func (s *Server) isAdmin(u *user) bool {
+	return u.registered() && s.store.isAdmin(s.config.Admins, u.account.Load())
+}
+
+// canMonitor reports whether u is allowed to monitor a room whose name matches the pattern.
+// Administrators can monitor every room, including rooms that are created later,
+// while other users need to be an operator of a matching room.
+func (s *Server) canMonitor(u *user, pattern string) bool {
+	if s.isAdmin(u) {
+		return true
+	}
+
+	s.roomsMutex.RLock()
+	defer s.roomsMutex.RUnlock()
+
+	for roomName, room := range s.rooms {
+		if matchFilter(pattern, roomName) && room.isOperator(u.name()) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribe adds a room name pattern to the subscriptions of the session.
+// It reports false if the session already has the maximum number of subscriptions.
+// The subscribers mutex is locked before the subscriptions mutex of a session, as in notifySubscribers.
+func (s *Server) subscribe(session *session, pattern string) bool {
+	s.subscribersMutex.Lock()
+	defer s.subscribersMutex.Unlock()
+	session.subscriptionsMutex.Lock()
+	defer session.subscriptionsMutex.Unlock()
+
+	if contains(session.subscriptions, pattern) {
+		return true
+	}
+	if len(session.subscriptions) >= maxSubscriptions {
+		return false
+	}
+	session.subscriptions = append(session.subscriptions, pattern)
+	s.subscribers[session] = struct{}{}
+	return true
+}
+
+// unsubscribe removes a pattern from the subscriptions of the session, or every pattern if it is empty.
+func (s *Server) unsubscribe(session *session, pattern string) {
+	s.subscribersMutex.Lock()
+	defer s.subscribersMutex.Unlock()
+	session.subscriptionsMutex.Lock()
+	defer session.subscriptionsMutex.Unlock()
+
+	subscriptions := make([]string, 0, len(session.subscriptions))
+	for _, subscription := range session.subscriptions {
+		if pattern != "" && subscription != pattern {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	session.subscriptions = subscriptions
+
+	if len(subscriptions) == 0 {
+		delete(s.subscribers, session)
+	}
+}
+
+// subscriptionList returns the subscriptions of the session.
+func (session *session) subscriptionList() *protocol.SubscriptionListResponse {
+	session.subscriptionsMutex.RLock()
+	defer session.subscriptionsMutex.RUnlock()
+
+	return &protocol.SubscriptionListResponse{
+		Count:    uint32(len(session.subscriptions)),
+		Patterns: append([]string(nil), session.subscriptions...),
+	}
+}
+
+// subscribed reports whether the session subscribed to the room.
+func (session *session) subscribed(roomName string) bool {
+	session.subscriptionsMutex.RLock()
+	defer session.subscriptionsMutex.RUnlock()
+
+	for _, pattern := range session.subscriptions {
+		if matchFilter(pattern, roomName) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifySubscribers sends a chat message of a room to the sessions that subscribed to the room
+// and are allowed to monitor it. Members of the room already received the message, so they are skipped.
+func (s *Server) notifySubscribers(roomName string, room *room, choose func(*session) protocol.ServerResponse) {
+	s.subscribersMutex.RLock()
+	defer s.subscribersMutex.RUnlock()
+
+	for session := range s.subscribers {
+		u := session.identity()
+		if room.contains(u.name()) || !session.subscribed(roomName) {
+			continue
+		}
+		if !s.isAdmin(u) && !room.isOperator(u.name()) {
+			continue
+		}
+		if response := choose(session); response != nil {
+			session.send(response)
+		}
+	}
+}
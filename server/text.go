@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mnxn/chat/protocol"
+)
+
+// TextRules describes which chat message text is accepted.
+type TextRules struct {
+	MaxLength  int    `json:"max_length"`  // The maximum number of characters in a message. Zero means unlimited.
+	Control    string `json:"control"`     // Either "strip" to remove control characters and escape sequences or "reject".
+	AllowEmpty bool   `json:"allow_empty"` // Whether messages without any visible text are relayed.
+}
+
+// DefaultTextRules returns the rules used for message text when the config does not specify any.
+func DefaultTextRules() TextRules {
+	return TextRules{
+		MaxLength:  2000,
+		Control:    "strip",
+		AllowEmpty: false,
+	}
+}
+
+func (t TextRules) check() error {
+	if t.MaxLength < 0 {
+		return errors.New("max_length cannot be negative")
+	}
+	if t.Control != "strip" && t.Control != "reject" {
+		return fmt.Errorf("control must be \"strip\" or \"reject\", not %q", t.Control)
+	}
+	return nil
+}
+
+// validate returns the text that the server should relay,
+// or an error that explains the text content requirements to the client.
+func (t TextRules) validate(text string) (string, error) {
+	stripped := protocol.StripControl(text)
+	if stripped != text {
+		if t.Control == "reject" {
+			return "", errors.New("cannot contain control characters or escape sequences")
+		}
+		text = stripped
+	}
+
+	if !t.AllowEmpty && strings.TrimSpace(text) == "" {
+		return "", errors.New("cannot be empty")
+	}
+	if t.MaxLength > 0 && utf8.RuneCountInString(text) > t.MaxLength {
+		return "", fmt.Errorf("must be at most %d characters", t.MaxLength)
+	}
+
+	return text, nil
+}
+
+// The maximum number of characters in a reaction. Emoji sequences can take several characters.
+const maxReactionLength = 16
+
+// validateReaction returns an error that explains the reaction requirements to the client
+// unless the reaction is a short emoji or word.
+func validateReaction(reaction string) error {
+	if reaction == "" || utf8.RuneCountInString(reaction) > maxReactionLength {
+		return fmt.Errorf("must be between 1 and %d characters", maxReactionLength)
+	}
+	if !utf8.ValidString(reaction) {
+		return errors.New("must be valid UTF-8")
+	}
+	for _, r := range reaction {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return errors.New("cannot contain spaces or control characters")
+		}
+	}
+	return nil
+}
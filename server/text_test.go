@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/mnxn/chat/generic"
+)
+
+var textRulesTests = []struct {
+	rules    TextRules
+	text     string
+	expected string
+	valid    bool
+}{
+	{DefaultTextRules(), "hello", "hello", true},
+	{DefaultTextRules(), "", "", false},
+	{DefaultTextRules(), " \t ", "", false},
+	{DefaultTextRules(), "\x1b[2J", "", false},
+	{DefaultTextRules(), "\x1b[31mred\x1b[0m", "red", true},
+	{DefaultTextRules(), "two\nlines", "twolines", true},
+	{TextRules{MaxLength: 0, Control: "reject", AllowEmpty: false}, "two\nlines", "", false},
+	{TextRules{MaxLength: 0, Control: "strip", AllowEmpty: true}, "", "", true},
+	{TextRules{MaxLength: 3, Control: "strip", AllowEmpty: false}, "αβγ", "αβγ", true},
+	{TextRules{MaxLength: 3, Control: "strip", AllowEmpty: false}, "αβγδ", "", false},
+}
+
+func TestTextRulesValidate(t *testing.T) {
+	t.Parallel()
+
+	for i := range textRulesTests {
+		test := textRulesTests[i]
+		t.Run("validate", func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := test.rules.validate(test.text)
+			generic.TestEqual(t, "valid", test.text, test.valid, err == nil)
+			generic.TestEqual(t, "validate", test.text, test.expected, actual)
+		})
+	}
+}
+
+var reactionTests = []struct {
+	reaction string
+	valid    bool
+}{
+	{"\U0001F44D", true},
+	{"\U0001F468\u200D\U0001F469\u200D\U0001F467", true},
+	{"+1", true},
+	{"", false},
+	{"thumbs up", false},
+	{"\x1b[2J", false},
+	{"\xff", false},
+	{"abcdefghijklmnopq", false},
+}
+
+func TestValidateReaction(t *testing.T) {
+	t.Parallel()
+
+	for i := range reactionTests {
+		test := reactionTests[i]
+		t.Run("validateReaction", func(t *testing.T) {
+			t.Parallel()
+
+			err := validateReaction(test.reaction)
+			generic.TestEqual(t, "valid", test.reaction, test.valid, err == nil)
+		})
+	}
+}